@@ -3,6 +3,10 @@ package cloud
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -23,6 +27,10 @@ type AwsS3Uploader interface {
 type AwsS3Client struct {
 	Client     *s3.Client
 	BucketName string
+
+	// ContentAddressed names each object by the SHA-256 hash of its content,
+	// so that identical content is stored once.
+	ContentAddressed bool
 }
 
 type Option interface {
@@ -50,6 +58,29 @@ func WithExtension(extension string) Option {
 	})
 }
 
+// WithReference references the object by reference before the object is stored.
+// Identical contents share an object when content addressed, so an object must be referenced
+// before it is found to exist, or it may be deleted as unreferenced before it is referenced.
+func WithReference(reference func(url string) error) Option {
+	return referenceOption(reference)
+}
+
+type referenceOption func(url string) error
+
+func (referenceOption) apply(input *s3.PutObjectInput) {}
+
+// referenceObject calls every reference of the options with url.
+func referenceObject(url string, options []Option) error {
+	for _, option := range options {
+		if reference, ok := option.(referenceOption); ok {
+			if err := reference(url); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *AwsS3Client) UploadFile(file multipart.File, options ...Option) (url string, err error) {
 	mType, err := mimetype.DetectReader(file)
 	if err != nil {
@@ -60,9 +91,21 @@ func (c *AwsS3Client) UploadFile(file multipart.File, options ...Option) (url st
 		return "", err
 	}
 
+	fileName := generateFileName(mType.Extension())
+	if c.ContentAddressed {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		fileName = contentFileName(hash.Sum(nil), mType.Extension())
+	}
+
 	input := &s3.PutObjectInput{
 		Bucket:      aws.String(c.BucketName),
-		Key:         aws.String(generateFileName(mType.Extension())),
+		Key:         aws.String(fileName),
 		Body:        file,
 		ContentType: aws.String(mType.String()),
 		ACL:         types.ObjectCannedACLPublicRead,
@@ -74,9 +117,15 @@ func (c *AwsS3Client) UploadFile(file multipart.File, options ...Option) (url st
 func (c *AwsS3Client) UploadBytes(file []byte, options ...Option) (url string, err error) {
 	mType := mimetype.Detect(file)
 
+	fileName := generateFileName(mType.Extension())
+	if c.ContentAddressed {
+		hash := sha256.Sum256(file)
+		fileName = contentFileName(hash[:], mType.Extension())
+	}
+
 	input := &s3.PutObjectInput{
 		Bucket:      aws.String(c.BucketName),
-		Key:         aws.String(generateFileName(mType.Extension())),
+		Key:         aws.String(fileName),
 		Body:        bytes.NewReader(file),
 		ContentType: aws.String(mType.String()),
 		ACL:         types.ObjectCannedACLPublicRead,
@@ -90,6 +139,21 @@ func (c *AwsS3Client) put(input *s3.PutObjectInput, options ...Option) (url stri
 		option.apply(input)
 	}
 
+	if err := referenceObject(getS3ObjectUrl(c.BucketName, *input.Key), options); err != nil {
+		return "", err
+	}
+
+	if c.ContentAddressed {
+		// identical content is already stored
+		exist, err := c.exist(*input.Key)
+		if err != nil {
+			return "", err
+		}
+		if exist {
+			return getS3ObjectUrl(c.BucketName, *input.Key), nil
+		}
+	}
+
 	if _, err := c.Client.PutObject(context.TODO(), input); err != nil {
 		return "", err
 	}
@@ -97,6 +161,70 @@ func (c *AwsS3Client) put(input *s3.PutObjectInput, options ...Option) (url stri
 	return getS3ObjectUrl(c.BucketName, *input.Key), nil
 }
 
+func (c *AwsS3Client) exist(key string) (bool, error) {
+	_, err := c.Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(c.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var apiErr interface{ ErrorCode() string }
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete deletes the object at url in the bucket.
+func (c *AwsS3Client) Delete(url string) error {
+	key, err := objectKeyOf(c.BucketName, url)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(c.BucketName),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Object is an object stored in the bucket.
+type Object struct {
+	Url          string
+	Size         int64
+	LastModified time.Time
+}
+
+// List lists every object in the bucket.
+func (c *AwsS3Client) List() ([]Object, error) {
+	objects := make([]Object, 0)
+	paginator := s3.NewListObjectsV2Paginator(c.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.BucketName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range page.Contents {
+			object := Object{
+				Url:  getS3ObjectUrl(c.BucketName, aws.ToString(content.Key)),
+				Size: content.Size,
+			}
+			if content.LastModified != nil {
+				object.LastModified = *content.LastModified
+			}
+			objects = append(objects, object)
+		}
+	}
+
+	return objects, nil
+}
+
 func generateFileName(addLast ...string) string {
 	const _fileNameTimeLayout = "2006/01/02/"
 	fileName := time.Now().Format(_fileNameTimeLayout) + uuid.NewString()
@@ -107,7 +235,29 @@ func generateFileName(addLast ...string) string {
 	return fileName
 }
 
+// contentFileName is the object key of content addressed objects.
+func contentFileName(hash []byte, addLast ...string) string {
+	const _contentFileNamePrefix = "sha256/"
+	fileName := _contentFileNamePrefix + hex.EncodeToString(hash)
+	for _, v := range addLast {
+		fileName += v
+	}
+
+	return fileName
+}
+
+const _s3ObjectUrlPrefix = "https://s3.ap-northeast-2.amazonaws.com/"
+
 func getS3ObjectUrl(bucketName, fileName string) string {
-	const _s3ObjectUrlPrefix = "https://s3.ap-northeast-2.amazonaws.com/"
 	return _s3ObjectUrlPrefix + bucketName + "/" + fileName
 }
+
+// objectKeyOf is the inverse of getS3ObjectUrl.
+func objectKeyOf(bucketName, url string) (string, error) {
+	prefix := getS3ObjectUrl(bucketName, "")
+	if !strings.HasPrefix(url, prefix) || len(url) == len(prefix) {
+		return "", fmt.Errorf("object url is not in bucket %s: %s", bucketName, url)
+	}
+
+	return strings.TrimPrefix(url, prefix), nil
+}
@@ -3,6 +3,7 @@ package cloud
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -115,4 +116,58 @@ func TestAwsS3Client_PutBytes(t *testing.T) {
 	baseChecksum := sha256.Sum256(baseFileBytes)
 	responseChecksum := sha256.Sum256(responseFileBytes)
 	assertions.Equal(baseChecksum, responseChecksum)
-}
\ No newline at end of file
+}
+func Test_contentFileName(t *testing.T) {
+	hash := sha256.Sum256([]byte("nns"))
+	a := contentFileName(hash[:], ".csv")
+
+	hash = sha256.Sum256([]byte("nns"))
+	assert.Equal(t, a, contentFileName(hash[:], ".csv"))
+	assert.Regexp(t, `^sha256/[0-9a-f]{64}\.csv$`, a)
+
+	hash = sha256.Sum256([]byte("nnS"))
+	assert.NotEqual(t, a, contentFileName(hash[:], ".csv"))
+}
+
+func Test_referenceObject(t *testing.T) {
+	var referenced []string
+	options := []Option{
+		WithContentType("text/csv"),
+		WithReference(func(url string) error {
+			referenced = append(referenced, url)
+			return nil
+		}),
+	}
+
+	assert.NoError(t, referenceObject("https://s3.ap-northeast-2.amazonaws.com/dataset/a.csv", options))
+	assert.Equal(t, []string{"https://s3.ap-northeast-2.amazonaws.com/dataset/a.csv"}, referenced)
+
+	failed := errors.New("failed")
+	assert.Equal(t, failed, referenceObject("a.csv", []Option{WithReference(func(url string) error { return failed })}))
+}
+
+func Test_objectKeyOf(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: getS3ObjectUrl("dataset", "sha256/abc.csv"), want: "sha256/abc.csv"},
+		{url: getS3ObjectUrl("model", "sha256/abc.csv"), wantErr: true},
+		{url: getS3ObjectUrl("dataset", ""), wantErr: true},
+		{url: "https://example.com/dataset/abc.csv", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := objectKeyOf("dataset", tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
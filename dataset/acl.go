@@ -0,0 +1,257 @@
+package dataset
+
+import (
+	"database/sql"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"net/http"
+	"nns_back/log"
+	"nns_back/repository"
+	"nns_back/util"
+	"time"
+)
+
+// Permission is the permission on a dataset shared with a user or a team.
+type Permission string
+
+const (
+	PermissionRead  Permission = "READ"  // can see the dataset and add it to the library
+	PermissionTrain Permission = "TRAIN" // can train with the dataset as well
+)
+
+func (p Permission) Validate() error {
+	switch p {
+	case PermissionRead, PermissionTrain:
+		return nil
+	default:
+		return ErrInvalidPermission
+	}
+}
+
+var ErrInvalidPermission = errors.New("invalid permission")
+
+// ACL is an access control entry of a dataset.
+// Exactly one of UserID and TeamID is valid.
+type ACL struct {
+	ID         int64         `db:"id"`
+	DatasetID  int64         `db:"dataset_id"`
+	UserID     sql.NullInt64 `db:"user_id"`
+	TeamID     sql.NullInt64 `db:"team_id"`
+	Permission Permission    `db:"permission"`
+	CreateTime time.Time     `db:"create_time"`
+	UpdateTime time.Time     `db:"update_time"`
+
+	// additional
+	Name sql.NullString `db:"name"` // user or team name
+}
+
+// IsAccessible reports whether the user can see the dataset:
+// public datasets, the user's own datasets and datasets shared with the user are accessible.
+func IsAccessible(repo Repository, ds Dataset, userId int64) (bool, error) {
+	if ds.IsAccessibleBy(userId) {
+		return true, nil
+	}
+
+	permission, err := repo.FindGrantedPermission(userId, ds.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permission != "", nil
+}
+
+// usableBy is the sql condition that the user, an sql expression, can train with the dataset ds:
+// the upload is complete, and the dataset is public, owned by the user or shared with the user to train.
+func usableBy(userId string) string {
+	return `(ds.status = 'EXIST'
+    AND (ds.public IS TRUE
+        OR ds.user_id = ` + userId + `
+        OR EXISTS(SELECT 1
+                  FROM dataset_acl acl
+                  WHERE acl.dataset_id = ds.id
+                    AND acl.permission = 'TRAIN'
+                    AND (acl.user_id = ` + userId + `
+                      OR acl.team_id IN (SELECT tm.team_id FROM team_member tm WHERE tm.user_id = ` + userId + `)))))`
+}
+
+type ACLDto struct {
+	ID         int64      `json:"id"`
+	UserID     *int64     `json:"userId"`
+	TeamID     *int64     `json:"teamId"`
+	Name       string     `json:"name"` // user or team name
+	Permission Permission `json:"permission"`
+	CreateTime time.Time  `json:"createTime"`
+}
+
+type GetACLListResponseBody struct {
+	ACL []ACLDto `json:"acl"`
+}
+
+// GetACLList lists users and teams the dataset is shared with. Only the owner can see them.
+func (h *handler) GetACLList(w http.ResponseWriter, r *http.Request) {
+	ds, ok := h.findOwnDataset(w, r)
+	if !ok {
+		return
+	}
+
+	acls, err := h.datasetRepository.FindACLs(ds.ID)
+	if err != nil {
+		log.Errorf("failed to find dataset acl: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	resp := GetACLListResponseBody{ACL: make([]ACLDto, 0, len(acls))}
+	for _, acl := range acls {
+		dto := ACLDto{
+			ID:         acl.ID,
+			Name:       acl.Name.String,
+			Permission: acl.Permission,
+			CreateTime: acl.CreateTime,
+		}
+		if acl.UserID.Valid {
+			dto.UserID = &acl.UserID.Int64
+		}
+		if acl.TeamID.Valid {
+			dto.TeamID = &acl.TeamID.Int64
+		}
+		resp.ACL = append(resp.ACL, dto)
+	}
+
+	util.WriteJson(w, http.StatusOK, resp)
+}
+
+type GrantACLRequestBody struct {
+	UserID     int64      `json:"userId"`
+	TeamID     int64      `json:"teamId"`
+	Permission Permission `json:"permission"`
+}
+
+func (g GrantACLRequestBody) Validate() error {
+	if (g.UserID > 0) == (g.TeamID > 0) {
+		return errors.New("either userId or teamId is required")
+	}
+	if g.UserID < 0 || g.TeamID < 0 {
+		return errors.New("invalid userId or teamId")
+	}
+
+	return g.Permission.Validate()
+}
+
+// GrantACL shares the dataset with a user or a team, or changes the permission shared before.
+func (h *handler) GrantACL(w http.ResponseWriter, r *http.Request) {
+	ds, ok := h.findOwnDataset(w, r)
+	if !ok {
+		return
+	}
+
+	body := GrantACLRequestBody{}
+	if err := util.BindJson(r.Body, &body); err != nil {
+		log.Warnw("failed to bind request body",
+			"error", err)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	acl := ACL{
+		DatasetID:  ds.ID,
+		Permission: body.Permission,
+	}
+	var err error
+	if body.UserID > 0 {
+		if body.UserID == ds.UserID {
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+			return
+		}
+		_, err = h.userRepository.SelectUser(repository.ClassifiedById(body.UserID))
+		acl.UserID = sql.NullInt64{Int64: body.UserID, Valid: true}
+	} else {
+		_, err = h.teamRepository.SelectTeam(body.TeamID)
+		acl.TeamID = sql.NullInt64{Int64: body.TeamID, Valid: true}
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warnw("user or team to share with not exist",
+				"userId", body.UserID,
+				"teamId", body.TeamID)
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+			return
+		}
+		log.Errorf("failed to find user or team: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if err := h.datasetRepository.GrantACL(acl); err != nil {
+		log.Errorf("failed to grant dataset acl: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RevokeACL stops sharing the dataset.
+// Library entries of the users who lost the permission become unusable.
+func (h *handler) RevokeACL(w http.ResponseWriter, r *http.Request) {
+	ds, ok := h.findOwnDataset(w, r)
+	if !ok {
+		return
+	}
+
+	aclId, err := util.Atoi64(mux.Vars(r)["aclId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	if err := h.datasetRepository.RevokeACL(ds.ID, aclId); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorf("failed to revoke dataset acl: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// findOwnDataset finds the dataset in the path uploaded by the user.
+// It writes an error response and returns false if not found.
+func (h *handler) findOwnDataset(w http.ResponseWriter, r *http.Request) (Dataset, bool) {
+	datasetId, err := util.Atoi64(mux.Vars(r)["datasetId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return Dataset{}, false
+	}
+
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorf("failed to get userId")
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return Dataset{}, false
+	}
+
+	ds, err := h.datasetRepository.FindByID(datasetId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+			return Dataset{}, false
+		}
+		log.Errorf("failed to find dataset: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return Dataset{}, false
+	}
+
+	if ds.UserID != userId {
+		log.Warnw("inaccessible dataset id",
+			"id", datasetId,
+			"userid", userId)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+		return Dataset{}, false
+	}
+
+	return ds, true
+}
@@ -0,0 +1,86 @@
+package dataset
+
+import (
+	"database/sql"
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// aclRepository is a Repository with in-memory granted permissions.
+type aclRepository struct {
+	Repository
+	granted map[int64]Permission // by user id
+}
+
+func (r aclRepository) FindGrantedPermission(userId int64, datasetId int64) (Permission, error) {
+	return r.granted[userId], nil
+}
+
+func TestIsAccessible(t *testing.T) {
+	repo := aclRepository{granted: map[int64]Permission{3: PermissionRead, 4: PermissionTrain}}
+	private := Dataset{ID: 1, UserID: 1, Public: sql.NullBool{Bool: false, Valid: true}}
+	public := Dataset{ID: 2, UserID: 1, Public: sql.NullBool{Bool: true, Valid: true}}
+
+	tests := []struct {
+		name   string
+		ds     Dataset
+		userId int64
+		want   bool
+	}{
+		{name: "owner", ds: private, userId: 1, want: true},
+		{name: "public", ds: public, userId: 2, want: true},
+		{name: "not shared", ds: private, userId: 2, want: false},
+		{name: "shared read only", ds: private, userId: 3, want: true},
+		{name: "shared to train", ds: private, userId: 4, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsAccessible(repo, tt.ds, tt.userId)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGrantACLRequestBody_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    GrantACLRequestBody
+		wantErr bool
+	}{
+		{name: "user", body: GrantACLRequestBody{UserID: 2, Permission: PermissionRead}},
+		{name: "team", body: GrantACLRequestBody{TeamID: 2, Permission: PermissionTrain}},
+		{name: "both", body: GrantACLRequestBody{UserID: 2, TeamID: 2, Permission: PermissionRead}, wantErr: true},
+		{name: "none", body: GrantACLRequestBody{Permission: PermissionRead}, wantErr: true},
+		{name: "invalid permission", body: GrantACLRequestBody{UserID: 2, Permission: "WRITE"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.body.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_usableBy(t *testing.T) {
+	// the user expression is used for the owner, user grants and team grants
+	assert.Equal(t, 3, strings.Count(usableBy("?"), "?"))
+	assert.Equal(t, 3, strings.Count(usableBy("dsl.user_id"), "dsl.user_id"))
+	assert.Contains(t, usableBy("?"), "acl.permission = 'TRAIN'")
+}
+
+func TestCatalogQuery_whereShared(t *testing.T) {
+	stmt, args, err := CatalogQuery{Shared: true}.where(squirrel.Select("COUNT(*)").From("dataset ds"), 7).ToSql()
+	assert.NoError(t, err)
+	assert.NotContains(t, stmt, "ds.public")
+	assert.Contains(t, stmt, "FROM dataset_acl acl")
+	assert.Equal(t, []interface{}{int64(7), int64(7)}, args)
+}
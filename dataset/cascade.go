@@ -0,0 +1,64 @@
+package dataset
+
+import (
+	"encoding/json"
+	"github.com/tidwall/gjson"
+	"nns_back/util"
+)
+
+// ConfigInvalidReasonDatasetDeleted is the invalid reason of dataset configs whose dataset was deleted.
+const ConfigInvalidReasonDatasetDeleted = "DATASET_DELETED"
+
+// DeleteResult is what deleting a dataset changed.
+type DeleteResult struct {
+	Released         []string          // urls of objects no longer referenced
+	AffectedProjects []AffectedProject // projects with dataset configs using the dataset
+}
+
+// AffectedProject is a project whose dataset configs were flagged invalid by deleting a dataset.
+type AffectedProject struct {
+	ProjectId        int64
+	UserId           int64
+	ProjectNo        int
+	Name             string
+	DatasetConfigIds []int64 // invalidated dataset configs
+	ConfigReset      bool    // the dataset config set in the project config was reset
+}
+
+// _resetDatasetConfig is the dataset config of a new project config.
+const _resetDatasetConfig = `{"valid": false, "id": 0}`
+
+// resetProjectDatasetConfig resets the dataset config of the project config
+// if it is set to one of datasetConfigIds. It reports whether the config was reset.
+func resetProjectDatasetConfig(config util.NullJson, datasetConfigIds []int64) (util.NullJson, bool, error) {
+	if !config.Valid {
+		return config, false, nil
+	}
+
+	id := gjson.GetBytes(config.Json, "dataset_config.id").Int()
+	if !gjson.GetBytes(config.Json, "dataset_config.valid").Bool() || !containsInt64(datasetConfigIds, id) {
+		return config, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config.Json, &fields); err != nil {
+		return config, false, err
+	}
+	fields["dataset_config"] = json.RawMessage(_resetDatasetConfig)
+
+	reset, err := json.Marshal(fields)
+	if err != nil {
+		return config, false, err
+	}
+
+	return util.NullJson{Json: reset, Valid: true}, true, nil
+}
+
+func containsInt64(s []int64, value int64) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nns_back/util"
+	"testing"
+)
+
+func Test_resetProjectDatasetConfig(t *testing.T) {
+	config := func(s string) util.NullJson {
+		return util.NullJson{Json: []byte(s), Valid: true}
+	}
+
+	tests := []struct {
+		name      string
+		config    util.NullJson
+		wantReset bool
+		want      string
+	}{
+		{
+			name:      "set to invalidated config",
+			config:    config(`{"epochs": 10, "dataset_config": {"valid": true, "id": 3}}`),
+			wantReset: true,
+			want:      `{"epochs": 10, "dataset_config": {"valid": false, "id": 0}}`,
+		},
+		{
+			name:   "set to other config",
+			config: config(`{"epochs": 10, "dataset_config": {"valid": true, "id": 4}}`),
+		},
+		{
+			name:   "not set",
+			config: config(`{"epochs": 10, "dataset_config": {"valid": false, "id": 3}}`),
+		},
+		{
+			name:   "null config",
+			config: util.NullJson{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reset, err := resetProjectDatasetConfig(tt.config, []int64{1, 3})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantReset, reset)
+			if tt.wantReset {
+				assert.JSONEq(t, tt.want, string(got.Json))
+			} else {
+				assert.Equal(t, tt.config, got)
+			}
+		})
+	}
+}
+
+func Test_newDeleteDatasetResponseBody(t *testing.T) {
+	resp := newDeleteDatasetResponseBody(1, []AffectedProject{
+		{ProjectId: 10, UserId: 1, ProjectNo: 2, Name: "mine", DatasetConfigIds: []int64{3}, ConfigReset: true},
+		{ProjectId: 20, UserId: 2, ProjectNo: 1, Name: "theirs", DatasetConfigIds: []int64{4}},
+	})
+
+	assert.Equal(t, DeleteDatasetResponseBody{
+		AffectedProjects: []AffectedProjectDto{
+			{ProjectNo: 2, Name: "mine", DatasetConfigIds: []int64{3}, ConfigReset: true},
+		},
+		OtherUserProjects: 1,
+	}, resp)
+}
@@ -0,0 +1,128 @@
+package dataset
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CatalogSort is the sort order of the public dataset catalog.
+type CatalogSort int
+
+const (
+	SortByNewest     CatalogSort = iota
+	SortByPopularity             // most added to libraries first
+	SortBySize                   // largest uploaded file first
+)
+
+// CatalogQuery is the search condition of the public dataset catalog.
+// Zero value fields are not used as a condition.
+type CatalogQuery struct {
+	Search string   // full-text search on name and description
+	Kind   Kind     // dataset kind
+	Owner  string   // uploader name
+	Tags   []string // datasets having all the tags
+	Shared bool     // datasets shared with the user instead of public datasets
+	Sort   CatalogSort
+}
+
+// where adds the catalog conditions to builder.
+// Public datasets and the user's own public datasets being uploaded are visible,
+// or datasets shared with the user if q.Shared.
+func (q CatalogQuery) where(builder squirrel.SelectBuilder, userId int64) squirrel.SelectBuilder {
+	if q.Shared {
+		builder = builder.
+			Where("ds.status = 'EXIST'").
+			Where(`ds.id IN (SELECT acl.dataset_id
+                FROM dataset_acl acl
+                WHERE acl.user_id = ?
+                   OR acl.team_id IN (SELECT tm.team_id FROM team_member tm WHERE tm.user_id = ?))`, userId, userId)
+	} else {
+		builder = builder.
+			Where("ds.public = TRUE").
+			Where("(ds.status = 'EXIST' or (ds.status != 'DELETED' and ds.user_id = ?))", userId)
+	}
+
+	if search := fullTextQuery(q.Search); search != "" {
+		builder = builder.Where("MATCH(ds.name, ds.description) AGAINST (? IN BOOLEAN MODE)", search)
+	}
+
+	if q.Kind != "" {
+		builder = builder.Where(squirrel.Eq{"ds.kind": q.Kind})
+	}
+
+	if q.Owner != "" {
+		builder = builder.
+			Join("user u on ds.user_id = u.id").
+			Where(squirrel.Eq{"u.name": q.Owner})
+	}
+
+	if len(q.Tags) > 0 {
+		tagged := squirrel.Select("dt.dataset_id").
+			From("dataset_tag dt").
+			Where(squirrel.Eq{"dt.name": q.Tags}).
+			GroupBy("dt.dataset_id").
+			Having("COUNT(*) = ?", len(q.Tags))
+		builder = builder.Where(squirrel.Expr("ds.id IN (?)", tagged))
+	}
+
+	return builder
+}
+
+func (q CatalogQuery) orderBy(builder squirrel.SelectBuilder) squirrel.SelectBuilder {
+	switch q.Sort {
+	case SortByPopularity:
+		return builder.OrderBy("library_count DESC", "ds.id DESC")
+	case SortBySize:
+		return builder.OrderBy("ds.size DESC", "ds.id DESC")
+	default:
+		return builder.OrderBy("ds.id DESC")
+	}
+}
+
+// fullTextQuery converts a user search string into a mysql boolean mode full-text query
+// which requires every word.
+func fullTextQuery(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		// boolean mode operators are not allowed in a word
+		return unicode.IsSpace(r) || strings.ContainsRune(`+-<>()~*"@`, r)
+	})
+
+	for i, word := range words {
+		words[i] = "+" + word
+	}
+	return strings.Join(words, " ")
+}
+
+const (
+	_maxTagCount  = 10
+	_maxTagLength = 30
+)
+
+var ErrInvalidTag = errors.New("invalid tag")
+
+// normalizeTags trims and lower-cases tags and removes duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > _maxTagCount {
+		return nil, errors.Wrapf(ErrInvalidTag, "too many tags: %d", len(tags))
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > _maxTagLength || strings.ContainsRune(tag, ',') {
+			return nil, errors.Wrapf(ErrInvalidTag, "tag: %q", tag)
+		}
+
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized, nil
+}
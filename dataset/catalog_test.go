@@ -0,0 +1,123 @@
+package dataset
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCatalogQuery_where(t *testing.T) {
+	assert := assert.New(t)
+
+	query := CatalogQuery{
+		Search: "hand written",
+		Kind:   KindImages,
+		Owner:  "kim",
+		Tags:   []string{"digit", "vision"},
+		Sort:   SortByPopularity,
+	}
+
+	stmt, args, err := query.orderBy(query.where(squirrel.Select("ds.id").From("dataset ds"), 7)).ToSql()
+	assert.NoError(err)
+	assert.Equal("SELECT ds.id FROM dataset ds JOIN user u on ds.user_id = u.id "+
+		"WHERE ds.public = TRUE "+
+		"AND (ds.status = 'EXIST' or (ds.status != 'DELETED' and ds.user_id = ?)) "+
+		"AND MATCH(ds.name, ds.description) AGAINST (? IN BOOLEAN MODE) "+
+		"AND ds.kind = ? "+
+		"AND u.name = ? "+
+		"AND ds.id IN (SELECT dt.dataset_id FROM dataset_tag dt WHERE dt.name IN (?,?) GROUP BY dt.dataset_id HAVING COUNT(*) = ?) "+
+		"ORDER BY library_count DESC, ds.id DESC", stmt)
+	assert.Equal([]interface{}{int64(7), "+hand +written", KindImages, "kim", "digit", "vision", 2}, args)
+}
+
+func TestCatalogQuery_whereNone(t *testing.T) {
+	stmt, args, err := CatalogQuery{}.where(squirrel.Select("COUNT(*)").From("dataset ds"), 7).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM dataset ds "+
+		"WHERE ds.public = TRUE "+
+		"AND (ds.status = 'EXIST' or (ds.status != 'DELETED' and ds.user_id = ?))", stmt)
+	assert.Equal(t, []interface{}{int64(7)}, args)
+}
+
+func Test_fullTextQuery(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{search: "", want: ""},
+		{search: "  mnist ", want: "+mnist"},
+		{search: "손글씨 숫자", want: "+손글씨 +숫자"},
+		{search: `-drop +"table"* (x)`, want: "+drop +table +x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			assert.Equal(t, tt.want, fullTextQuery(tt.search))
+		})
+	}
+}
+
+func Test_normalizeTags(t *testing.T) {
+	assert := assert.New(t)
+
+	tags, err := normalizeTags([]string{" Vision", "digit", "vision "})
+	assert.NoError(err)
+	assert.Equal([]string{"vision", "digit"}, tags)
+
+	_, err = normalizeTags([]string{""})
+	assert.ErrorIs(err, ErrInvalidTag)
+
+	_, err = normalizeTags([]string{"a,b"})
+	assert.ErrorIs(err, ErrInvalidTag)
+
+	_, err = normalizeTags(make([]string, _maxTagCount+1))
+	assert.ErrorIs(err, ErrInvalidTag)
+}
+
+func Test_catalogQueryFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    CatalogQuery
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			target: "/api/datasets",
+			want:   CatalogQuery{Tags: []string{}},
+		},
+		{
+			name:   "all",
+			target: "/api/datasets?search=mnist&kind=IMAGES&owner=kim&tag=Digit&tag=vision&sort=size",
+			want: CatalogQuery{
+				Search: "mnist",
+				Kind:   KindImages,
+				Owner:  "kim",
+				Tags:   []string{"digit", "vision"},
+				Sort:   SortBySize,
+			},
+		},
+		{
+			name:   "shared",
+			target: "/api/datasets?shared=true",
+			want:   CatalogQuery{Tags: []string{}, Shared: true},
+		},
+		{name: "invalid kind", target: "/api/datasets?kind=VIDEO", wantErr: true},
+		{name: "invalid shared", target: "/api/datasets?shared=maybe", wantErr: true},
+		{name: "invalid sort", target: "/api/datasets?sort=oldest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := catalogQueryFromRequest(httptest.NewRequest("GET", tt.target, nil))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -9,10 +9,15 @@ create table dataset
     description varchar(2000) null,
     public tinyint(1) null,
     status varchar(10) not null,
+    size bigint default 0 not null,
+    profile json null,
     create_time datetime default current_timestamp() not null,
     update_time datetime default current_timestamp() not null on update current_timestamp()
 );
 
+create fulltext index dataset__fulltext_name_description
+    on dataset (name, description) with parser ngram;
+
 create table dataset_library
 (
     id bigint auto_increment
@@ -29,3 +34,93 @@ create table dataset_library
 create index dataset_library__index_user_id
     on dataset_library (user_id);
 
+
+create table dataset_tag
+(
+    id bigint auto_increment
+        primary key,
+    dataset_id bigint not null,
+    name varchar(30) not null,
+    create_time datetime default current_timestamp() not null,
+    constraint dataset_tag_uk_dataset_id_name
+        unique (dataset_id, name)
+);
+
+create index dataset_tag__index_name
+    on dataset_tag (name);
+
+create table dataset_version
+(
+    id bigint auto_increment
+        primary key,
+    dataset_id bigint not null,
+    version_no bigint not null,
+    url varchar(1024) null,
+    origin_url varchar(1024) null,
+    kind varchar(10) not null,
+    size bigint default 0 not null,
+    profile json null,
+    status varchar(10) not null,
+    create_time datetime default current_timestamp() not null,
+    update_time datetime default current_timestamp() not null on update current_timestamp(),
+    constraint dataset_version_uk_dataset_id_version_no
+        unique (dataset_id, version_no)
+);
+
+-- images of each dataset version normalized by an image option before training.
+-- versions never change, so the normalized dataset is reused by every train of the same version and option.
+create table dataset_version_normalization
+(
+    id bigint auto_increment
+        primary key,
+    version_id bigint not null,
+    image_option varchar(64) not null,
+    url varchar(1024) not null,
+    create_time datetime default current_timestamp() not null,
+    constraint dataset_version_normalization_uk_version_id_image_option
+        unique (version_id, image_option)
+);
+
+-- objects referenced by each dataset version.
+-- reference count of an object is the number of versions referencing its url.
+create table dataset_version_object
+(
+    id bigint auto_increment
+        primary key,
+    version_id bigint not null,
+    url varchar(1024) not null,
+    -- utf8mb4 url is too long for the unique key, so the key is of its hash
+    url_hash binary(32) as (unhex(sha2(url, 256))) stored,
+    size bigint default 0 not null,
+    user_id bigint null comment 'user who derived the object from the version, null if uploaded as the version',
+    create_time datetime default current_timestamp() not null,
+    constraint dataset_version_object_uk_version_id_url_hash
+        unique (version_id, url_hash)
+);
+
+create index dataset_version_object__index_url
+    on dataset_version_object (url(768));
+
+-- datasets shared with users or teams.
+-- exactly one of user_id and team_id is not null.
+create table dataset_acl
+(
+    id bigint auto_increment
+        primary key,
+    dataset_id bigint not null,
+    user_id bigint null,
+    team_id bigint null,
+    permission varchar(10) not null comment 'READ, TRAIN',
+    create_time datetime default current_timestamp() not null,
+    update_time datetime default current_timestamp() not null on update current_timestamp(),
+    constraint dataset_acl_uk_dataset_id_user_id
+        unique (dataset_id, user_id),
+    constraint dataset_acl_uk_dataset_id_team_id
+        unique (dataset_id, team_id)
+);
+
+create index dataset_acl__index_user_id
+    on dataset_acl (user_id);
+
+create index dataset_acl__index_team_id
+    on dataset_acl (team_id);
@@ -7,26 +7,33 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"nns_back/cloud"
 	"nns_back/log"
+	"nns_back/quota"
 	"nns_back/repository"
 	"nns_back/util"
+	"strconv"
 	"time"
 	"unicode/utf8"
 )
 
 type handler struct {
 	userRepository    repository.UserRepository
+	teamRepository    repository.TeamRepository
 	datasetRepository Repository
+	quotaRepository   quota.Repository
 	awsS3Client       *cloud.AwsS3Client
 	httpClient        *http.Client
 }
 
-func NewDatasetHandler(userRepository repository.UserRepository, datasetRepository Repository, awsS3Client *cloud.AwsS3Client, httpClient *http.Client) *handler {
+func NewDatasetHandler(userRepository repository.UserRepository, teamRepository repository.TeamRepository, datasetRepository Repository, quotaRepository quota.Repository, awsS3Client *cloud.AwsS3Client, httpClient *http.Client) *handler {
 	return &handler{
 		userRepository:    userRepository,
+		teamRepository:    teamRepository,
 		datasetRepository: datasetRepository,
+		quotaRepository:   quotaRepository,
 		awsS3Client:       awsS3Client,
 		httpClient:        httpClient,
 	}
@@ -36,22 +43,52 @@ const _uploadDatasetFormFileKey = "dataset"
 
 const _requestBodyTooLarge = "http: request body too large"
 
+// _maxUploadSize is the maximum size of an uploaded dataset file, and of the decompressed content of the file.
+const _maxUploadSize = 1000 << 20
+
 const _defaultDatasetThumbnailUrl = "https://s3.ap-northeast-2.amazonaws.com/image.nns/NNS_logo_color.png"
 
-func (h *handler) UploadFile(w http.ResponseWriter, r *http.Request) {
-	// maximum upload of 10 MB files
-	const maxSize = 1000 << 20
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+// formFile reads the uploaded dataset file. It writes an error response and returns false on failure.
+func formFile(w http.ResponseWriter, r *http.Request) (multipart.File, *multipart.FileHeader, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, _maxUploadSize)
 
-	file, _, err := r.FormFile(_uploadDatasetFormFileKey)
+	file, header, err := r.FormFile(_uploadDatasetFormFileKey)
 	if err != nil {
 		// requires handling on big file input
 		if err.Error() == _requestBodyTooLarge {
 			util.WriteError(w, http.StatusBadRequest, util.ErrFileTooLarge)
-			return
+			return nil, nil, false
 		}
 		log.Error(err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return nil, nil, false
+	}
+
+	return file, header, true
+}
+
+// reserveQuota stores size more bytes for the user by store if the user's quota allows.
+// It writes an error response and returns false if not, or if store fails.
+func (h *handler) reserveQuota(w http.ResponseWriter, userId int64, size int64, store func() error) bool {
+	if err := quota.Reserve(h.quotaRepository, userId, size, 0, store); err != nil {
+		if err == quota.ErrQuotaExceeded {
+			log.Warnw("storage quota exceeded",
+				"userId", userId,
+				"size", size)
+			util.WriteError(w, http.StatusForbidden, util.ErrStorageQuotaExceeded)
+			return false
+		}
+		log.Errorf("failed to store within storage quota: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+func (h *handler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	file, header, ok := formFile(w, r)
+	if !ok {
 		return
 	}
 
@@ -62,21 +99,99 @@ func (h *handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// find last dataset_no
-	lastDatasetNo, err := h.datasetRepository.FindNextDatasetNo(userID)
+	var newDataset Dataset
+	var newVersion Version
+	ok = h.reserveQuota(w, userID, header.Size, func() error {
+		var err error
+		newDataset, newVersion, err = h.insertNewDataset(userID, header.Size)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	go uploadAsync(h.awsS3Client, file, h.datasetRepository, newDataset, newVersion)
+
+	util.WriteJson(w, http.StatusCreated, util.ResponseBody{"id": newDataset.ID})
+}
+
+// UploadNewVersion uploads a new file of an existing dataset as its new version.
+// Trains and dataset configs pinned to previous versions keep using them.
+func (h *handler) UploadNewVersion(w http.ResponseWriter, r *http.Request) {
+	datasetId, err := util.Atoi64(mux.Vars(r)["datasetId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	userID, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorf("failed to get userId")
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	ds, err := h.datasetRepository.FindByID(datasetId)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			lastDatasetNo = 0
-		} else {
-			log.Errorf("failed to select dataset: %v", err)
-			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			log.Warnw("dataset not exist",
+				"id", datasetId)
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
 			return
 		}
+
+		log.Errorf("failed to find dataset: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if ds.UserID != userID {
+		// inaccessible object
+		log.Warnw("inaccessible dataset id",
+			"id", datasetId,
+			"userid", userID)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+		return
+	}
+
+	if ds.Status != EXIST {
+		util.WriteError(w, http.StatusBadRequest, util.ErrDatasetUploadNotComplete)
+		return
+	}
+
+	file, header, ok := formFile(w, r)
+	if !ok {
+		return
+	}
+
+	var newVersion Version
+	ok = h.reserveQuota(w, userID, header.Size, func() error {
+		newVersion, err = h.insertNewVersion(ds.ID, header.Size)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	go uploadAsync(h.awsS3Client, file, h.datasetRepository, ds, newVersion)
+
+	util.WriteJson(w, http.StatusCreated, util.ResponseBody{"id": newVersion.ID})
+}
+
+// insertNewDataset inserts a new dataset of the user and its first version, both uploading.
+func (h *handler) insertNewDataset(userId int64, size int64) (Dataset, Version, error) {
+	// find last dataset_no
+	lastDatasetNo, err := h.datasetRepository.FindNextDatasetNo(userId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return Dataset{}, Version{}, errors.Wrap(err, "failed to select dataset")
+		}
+		lastDatasetNo = 0
 	}
 
 	newDataset := Dataset{
 		ID:          0,
-		UserID:      userID,
+		UserID:      userId,
 		DatasetNo:   lastDatasetNo + 1,
 		URL:         sql.NullString{},
 		OriginURL:   sql.NullString{},
@@ -86,20 +201,114 @@ func (h *handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		Status:      UPLOADING,
 		ImageId:     sql.NullInt64{},
 		Kind:        KindUnknown,
+		Size:        size,
 		CreateTime:  time.Now(),
 		UpdateTime:  time.Now(),
 	}
 
 	newDataset.ID, err = h.datasetRepository.Insert(newDataset)
 	if err != nil {
-		log.Errorf("failed to insert new dataset: %v", err)
+		return Dataset{}, Version{}, errors.Wrap(err, "failed to insert new dataset")
+	}
+
+	newVersion, err := h.insertNewVersion(newDataset.ID, size)
+	if err != nil {
+		return Dataset{}, Version{}, errors.Wrap(err, "failed to insert new dataset version")
+	}
+
+	return newDataset, newVersion, nil
+}
+
+func (h *handler) insertNewVersion(datasetId int64, size int64) (Version, error) {
+	newVersion := Version{
+		DatasetID:  datasetId,
+		Kind:       KindUnknown,
+		Size:       size,
+		Status:     UPLOADING,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}
+
+	var err error
+	newVersion.ID, err = h.datasetRepository.InsertVersion(newVersion)
+	return newVersion, err
+}
+
+type VersionDto struct {
+	Id          int64     `json:"id"`
+	VersionNo   int64     `json:"versionNo"`
+	Kind        Kind      `json:"kind"`
+	Size        int64     `json:"size"`
+	IsUploading bool      `json:"isUploading"`
+	IsFailed    bool      `json:"isFailed"`
+	CreateTime  time.Time `json:"createTime"`
+}
+
+type GetVersionListResponseBody struct {
+	Versions []VersionDto `json:"versions"`
+}
+
+func (h *handler) GetVersionList(w http.ResponseWriter, r *http.Request) {
+	datasetId, err := util.Atoi64(mux.Vars(r)["datasetId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	userID, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorf("failed to get userId")
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
 
-	go uploadAsync(h.awsS3Client, file, h.datasetRepository, newDataset)
+	ds, err := h.datasetRepository.FindByID(datasetId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+			return
+		}
 
-	util.WriteJson(w, http.StatusCreated, util.ResponseBody{"id": newDataset.ID})
+		log.Errorf("failed to find dataset: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	accessible, err := IsAccessible(h.datasetRepository, ds, userID)
+	if err != nil {
+		log.Errorf("failed to find dataset permission: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !accessible {
+		log.Warnw("inaccessible dataset id",
+			"id", datasetId,
+			"userid", userID)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+		return
+	}
+
+	versions, err := h.datasetRepository.FindVersionsByDatasetId(ds.ID)
+	if err != nil {
+		log.Errorf("failed to find dataset versions: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	resp := GetVersionListResponseBody{Versions: make([]VersionDto, 0, len(versions))}
+	for _, version := range versions {
+		resp.Versions = append(resp.Versions, VersionDto{
+			Id:          version.ID,
+			VersionNo:   version.VersionNo,
+			Kind:        version.Kind,
+			Size:        version.Size,
+			IsUploading: version.Status == UPLOADING,
+			IsFailed:    version.Status == FAILED,
+			CreateTime:  version.CreateTime,
+		})
+	}
+
+	util.WriteJson(w, http.StatusOK, resp)
 }
 
 type UpdateFileConfigRequestBody struct {
@@ -108,6 +317,7 @@ type UpdateFileConfigRequestBody struct {
 	Description string    `json:"description"`
 	Public      bool      `json:"public"`
 	Thumbnail   Thumbnail `json:"thumbnail"`
+	Tags        []string  `json:"tags"` // tags are kept if nil
 }
 
 func (u *UpdateFileConfigRequestBody) Validate() error {
@@ -119,6 +329,14 @@ func (u *UpdateFileConfigRequestBody) Validate() error {
 		return fmt.Errorf("dataset description too long")
 	}
 
+	if u.Tags != nil {
+		tags, err := normalizeTags(u.Tags)
+		if err != nil {
+			return err
+		}
+		u.Tags = tags
+	}
+
 	return nil
 }
 
@@ -179,6 +397,14 @@ func (h *handler) UpdateFileConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if body.Tags != nil {
+		if err := h.datasetRepository.ReplaceTags(dataset.ID, body.Tags); err != nil {
+			log.Errorf("failed to replace dataset tags: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+	}
+
 	_, err = h.datasetRepository.FindDatasetFromDatasetLibraryByDatasetId(userID, dataset.ID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Errorf("failed to FindDatasetFromDatasetLibraryByDatasetId(): %v", err)
@@ -217,6 +443,11 @@ type DatasetDto struct {
 	Kind        Kind      `json:"kind"`
 	IsUploading bool      `json:"isUploading"`
 	UserName    string    `json:"userName"`
+
+	// catalog only
+	Tags         []string `json:"tags,omitempty"`
+	Size         int64    `json:"size,omitempty"`
+	LibraryCount int64    `json:"libraryCount,omitempty"`
 }
 
 type Thumbnail struct {
@@ -225,13 +456,60 @@ type Thumbnail struct {
 	Url     string `json:"url"`
 }
 
+// catalog query parameter keys
 const (
-	_createrName     = "createrName"
-	_createrNameLike = "createrNameLike"
-	_title           = "title"
-	_titleLike       = "titleLike"
+	_catalogSearchQueryKey = "search"
+	_catalogKindQueryKey   = "kind"
+	_catalogOwnerQueryKey  = "owner"
+	_catalogTagQueryKey    = "tag"
+	_catalogSortQueryKey   = "sort"
+	_catalogSharedQueryKey = "shared"
 )
 
+// catalogQueryFromRequest parses the catalog query parameters.
+// e.g. ?search=mnist&kind=IMAGES&owner=kim&tag=digit&tag=vision&sort=popular
+func catalogQueryFromRequest(r *http.Request) (CatalogQuery, error) {
+	values := r.URL.Query()
+	query := CatalogQuery{
+		Search: values.Get(_catalogSearchQueryKey),
+		Owner:  values.Get(_catalogOwnerQueryKey),
+	}
+
+	switch kind := Kind(values.Get(_catalogKindQueryKey)); kind {
+	case "":
+	case KindImages, KindText:
+		query.Kind = kind
+	default:
+		return CatalogQuery{}, fmt.Errorf("invalid kind: %s", kind)
+	}
+
+	switch sort := values.Get(_catalogSortQueryKey); sort {
+	case "", "newest":
+		query.Sort = SortByNewest
+	case "popular":
+		query.Sort = SortByPopularity
+	case "size":
+		query.Sort = SortBySize
+	default:
+		return CatalogQuery{}, fmt.Errorf("invalid sort: %s", sort)
+	}
+
+	tags, err := normalizeTags(values[_catalogTagQueryKey])
+	if err != nil {
+		return CatalogQuery{}, err
+	}
+	query.Tags = tags
+
+	if v := values.Get(_catalogSharedQueryKey); v != "" {
+		query.Shared, err = strconv.ParseBool(v)
+		if err != nil {
+			return CatalogQuery{}, errors.Wrap(err, "invalid shared")
+		}
+	}
+
+	return query, nil
+}
+
 func (h *handler) GetList(w http.ResponseWriter, r *http.Request) {
 	userId, ok := r.Context().Value("userId").(int64)
 	if !ok {
@@ -240,27 +518,16 @@ func (h *handler) GetList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	searchType := r.URL.Query().Get("searchType")
-	//searchContent := r.URL.Query().Get("searchContent")
-
-	var (
-		count    int64
-		datasets []Dataset
-		err      error
-	)
-
-	switch searchType {
-	//case _createrName:
-	//	count, err = h.datasetRepository.CountPublicByUserName(searchContent)
-	//case _createrNameLike:
-	//	count, err = h.datasetRepository.CountPublicByUserNameLike(searchContent)
-	//case _title:
-	//	count, err = h.datasetRepository.CountPublicByTitle(searchContent)
-	//case _titleLike:
-	//	count, err = h.datasetRepository.CountPublicByTitleLike(searchContent)
-	default:
-		count, err = h.datasetRepository.CountPublic(userId)
+	query, err := catalogQueryFromRequest(r)
+	if err != nil {
+		log.Warnw("invalid catalog query",
+			"error", err,
+			"query", r.URL.RawQuery)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidQueryParm)
+		return
 	}
+
+	count, err := h.datasetRepository.CountPublicBy(userId, query)
 	if err != nil {
 		log.Errorf("failed to count dataset: %v", err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
@@ -269,24 +536,24 @@ func (h *handler) GetList(w http.ResponseWriter, r *http.Request) {
 
 	pagination := util.NewPaginationFromRequest(r, count)
 
-	switch searchType {
-	//case _createrName:
-	//	datasets, err = h.datasetRepository.FindAllPublicByUserName(userId, searchContent, pagination.Offset(), pagination.Limit())
-	//case _createrNameLike:
-	//	datasets, err = h.datasetRepository.FindAllPublicByUserNameLike(userId, searchContent, pagination.Offset(), pagination.Limit())
-	//case _title:
-	//	datasets, err = h.datasetRepository.FindAllPublicByTitle(userId, searchContent, pagination.Offset(), pagination.Limit())
-	//case _titleLike:
-	//	datasets, err = h.datasetRepository.FindAllPublicByTitleLike(userId, searchContent, pagination.Offset(), pagination.Limit())
-	default:
-		datasets, err = h.datasetRepository.FindAllPublic(userId, pagination.Offset(), pagination.Limit())
-	}
+	datasets, err := h.datasetRepository.FindAllPublicBy(userId, query, pagination.Offset(), pagination.Limit())
 	if err != nil {
 		log.Errorf("failed to find dataset list: %v", err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
 
+	datasetIds := make([]int64, 0, len(datasets))
+	for _, ds := range datasets {
+		datasetIds = append(datasetIds, ds.ID)
+	}
+	tags, err := h.datasetRepository.FindTagsByDatasetIds(datasetIds)
+	if err != nil {
+		log.Errorf("failed to find dataset tags: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
 	// make response body
 	responseDatasetDtos := make([]DatasetDto, 0, len(datasets))
 	for _, val := range datasets {
@@ -313,9 +580,16 @@ func (h *handler) GetList(w http.ResponseWriter, r *http.Request) {
 				ImageId: val.ImageId.Int64,
 				Url:     val.ThumbnailUrl.String,
 			},
-			Kind:        val.Kind,
-			IsUploading: val.Status != EXIST,
-			UserName:    user.Name,
+			Kind:         val.Kind,
+			IsUploading:  val.Status != EXIST,
+			UserName:     user.Name,
+			Tags:         tags[val.ID],
+			Size:         val.Size,
+			LibraryCount: val.LibraryCount.Int64,
+		}
+
+		if responseDatasetDto.Tags == nil {
+			responseDatasetDto.Tags = []string{}
 		}
 
 		if !responseDatasetDto.Thumbnail.Valid {
@@ -333,6 +607,12 @@ func (h *handler) GetList(w http.ResponseWriter, r *http.Request) {
 	util.WriteJson(w, http.StatusOK, response)
 }
 
+// _forceQueryKey confirms deleting a dataset still used by dataset configs.
+const _forceQueryKey = "force"
+
+// DeleteDataset deletes the dataset of the user.
+// It fails with 409 if active dataset configs use the dataset, unless force=true.
+// The dataset configs are flagged invalid then, and the affected projects are returned.
 func (h *handler) DeleteDataset(w http.ResponseWriter, r *http.Request) {
 	userId, ok := r.Context().Value("userId").(int64)
 	if !ok {
@@ -366,14 +646,76 @@ func (h *handler) DeleteDataset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	force := false
+	if v := r.URL.Query().Get(_forceQueryKey); v != "" {
+		force, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Warnw("invalid force query parameter",
+				"input value", v)
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidQueryParm)
+			return
+		}
+	}
+
+	// configs using the dataset can't train anymore, so deleting it must be confirmed
+	if !force {
+		activeConfigs, err := h.datasetRepository.CountActiveDatasetConfigs(datasetId)
+		if err != nil {
+			log.Errorf("failed to CountActiveDatasetConfigs(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+		if activeConfigs > 0 {
+			log.Warnw("dataset in use",
+				"id", datasetId,
+				"activeConfigs", activeConfigs)
+			util.WriteError(w, http.StatusConflict, util.ErrDatasetInUse, util.KeyValue("activeConfigs", activeConfigs))
+			return
+		}
+	}
+
 	// delete dataset
-	if err := h.datasetRepository.Delete(datasetId); err != nil {
+	result, err := h.datasetRepository.Delete(datasetId)
+	if err != nil {
 		log.Errorf("failed to delete dataset: %v", err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// objects no longer referenced by any version
+	go deleteObjects(h.awsS3Client, h.datasetRepository, result.Released)
+
+	util.WriteJson(w, http.StatusOK, newDeleteDatasetResponseBody(userId, result.AffectedProjects))
+}
+
+type DeleteDatasetResponseBody struct {
+	AffectedProjects  []AffectedProjectDto `json:"affectedProjects"`
+	OtherUserProjects int                  `json:"otherUserProjects"` // affected projects of other users, counted only
+}
+
+type AffectedProjectDto struct {
+	ProjectNo        int     `json:"projectNo"`
+	Name             string  `json:"name"`
+	DatasetConfigIds []int64 `json:"datasetConfigIds"` // flagged invalid
+	ConfigReset      bool    `json:"configReset"`      // dataset config of the project config was reset
+}
+
+func newDeleteDatasetResponseBody(userId int64, affected []AffectedProject) DeleteDatasetResponseBody {
+	resp := DeleteDatasetResponseBody{AffectedProjects: make([]AffectedProjectDto, 0)}
+	for _, project := range affected {
+		if project.UserId != userId {
+			resp.OtherUserProjects++
+			continue
+		}
+
+		resp.AffectedProjects = append(resp.AffectedProjects, AffectedProjectDto{
+			ProjectNo:        project.ProjectNo,
+			Name:             project.Name,
+			DatasetConfigIds: project.DatasetConfigIds,
+			ConfigReset:      project.ConfigReset,
+		})
+	}
+	return resp
 }
 
 // TODO: Add author data to response body
@@ -476,7 +818,13 @@ func (h *handler) AddNewDatasetToLibrary(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if !toAddDataset.Public.Bool && toAddDataset.UserID != userId {
+	accessible, err := IsAccessible(h.datasetRepository, toAddDataset, userId)
+	if err != nil {
+		log.Errorf("failed to find dataset permission: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !accessible {
 		// this dataset is inaccessible
 		log.Warnw("invalid datasetId",
 			"requested datasetId", body.DatasetId)
@@ -550,6 +898,8 @@ type DatasetDetailDto struct {
 	Feature    []string   `json:"feature"`
 	Rows       [][]string `json:"rows"`
 	Kind       Kind       `json:"kind"`
+	Profile    *Profile   `json:"profile"`
+	Tags       []string   `json:"tags"`
 }
 
 func (h *handler) GetDatasetDetail(w http.ResponseWriter, r *http.Request) {
@@ -577,9 +927,23 @@ func (h *handler) GetDatasetDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the dataset stays in the library after it is made private or its access is revoked
+	accessible, err := IsAccessible(h.datasetRepository, ds, userId)
+	if err != nil {
+		log.Errorf("failed to find dataset permission: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !accessible {
+		log.Warnw("inaccessible datasetId",
+			"requested datasetId", datasetId)
+		util.WriteError(w, http.StatusBadRequest, util.ErrNotFound)
+		return
+	}
+
 	// 아직 업로드 완료되지 않은 데이터셋을 미리보기하려하면 다른 응답 내려줌
 	if ds.Status != EXIST {
-		util.WriteError(w, http.StatusBadRequest, "Dataset upload not complete yet")
+		util.WriteError(w, http.StatusBadRequest, util.ErrDatasetUploadNotComplete)
 		return
 	}
 
@@ -608,6 +972,27 @@ func (h *handler) GetDatasetDetail(w http.ResponseWriter, r *http.Request) {
 		Rows:       records[1:],
 		Kind:       ds.Kind,
 	}
+
+	tags, err := h.datasetRepository.FindTagsByDatasetIds([]int64{ds.ID})
+	if err != nil {
+		log.Errorf("failed to find dataset tags: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	responseBody.Tags = tags[ds.ID]
+	if responseBody.Tags == nil {
+		responseBody.Tags = []string{}
+	}
+
+	// datasets uploaded before profiling was introduced have no profile
+	if profile, err := ds.DecodeProfile(); err == nil {
+		responseBody.Profile = &profile
+	} else if err != ErrProfileNotExist {
+		log.Errorw("failed to decode dataset profile",
+			"error", err,
+			"dataset.id", ds.ID)
+	}
+
 	util.WriteJson(w, http.StatusOK, responseBody)
 }
 
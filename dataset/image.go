@@ -0,0 +1,454 @@
+package dataset
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"nns_back/cloud"
+	"path"
+	"strings"
+)
+
+type ColorMode string
+
+const (
+	ColorModeGrayscale ColorMode = "GRAYSCALE"
+	ColorModeRGB       ColorMode = "RGB"
+	ColorModeRGBA      ColorMode = "RGBA"
+)
+
+type ImageFormat string
+
+const (
+	ImageFormatJpeg ImageFormat = "JPEG"
+	ImageFormatPng  ImageFormat = "PNG"
+)
+
+const _maxImageSize = 4096
+
+// ImageProfile is the decoded information of an image in an image dataset.
+type ImageProfile struct {
+	Url       string    `json:"url"`
+	Label     string    `json:"label"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	ColorMode ColorMode `json:"colorMode"`
+}
+
+// ImageSummary is the statistics of the images of an image dataset.
+// It is stored in the profile instead of each image, so that the profile doesn't grow with the dataset.
+type ImageSummary struct {
+	Count        int64               `json:"count"`
+	MinWidth     int                 `json:"minWidth"`
+	MaxWidth     int                 `json:"maxWidth"`
+	MinHeight    int                 `json:"minHeight"`
+	MaxHeight    int                 `json:"maxHeight"`
+	ColorModes   map[ColorMode]int64 `json:"colorModes"`
+	SkippedCount int64               `json:"skippedCount"`
+}
+
+// summarizeImages returns the statistics of the images and the number of the skipped files.
+func summarizeImages(images []ImageProfile, skipped []SkippedFile) *ImageSummary {
+	summary := &ImageSummary{
+		Count:        int64(len(images)),
+		ColorModes:   make(map[ColorMode]int64),
+		SkippedCount: int64(len(skipped)),
+	}
+	for i, image := range images {
+		if i == 0 || image.Width < summary.MinWidth {
+			summary.MinWidth = image.Width
+		}
+		if i == 0 || image.Width > summary.MaxWidth {
+			summary.MaxWidth = image.Width
+		}
+		if i == 0 || image.Height < summary.MinHeight {
+			summary.MinHeight = image.Height
+		}
+		if i == 0 || image.Height > summary.MaxHeight {
+			summary.MaxHeight = image.Height
+		}
+		summary.ColorModes[image.ColorMode]++
+	}
+	return summary
+}
+
+// SkippedFile is a file in an image archive which is not included in the dataset.
+type SkippedFile struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ImageOption is how images of an image dataset are normalized before training.
+// Zero value fields keep the original value.
+type ImageOption struct {
+	Width     int
+	Height    int
+	ColorMode ColorMode
+	Format    ImageFormat
+}
+
+var ErrInvalidImageOption = errors.New("invalid image option")
+
+// key identifies the option among the normalizations of a dataset version.
+func (o ImageOption) key() string {
+	return fmt.Sprintf("%dx%d/%s/%s", o.Width, o.Height, o.ColorMode, o.Format)
+}
+
+func (o ImageOption) Validate() error {
+	if o.Width < 0 || o.Height < 0 || o.Width > _maxImageSize || o.Height > _maxImageSize {
+		return ErrInvalidImageOption
+	}
+
+	// resize needs both width and height
+	if (o.Width == 0) != (o.Height == 0) {
+		return ErrInvalidImageOption
+	}
+
+	switch o.ColorMode {
+	case "", ColorModeGrayscale, ColorModeRGB, ColorModeRGBA:
+	default:
+		return ErrInvalidImageOption
+	}
+
+	switch o.Format {
+	case "", ImageFormatPng:
+	case ImageFormatJpeg:
+		// jpeg has no alpha channel
+		if o.ColorMode == ColorModeRGBA {
+			return ErrInvalidImageOption
+		}
+	default:
+		return ErrInvalidImageOption
+	}
+
+	return nil
+}
+
+// imageCsv is the parsed csv of an image archive.
+// It carries the report of each image as well.
+type imageCsv struct {
+	*bytes.Buffer
+	images  []ImageProfile
+	skipped []SkippedFile
+}
+
+// isJunkFile reports whether the file is a metadata file created by an OS or an archiver,
+// not a part of the dataset.
+func isJunkFile(name string) bool {
+	for _, dir := range strings.Split(path.Dir(name), "/") {
+		if dir == "__MACOSX" {
+			return true
+		}
+	}
+
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".") {
+		// .DS_Store, ._AppleDouble
+		return true
+	}
+
+	switch strings.ToLower(base) {
+	case "thumbs.db", "desktop.ini":
+		return true
+	}
+
+	return false
+}
+
+// decodeImage decodes and validates an image.
+// Only jpeg and png are supported.
+func decodeImage(data []byte) (image.Image, ImageFormat, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case "jpeg":
+		return img, ImageFormatJpeg, nil
+	case "png":
+		return img, ImageFormatPng, nil
+	default:
+		return nil, "", ErrUnSupportedContentType{contentType: format}
+	}
+}
+
+func colorModeOf(img image.Image) ColorMode {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return ColorModeGrayscale
+	}
+
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return ColorModeRGB
+	}
+
+	switch img.ColorModel() {
+	case color.YCbCrModel, color.CMYKModel:
+		return ColorModeRGB
+	}
+
+	return ColorModeRGBA
+}
+
+// normalizeImage resizes img and converts its color mode.
+func normalizeImage(img image.Image, option ImageOption) image.Image {
+	if option.Width > 0 && option.Height > 0 {
+		img = resize(img, option.Width, option.Height)
+	}
+
+	bounds := img.Bounds()
+	switch option.ColorMode {
+	case ColorModeGrayscale:
+		dst := image.NewGray(bounds)
+		draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+		img = dst
+	case ColorModeRGB:
+		// flatten transparent pixels on a white background
+		dst := image.NewRGBA(bounds)
+		draw.Draw(dst, bounds, image.White, image.Point{}, draw.Src)
+		draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+		img = dst
+	case ColorModeRGBA:
+		dst := image.NewNRGBA(bounds)
+		draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+		img = dst
+	}
+
+	return img
+}
+
+// resize scales img to width x height with bilinear interpolation.
+func resize(img image.Image, width, height int) image.Image {
+	src := image.NewNRGBA64(img.Bounds())
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	if srcWidth == 0 || srcHeight == 0 {
+		return dst
+	}
+
+	scaleX := float64(srcWidth) / float64(width)
+	scaleY := float64(srcHeight) / float64(height)
+
+	for y := 0; y < height; y++ {
+		fy := math.Max((float64(y)+0.5)*scaleY-0.5, 0)
+		y0 := int(fy)
+		y1 := minInt(y0+1, srcHeight-1)
+		dy := fy - float64(y0)
+
+		for x := 0; x < width; x++ {
+			fx := math.Max((float64(x)+0.5)*scaleX-0.5, 0)
+			x0 := int(fx)
+			x1 := minInt(x0+1, srcWidth-1)
+			dx := fx - float64(x0)
+
+			c00 := src.NRGBA64At(x0, y0)
+			c10 := src.NRGBA64At(x1, y0)
+			c01 := src.NRGBA64At(x0, y1)
+			c11 := src.NRGBA64At(x1, y1)
+
+			lerp := func(v00, v10, v01, v11 uint16) uint16 {
+				top := float64(v00)*(1-dx) + float64(v10)*dx
+				bottom := float64(v01)*(1-dx) + float64(v11)*dx
+				return uint16(math.Round(top*(1-dy) + bottom*dy))
+			}
+
+			dst.SetNRGBA64(x, y, color.NRGBA64{
+				R: lerp(c00.R, c10.R, c01.R, c11.R),
+				G: lerp(c00.G, c10.G, c01.G, c11.G),
+				B: lerp(c00.B, c10.B, c01.B, c11.B),
+				A: lerp(c00.A, c10.A, c01.A, c11.A),
+			})
+		}
+	}
+
+	return dst
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func encodeImage(img image.Image, format ImageFormat) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var err error
+	switch format {
+	case ImageFormatJpeg:
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 95})
+	case ImageFormatPng:
+		err = png.Encode(buf, img)
+	default:
+		err = ErrUnSupportedContentType{contentType: string(format)}
+	}
+
+	return buf.Bytes(), err
+}
+
+func contentTypeOf(format ImageFormat) (contentType, extension string) {
+	if format == ImageFormatJpeg {
+		return _jpeg, "jpg"
+	}
+	return _png, "png"
+}
+
+// NormalizeImagesToStorage downloads the parsed image dataset csv at url,
+// normalizes every image with option and uploads the normalized images and csv to storage.
+// It returns the url of the normalized csv.
+func NormalizeImagesToStorage(httpClient *http.Client, storage cloud.AwsS3Uploader, url string, option ImageOption) (string, error) {
+	if err := option.Validate(); err != nil {
+		return "", err
+	}
+
+	records, err := downloadRecords(httpClient, url)
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", errors.New("empty dataset")
+	}
+
+	urlIndex := indexOf(records[0], _imageDatasetUrlColumn)
+	if urlIndex < 0 {
+		return "", fmt.Errorf("image dataset has no %s column", _imageDatasetUrlColumn)
+	}
+
+	normalized := make([][]string, 0, len(records))
+	normalized = append(normalized, records[0])
+	for _, record := range records[1:] {
+		imageUrl, err := normalizeImageToStorage(httpClient, storage, record[urlIndex], option)
+		if err != nil {
+			return "", err
+		}
+
+		row := append([]string(nil), record...)
+		row[urlIndex] = imageUrl
+		normalized = append(normalized, row)
+	}
+
+	return uploadRecords(storage, normalized)
+}
+
+// NormalizeVersionToStorage normalizes the parsed image dataset at url like NormalizeImagesToStorage,
+// reusing the normalized dataset of the same version and option since a version never changes.
+// The normalized objects are objects of the version derived for the user, deleted with the version.
+// A dataset without versions is normalized every time.
+func NormalizeVersionToStorage(repo Repository, httpClient *http.Client, storage cloud.AwsS3Uploader, versionId sql.NullInt64, userId int64, url string, option ImageOption) (string, error) {
+	if !versionId.Valid {
+		return NormalizeImagesToStorage(httpClient, storage, url, option)
+	}
+
+	normalizedUrl, err := repo.FindNormalizedUrl(versionId.Int64, option.key())
+	if err == nil {
+		return normalizedUrl, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", errors.Wrapf(err, "FindNormalizedUrl(versionId: %d)", versionId.Int64)
+	}
+
+	normalizedUrl, err = NormalizeImagesToStorage(httpClient, NewVersionUploader(storage, repo, versionId, userId), url, option)
+	if err != nil {
+		return "", err
+	}
+
+	if err := repo.InsertNormalizedUrl(versionId.Int64, option.key(), normalizedUrl); err != nil {
+		return "", errors.Wrapf(err, "InsertNormalizedUrl(versionId: %d)", versionId.Int64)
+	}
+
+	return normalizedUrl, nil
+}
+
+func normalizeImageToStorage(httpClient *http.Client, storage cloud.AwsS3Uploader, url string, option ImageOption) (string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", errors.Wrapf(err, "Get(url: %s)", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get image: response status code : %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decode image(url: %s)", url)
+	}
+
+	if option.Format != "" {
+		format = option.Format
+	}
+
+	encoded, err := encodeImage(normalizeImage(img, option), format)
+	if err != nil {
+		return "", err
+	}
+
+	contentType, extension := contentTypeOf(format)
+	return storage.UploadBytes(encoded, cloud.WithContentType(contentType), cloud.WithExtension(extension))
+}
+
+// ImageUrls reads the csv at url and returns the image urls listed in it
+// if it is an image dataset csv, or nil otherwise.
+// Only the header is read from other csv files.
+func ImageUrls(httpClient *http.Client, url string) ([]string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Get(url: %s)", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get dataset: response status code : %d", resp.StatusCode)
+	}
+
+	return readImageUrls(resp.Body)
+}
+
+func readImageUrls(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read csv")
+	}
+	if len(header) != 2 || header[0] != _imageDatasetUrlColumn || header[1] != _imageDatasetLabelColumn {
+		return nil, nil
+	}
+
+	urls := make([]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read csv")
+		}
+		urls = append(urls, record[0])
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,283 @@
+package dataset
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zapcore"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"nns_back/cloud"
+	"nns_back/log"
+	"strings"
+	"testing"
+)
+
+func Test_isJunkFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "cat/1.png", want: false},
+		{name: "1.jpg", want: false},
+		{name: "cat/.DS_Store", want: true},
+		{name: ".DS_Store", want: true},
+		{name: "__MACOSX/cat/._1.png", want: true},
+		{name: "dog/Thumbs.db", want: true},
+		{name: "dog/desktop.ini", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isJunkFile(tt.name))
+		})
+	}
+}
+
+func TestImageOption_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  ImageOption
+		wantErr bool
+	}{
+		{name: "resize", option: ImageOption{Width: 28, Height: 28}},
+		{name: "convert", option: ImageOption{ColorMode: ColorModeGrayscale, Format: ImageFormatJpeg}},
+		{name: "width only", option: ImageOption{Width: 28}, wantErr: true},
+		{name: "too large", option: ImageOption{Width: 10000, Height: 10000}, wantErr: true},
+		{name: "unknown color mode", option: ImageOption{ColorMode: "CMYK"}, wantErr: true},
+		{name: "unknown format", option: ImageOption{Format: "GIF"}, wantErr: true},
+		{name: "jpeg with alpha", option: ImageOption{ColorMode: ColorModeRGBA, Format: ImageFormatJpeg}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.option.Validate() != nil)
+		})
+	}
+}
+
+func newTestImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 10), G: uint8(y * 10), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+func Test_normalizeImage(t *testing.T) {
+	assert := assert.New(t)
+
+	img := newTestImage(8, 4)
+	assert.Equal(ColorModeRGB, colorModeOf(img))
+
+	resized := normalizeImage(img, ImageOption{Width: 4, Height: 2})
+	assert.Equal(4, resized.Bounds().Dx())
+	assert.Equal(2, resized.Bounds().Dy())
+
+	gray := normalizeImage(img, ImageOption{ColorMode: ColorModeGrayscale})
+	assert.Equal(ColorModeGrayscale, colorModeOf(gray))
+	assert.Equal(img.Bounds(), gray.Bounds())
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	assert.Equal(ColorModeRGBA, colorModeOf(transparent))
+	assert.Equal(ColorModeRGB, colorModeOf(normalizeImage(transparent, ImageOption{ColorMode: ColorModeRGB})))
+}
+
+func Test_imagesToCsv_report(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+	assert := assert.New(t)
+
+	valid, err := ioutil.ReadFile("testdata/zip/train/original_1.png")
+	assert.NoError(err)
+
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+	for name, data := range map[string][]byte{
+		"cat/1.png":            valid,
+		"cat/.DS_Store":        []byte("junk"),
+		"__MACOSX/cat/._1.png": []byte("junk"),
+		"dog/Thumbs.db":        []byte("junk"),
+		"dog/broken.png":       valid[:len(valid)/2],
+		"dog/readme.txt":       []byte("hello"),
+	} {
+		w, err := zipWriter.Create(name)
+		assert.NoError(err)
+		_, err = w.Write(data)
+		assert.NoError(err)
+	}
+	assert.NoError(zipWriter.Close())
+
+	r, kind, err := zipToCsv(newMockStorage(), buf.Bytes())
+	assert.NoError(err)
+	assert.Equal(KindImages, kind)
+
+	parsed, ok := r.(*imageCsv)
+	assert.True(ok)
+	assert.Len(parsed.images, 1)
+	assert.Equal("cat", parsed.images[0].Label)
+	assert.NotZero(parsed.images[0].Width)
+	assert.NotZero(parsed.images[0].Height)
+	assert.Len(parsed.skipped, 5)
+
+	records, err := csv.NewReader(r).ReadAll()
+	assert.NoError(err)
+	assert.Len(records, 2)
+}
+
+func Test_imagesToCsv_noValidImage(t *testing.T) {
+	_, _, err := imagesToCsv(newMockStorage(), []labeledImage{{name: ".DS_Store", bytes: []byte("junk")}})
+	assert.Error(t, err)
+}
+
+func TestNormalizeImagesToStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	imageBuf := new(bytes.Buffer)
+	assert.NoError(png.Encode(imageBuf, newTestImage(8, 8)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/data.csv":
+			w.Write([]byte("url,label\n" + "http://" + r.Host + "/1.png,cat\n"))
+		case "/1.png":
+			w.Write(imageBuf.Bytes())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var uploaded [][]byte
+	storage := &cloud.MockAwsS3Uploader{}
+	storage.On("UploadBytes", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { uploaded = append(uploaded, args.Get(0).([]byte)) }).
+		Return("https://s3.ap-northeast-2.amazonaws.com/dataset/normalized", nil)
+
+	url, err := NormalizeImagesToStorage(server.Client(), storage, server.URL+"/data.csv",
+		ImageOption{Width: 4, Height: 4, ColorMode: ColorModeGrayscale})
+	assert.NoError(err)
+	assert.Equal("https://s3.ap-northeast-2.amazonaws.com/dataset/normalized", url)
+
+	// normalized image, normalized csv
+	if assert.Len(uploaded, 2) {
+		img, _, err := decodeImage(uploaded[0])
+		assert.NoError(err)
+		assert.Equal(4, img.Bounds().Dx())
+		assert.Equal(ColorModeGrayscale, colorModeOf(img))
+
+		assert.True(strings.HasPrefix(string(uploaded[1]), "url,label\nhttps://s3.ap-northeast-2.amazonaws.com/dataset/normalized,cat"))
+	}
+}
+
+// normalizationRepository is a Repository with in-memory normalized urls.
+type normalizationRepository struct {
+	Repository
+	normalized map[string]string // by version id and image option
+}
+
+func (r normalizationRepository) FindNormalizedUrl(versionId int64, imageOption string) (string, error) {
+	url, ok := r.normalized[fmt.Sprint(versionId, imageOption)]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return url, nil
+}
+
+func (r normalizationRepository) InsertNormalizedUrl(versionId int64, imageOption string, url string) error {
+	r.normalized[fmt.Sprint(versionId, imageOption)] = url
+	return nil
+}
+
+func TestNormalizeVersionToStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	imageBuf := new(bytes.Buffer)
+	assert.NoError(png.Encode(imageBuf, newTestImage(8, 8)))
+
+	requested := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested++
+		switch r.URL.Path {
+		case "/data.csv":
+			w.Write([]byte("url,label\n" + "http://" + r.Host + "/1.png,cat\n"))
+		case "/1.png":
+			w.Write(imageBuf.Bytes())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// uploaded with the reference of the version
+	storage := &cloud.MockAwsS3Uploader{}
+	storage.On("UploadBytes", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return("https://s3.ap-northeast-2.amazonaws.com/dataset/normalized", nil)
+
+	repo := normalizationRepository{normalized: make(map[string]string)}
+	version := sql.NullInt64{Int64: 1, Valid: true}
+	option := ImageOption{Width: 4, Height: 4, ColorMode: ColorModeGrayscale}
+
+	url, err := NormalizeVersionToStorage(repo, server.Client(), storage, version, 1, server.URL+"/data.csv", option)
+	assert.NoError(err)
+	assert.Equal("https://s3.ap-northeast-2.amazonaws.com/dataset/normalized", url)
+	assert.Equal(2, requested)
+
+	// the same version and option is not normalized again
+	url, err = NormalizeVersionToStorage(repo, server.Client(), storage, version, 1, server.URL+"/data.csv", option)
+	assert.NoError(err)
+	assert.Equal("https://s3.ap-northeast-2.amazonaws.com/dataset/normalized", url)
+	assert.Equal(2, requested)
+
+	// another option is normalized
+	_, err = NormalizeVersionToStorage(repo, server.Client(), storage, version, 1, server.URL+"/data.csv", ImageOption{ColorMode: ColorModeRGB})
+	assert.NoError(err)
+	assert.Equal(4, requested)
+}
+
+func Test_summarizeImages(t *testing.T) {
+	summary := summarizeImages([]ImageProfile{
+		{Width: 8, Height: 4, ColorMode: ColorModeRGB},
+		{Width: 2, Height: 6, ColorMode: ColorModeRGB},
+		{Width: 4, Height: 5, ColorMode: ColorModeGrayscale},
+	}, []SkippedFile{{Name: ".DS_Store"}})
+
+	assert.Equal(t, &ImageSummary{
+		Count:        3,
+		MinWidth:     2,
+		MaxWidth:     8,
+		MinHeight:    4,
+		MaxHeight:    6,
+		ColorModes:   map[ColorMode]int64{ColorModeRGB: 2, ColorModeGrayscale: 1},
+		SkippedCount: 1,
+	}, summary)
+}
+
+func Test_readImageUrls(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []string
+	}{
+		{name: "image dataset", csv: "url,label\na.png,cat\nb.png,dog\n", want: []string{"a.png", "b.png"}},
+		{name: "tabular dataset", csv: "x,y,label\n1,2,0\n", want: nil},
+		{name: "empty", csv: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readImageUrls(strings.NewReader(tt.csv))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -44,7 +44,7 @@ func TestMnistUploadJob(t *testing.T) {
 		return
 	}
 
-	url, kind, err := save(awsS3Client, file)
+	url, kind, _, _, err := save(awsS3Client, file)
 	if err != nil {
 		t.Errorf("failed to save file: %v", err)
 		return
@@ -2,6 +2,7 @@ package dataset
 
 import (
 	"database/sql"
+	"nns_back/util"
 	"time"
 )
 
@@ -19,11 +20,20 @@ type Dataset struct {
 	UpdateTime  time.Time      `db:"update_time"`
 	ImageId     sql.NullInt64  `db:"image_id"` // thumbnail image
 	Kind        Kind           `db:"kind"`     // dataset kind
+	Profile     util.NullJson  `db:"profile"`  // column schema and statistics, see Profile
+	Size        int64          `db:"size"`     // uploaded file size in bytes
 
 	// additional
 	InLibrary    sql.NullBool   `db:"in_library"`
 	Usable       sql.NullBool   `db:"usable"`
 	ThumbnailUrl sql.NullString `db:"thumbnail_url"`
+	LibraryCount sql.NullInt64  `db:"library_count"` // number of libraries containing the dataset
+}
+
+// IsAccessibleBy reports whether the user can see the dataset:
+// public datasets and the user's own datasets are accessible.
+func (d Dataset) IsAccessibleBy(userId int64) bool {
+	return d.Public.Bool || d.UserID == userId
 }
 
 type Kind string
@@ -34,6 +44,10 @@ const (
 	KindText    Kind = "TEXT"
 )
 
+// ImageDatasetLabelColumn is the label column of image datasets,
+// which is the directory name of each image in the archive.
+const ImageDatasetLabelColumn = _imageDatasetLabelColumn
+
 const (
 	maxDatasetName        = 100
 	maxDatasetDescription = 2000
@@ -47,4 +61,7 @@ const (
 	UPLOADING  = "UPLOADING"
 	UPLOADED_F = "UPLOADED_F"
 	UPLOADED_D = "UPLOADED_D"
+
+	// version only. the upload of the version failed
+	FAILED = "FAILED"
 )
\ No newline at end of file
@@ -1,7 +1,10 @@
 package dataset
 
 import (
+	"database/sql"
+	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	"nns_back/util"
 )
 
@@ -15,154 +18,55 @@ func NewMysqlRepository(db *sqlx.DB) Repository {
 	}
 }
 
-//func (m *mysqlRepository) count(builder squirrel.SelectBuilder) (int64, error) {
-//	query, args, err := builder.Columns("COUNT(ds.*)").from("dataset ds").ToSql()
-//	if err != nil {
-//		return 0, err
-//	}
-//
-//	var count int64
-//	err = m.db.QueryRowx(query, args...).Scan(&count)
-//	return count, err
-//}
-
-func (m *mysqlRepository) CountPublic(userId int64) (int64, error) {
-	var count int64
-	err := m.db.QueryRowx(`
-SELECT count(*)
-FROM dataset ds
-WHERE ds.public = TRUE
-  AND (ds.status = 'EXIST' or (ds.status != 'DELETED' and ds.user_id = ?));
-`, userId).Scan(&count)
-	return count, err
+// _catalogColumns are columns of a dataset in the catalog.
+var _catalogColumns = []string{
+	`ds.id              "id"`,
+	`ds.user_id         "user_id"`,
+	`ds.dataset_no      "dataset_no"`,
+	`ds.url             "url"`,
+	`ds.origin_url      "origin_url"`,
+	`ds.name            "name"`,
+	`ds.description     "description"`,
+	`ds.public          "public"`,
+	`ds.status          "status"`,
+	`ds.image_id        "image_id"`,
+	`ds.kind            "kind"`,
+	`ds.size            "size"`,
+	`ds.create_time     "create_time"`,
+	`ds.update_time     "update_time"`,
+	`dsl.usable         "usable"`,
+	`dsl.id IS NOT NULL "in_library"`,
+	`i.url              "thumbnail_url"`,
+	`IFNULL(dslc.library_count, 0) "library_count"`,
 }
 
-func (m *mysqlRepository) CountPublicByUserName(userName string) (int64, error) {
-	var count int64
-	err := m.db.QueryRowx(`
-SELECT count(*)
-FROM dataset ds
-         JOIN user u on ds.user_id = u.id
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND u.name = ?;
-`, userName).Scan(&count)
-	return count, err
-}
-
-func (m *mysqlRepository) CountPublicByUserNameLike(userName string) (int64, error) {
-	var count int64
-	err := m.db.QueryRowx(`
-SELECT count(*)
-FROM dataset ds
-         JOIN user u on ds.user_id = u.id
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND u.name LIKE ?;
-`, util.LikeArg(userName)).Scan(&count)
-	return count, err
-}
+func (m *mysqlRepository) CountPublicBy(userId int64, query CatalogQuery) (int64, error) {
+	stmt, args, err := query.where(squirrel.Select("COUNT(*)").From("dataset ds"), userId).ToSql()
+	if err != nil {
+		return 0, err
+	}
 
-func (m *mysqlRepository) CountPublicByTitle(title string) (int64, error) {
 	var count int64
-	err := m.db.QueryRowx(`
-SELECT count(*)
-FROM dataset ds
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND ds.name = ?;
-`, title).Scan(&count)
+	err = m.db.QueryRowx(stmt, args...).Scan(&count)
 	return count, err
 }
 
-func (m *mysqlRepository) CountPublicByTitleLike(title string) (int64, error) {
-	var count int64
-	err := m.db.QueryRowx(`
-SELECT count(*)
-FROM dataset ds
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND ds.name LIKE ?;
-`, util.LikeArg(title)).Scan(&count)
-	return count, err
-}
-
-func (m *mysqlRepository) FindAllPublic(userId int64, offset, limit int) ([]Dataset, error) {
-	rows, err := m.db.Queryx(`
-SELECT ds.id              "id",
-       ds.user_id         "user_id",
-       ds.dataset_no      "dataset_no",
-       ds.url             "url",
-       ds.origin_url      "origin_url",
-       ds.name            "name",
-       ds.description     "description",
-       ds.public          "public",
-       ds.status          "status",
-       ds.image_id        "image_id",
-       ds.kind            "kind",
-       ds.create_time     "create_time",
-       ds.update_time     "update_time",
-       dsl.usable         "usable",
-       dsl.id IS NOT NULL "in_library",
-       i.url              "thumbnail_url"
-FROM dataset ds
-         LEFT JOIN (SELECT idsl.*
-                    FROM dataset_library idsl
-                    WHERE idsl.user_id = ?) dsl on ds.id = dsl.dataset_id
-         LEFT JOIN image i on ds.image_id = i.id
-WHERE ds.public = TRUE
-  AND (ds.status = 'EXIST' or (ds.status != 'DELETED' and ds.user_id = ?))
-ORDER BY ds.id DESC
-LIMIT ?, ?;
-`, userId, userId, offset, limit)
+func (m *mysqlRepository) FindAllPublicBy(userId int64, query CatalogQuery, offset, limit int) ([]Dataset, error) {
+	builder := squirrel.Select(_catalogColumns...).
+		From("dataset ds").
+		LeftJoin("(SELECT idsl.* FROM dataset_library idsl WHERE idsl.user_id = ?) dsl on ds.id = dsl.dataset_id", userId).
+		LeftJoin("image i on ds.image_id = i.id").
+		LeftJoin("(SELECT cdsl.dataset_id, COUNT(*) library_count FROM dataset_library cdsl GROUP BY cdsl.dataset_id) dslc on ds.id = dslc.dataset_id")
+	builder = query.orderBy(query.where(builder, userId)).
+		Offset(uint64(offset)).
+		Limit(uint64(limit))
+
+	stmt, args, err := builder.ToSql()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	dsList := make([]Dataset, 0)
-	for rows.Next() {
-		ds := Dataset{}
-		if err := rows.StructScan(&ds); err != nil {
-			return nil, err
-		}
-
-		dsList = append(dsList, ds)
-	}
-
-	return dsList, nil
-}
 
-func (m *mysqlRepository) FindAllPublicByUserName(userId int64, userName string, offset, limit int) ([]Dataset, error) {
-	rows, err := m.db.Queryx(`
-SELECT ds.id              "id",
-       ds.user_id         "user_id",
-       ds.dataset_no      "dataset_no",
-       ds.url             "url",
-       ds.origin_url      "origin_url",
-       ds.name            "name",
-       ds.description     "description",
-       ds.public          "public",
-       ds.status          "status",
-       ds.image_id        "image_id",
-       ds.kind            "kind",
-       ds.create_time     "create_time",
-       ds.update_time     "update_time",
-       dsl.usable         "usable",
-       dsl.id IS NOT NULL "in_library",
-       i.url              "thumbnail_url"
-FROM dataset ds
-         LEFT JOIN (SELECT idsl.*
-                    FROM dataset_library idsl
-                    WHERE idsl.user_id = ?) dsl on ds.id = dsl.dataset_id
-         LEFT JOIN image i on ds.image_id = i.id
-         JOIN user u on ds.user_id = u.id
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND u.name = ?
-ORDER BY ds.id DESC
-LIMIT ?, ?;
-`, userId, userName, offset, limit)
+	rows, err := m.db.Queryx(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -181,146 +85,61 @@ LIMIT ?, ?;
 	return dsList, nil
 }
 
-func (m *mysqlRepository) FindAllPublicByUserNameLike(userId int64, userName string, offset, limit int) ([]Dataset, error) {
-	rows, err := m.db.Queryx(`
-SELECT ds.id              "id",
-       ds.user_id         "user_id",
-       ds.dataset_no      "dataset_no",
-       ds.url             "url",
-       ds.origin_url      "origin_url",
-       ds.name            "name",
-       ds.description     "description",
-       ds.public          "public",
-       ds.status          "status",
-       ds.image_id        "image_id",
-       ds.kind            "kind",
-       ds.create_time     "create_time",
-       ds.update_time     "update_time",
-       dsl.usable         "usable",
-       dsl.id IS NOT NULL "in_library",
-       i.url              "thumbnail_url"
-FROM dataset ds
-         LEFT JOIN (SELECT idsl.*
-                    FROM dataset_library idsl
-                    WHERE idsl.user_id = ?) dsl on ds.id = dsl.dataset_id
-         LEFT JOIN image i on ds.image_id = i.id
-         JOIN user u on ds.user_id = u.id
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND u.name LIKE ?
-ORDER BY ds.id DESC
-LIMIT ?, ?;
-`, userId, util.LikeArg(userName), offset, limit)
-	if err != nil {
-		return nil, err
+func (m *mysqlRepository) FindTagsByDatasetIds(datasetIds []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string, len(datasetIds))
+	if len(datasetIds) == 0 {
+		return tags, nil
 	}
-	defer rows.Close()
 
-	dsList := make([]Dataset, 0)
-	for rows.Next() {
-		ds := Dataset{}
-		if err := rows.StructScan(&ds); err != nil {
-			return nil, err
-		}
-
-		dsList = append(dsList, ds)
+	query, args, err := sqlx.In(`
+SELECT dt.dataset_id, dt.name
+FROM dataset_tag dt
+WHERE dt.dataset_id IN (?)
+ORDER BY dt.id;
+`, datasetIds)
+	if err != nil {
+		return nil, err
 	}
 
-	return dsList, nil
-}
-
-func (m *mysqlRepository) FindAllPublicByTitle(userId int64, title string, offset, limit int) ([]Dataset, error) {
-	rows, err := m.db.Queryx(`
-SELECT ds.id              "id",
-       ds.user_id         "user_id",
-       ds.dataset_no      "dataset_no",
-       ds.url             "url",
-       ds.origin_url      "origin_url",
-       ds.name            "name",
-       ds.description     "description",
-       ds.public          "public",
-       ds.status          "status",
-       ds.image_id        "image_id",
-       ds.kind            "kind",
-       ds.create_time     "create_time",
-       ds.update_time     "update_time",
-       dsl.usable         "usable",
-       dsl.id IS NOT NULL "in_library",
-       i.url              "thumbnail_url"
-FROM dataset ds
-         LEFT JOIN (SELECT idsl.*
-                    FROM dataset_library idsl
-                    WHERE idsl.user_id = ?) dsl on ds.id = dsl.dataset_id
-         LEFT JOIN image i on ds.image_id = i.id
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND ds.name = ?
-ORDER BY ds.id DESC
-LIMIT ?, ?;
-`, userId, title, offset, limit)
+	rows, err := m.db.Queryx(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	dsList := make([]Dataset, 0)
 	for rows.Next() {
-		ds := Dataset{}
-		if err := rows.StructScan(&ds); err != nil {
+		var (
+			datasetId int64
+			name      string
+		)
+		if err := rows.Scan(&datasetId, &name); err != nil {
 			return nil, err
 		}
 
-		dsList = append(dsList, ds)
+		tags[datasetId] = append(tags[datasetId], name)
 	}
 
-	return dsList, nil
+	return tags, rows.Err()
 }
 
-func (m *mysqlRepository) FindAllPublicByTitleLike(userId int64, title string, offset, limit int) ([]Dataset, error) {
-	rows, err := m.db.Queryx(`
-SELECT ds.id              "id",
-       ds.user_id         "user_id",
-       ds.dataset_no      "dataset_no",
-       ds.url             "url",
-       ds.origin_url      "origin_url",
-       ds.name            "name",
-       ds.description     "description",
-       ds.public          "public",
-       ds.status          "status",
-       ds.image_id        "image_id",
-       ds.kind            "kind",
-       ds.create_time     "create_time",
-       ds.update_time     "update_time",
-       dsl.usable         "usable",
-       dsl.id IS NOT NULL "in_library",
-       i.url              "thumbnail_url"
-FROM dataset ds
-         LEFT JOIN (SELECT idsl.*
-                    FROM dataset_library idsl
-                    WHERE idsl.user_id = ?) dsl on ds.id = dsl.dataset_id
-         LEFT JOIN image i on ds.image_id = i.id
-WHERE ds.public = TRUE
-  AND ds.status = 'EXIST'
-  AND ds.name LIKE ?
-ORDER BY ds.id DESC
-LIMIT ?, ?;
-`, userId, util.LikeArg(title), offset, limit)
+func (m *mysqlRepository) ReplaceTags(datasetId int64, tags []string) error {
+	tx, err := m.db.Beginx()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	dsList := make([]Dataset, 0)
-	for rows.Next() {
-		ds := Dataset{}
-		if err := rows.StructScan(&ds); err != nil {
-			return nil, err
-		}
+	if _, err := tx.Exec(`DELETE FROM dataset_tag WHERE dataset_id = ?`, datasetId); err != nil {
+		return err
+	}
 
-		dsList = append(dsList, ds)
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO dataset_tag (dataset_id, name) VALUES (?, ?)`, datasetId, tag); err != nil {
+			return err
+		}
 	}
 
-	return dsList, nil
+	return tx.Commit()
 }
 
 func (m *mysqlRepository) FindNextDatasetNo(userId int64) (int64, error) {
@@ -344,6 +163,8 @@ SELECT ds.id,
        ds.status,
        ds.image_id,
        ds.kind,
+       ds.size,
+       ds.profile,
        ds.create_time,
        ds.update_time,
        dsl.usable         "usable",
@@ -371,6 +192,8 @@ func (m *mysqlRepository) Insert(dataset Dataset) (int64, error) {
                      status,
                      image_id,
                      kind,
+                     size,
+                     profile,
                      create_time,
                      update_time)
 VALUES (:user_id,
@@ -383,6 +206,8 @@ VALUES (:user_id,
         :status,
         :image_id,
         :kind,
+        :size,
+        :profile,
         :create_time,
         :update_time);`, dataset)
 
@@ -401,7 +226,72 @@ func (m *mysqlRepository) Update(id int64, dataset Dataset) error {
 	defer tx.Rollback()
 
 	dataset.ID = id
-	_, err = tx.NamedExec(`
+	if err := updateDataset(tx, dataset); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *mysqlRepository) UpdateToLatestVersion(id int64, dataset Dataset) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// versions finishing their uploads at the same time are serialized by the lock of the dataset,
+	// so that the dataset mirrors the latest version whichever finishes last
+	var lockedId int64
+	if err := tx.Get(&lockedId, `SELECT id FROM dataset WHERE id = ? FOR UPDATE;`, id); err != nil {
+		return err
+	}
+
+	var latest Version
+	err = tx.QueryRowx(`
+SELECT dsv.id,
+       dsv.dataset_id,
+       dsv.version_no,
+       dsv.url,
+       dsv.origin_url,
+       dsv.kind,
+       dsv.size,
+       dsv.profile,
+       dsv.status,
+       dsv.create_time,
+       dsv.update_time
+FROM dataset_version dsv
+WHERE dsv.dataset_id = ?
+  AND dsv.status = 'EXIST'
+ORDER BY dsv.version_no DESC
+LIMIT 1
+FOR UPDATE;
+`, id).StructScan(&latest)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		dataset = latest.Snapshot(dataset)
+	}
+
+	dataset.ID = id
+	if err := updateDataset(tx, dataset); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func updateDataset(tx *sqlx.Tx, dataset Dataset) error {
+	_, err := tx.NamedExec(`
 UPDATE dataset SET user_id = :user_id,
                    dataset_no = :dataset_no,
                    url = :url,
@@ -412,42 +302,137 @@ UPDATE dataset SET user_id = :user_id,
                    status 	   = :status,
                    image_id	   = :image_id,
                    kind        = :kind,
+                   size        = :size,
+                   profile     = :profile,
                    create_time = :create_time,
                    update_time = :update_time
 WHERE id = :id and status != 'DELETED';
 `, dataset)
 
-	usable := dataset.Public.Bool && dataset.Status == EXIST
-	err = changeDatasetLibraryUsable(tx, dataset.ID, usable)
-	if err := tx.Commit(); err != nil {
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return refreshDatasetLibraryUsable(tx, dataset.ID)
 }
 
-func (m *mysqlRepository) Delete(id int64) error {
+// Delete deletes the dataset and cascades to everything using it.
+// Library entries become unusable, dataset configs using it are flagged invalid,
+// and project configs set to those dataset configs are reset.
+func (m *mysqlRepository) Delete(id int64) (DeleteResult, error) {
 	tx, err := m.db.Beginx()
 	if err != nil {
-		return err
+		return DeleteResult{}, err
 	}
 	defer tx.Rollback()
 
 	_, err = tx.Exec(`UPDATE dataset SET status = 'DELETED' WHERE id = ? and status != 'DELETED'`, id)
 	if err != nil {
-		return err
+		return DeleteResult{}, err
 	}
 
 	err = changeDatasetLibraryUsable(tx, id, false)
 	if err != nil {
-		return err
+		return DeleteResult{}, err
+	}
+
+	affected, err := invalidateDatasetConfigs(tx, id)
+	if err != nil {
+		return DeleteResult{}, err
+	}
+
+	released, err := deleteUnreferencedVersions(tx, id)
+	if err != nil {
+		return DeleteResult{}, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return err
+		return DeleteResult{}, err
 	}
 
-	return nil
+	return DeleteResult{Released: released, AffectedProjects: affected}, nil
+}
+
+// invalidateDatasetConfigs flags the dataset configs using the dataset invalid,
+// and resets the project configs set to them. It returns the affected projects.
+func invalidateDatasetConfigs(tx *sqlx.Tx, datasetId int64) ([]AffectedProject, error) {
+	rows, err := tx.Queryx(`
+SELECT dc.id "dataset_config_id", p.id "project_id", p.user_id "user_id", p.project_no "project_no", p.name "name", p.config "config"
+FROM dataset_config dc
+         JOIN project p ON dc.project_id = p.id
+WHERE dc.dataset_id = ?
+  AND dc.status = 'EXIST'
+  AND dc.valid = TRUE
+  AND p.status != 'DELETED'
+ORDER BY p.id, dc.id
+FOR UPDATE;
+`, datasetId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	affected := make([]AffectedProject, 0)
+	configs := make(map[int64]util.NullJson)
+	for rows.Next() {
+		var row struct {
+			DatasetConfigId int64         `db:"dataset_config_id"`
+			ProjectId       int64         `db:"project_id"`
+			UserId          int64         `db:"user_id"`
+			ProjectNo       int           `db:"project_no"`
+			Name            string        `db:"name"`
+			Config          util.NullJson `db:"config"`
+		}
+		if err := rows.StructScan(&row); err != nil {
+			return nil, err
+		}
+
+		if len(affected) == 0 || affected[len(affected)-1].ProjectId != row.ProjectId {
+			affected = append(affected, AffectedProject{
+				ProjectId: row.ProjectId,
+				UserId:    row.UserId,
+				ProjectNo: row.ProjectNo,
+				Name:      row.Name,
+			})
+			configs[row.ProjectId] = row.Config
+		}
+
+		project := &affected[len(affected)-1]
+		project.DatasetConfigIds = append(project.DatasetConfigIds, row.DatasetConfigId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(`
+UPDATE dataset_config dc
+SET dc.valid          = FALSE,
+    dc.invalid_reason = ?
+WHERE dc.dataset_id = ?
+  AND dc.status = 'EXIST'
+  AND dc.valid = TRUE;
+`, ConfigInvalidReasonDatasetDeleted, datasetId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, project := range affected {
+		config, reset, err := resetProjectDatasetConfig(configs[project.ProjectId], project.DatasetConfigIds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to reset config of project %d", project.ProjectId)
+		}
+		if !reset {
+			continue
+		}
+
+		if _, err := tx.Exec(`UPDATE project SET config = ? WHERE id = ?`, config, project.ProjectId); err != nil {
+			return nil, err
+		}
+		affected[i].ConfigReset = true
+	}
+
+	return affected, nil
 }
 
 func changeDatasetLibraryUsable(tx *sqlx.Tx, datasetId int64, usable bool) error {
@@ -460,6 +445,147 @@ WHERE dsl.dataset_id = ?;
 	return err
 }
 
+// refreshDatasetLibraryUsable updates usable of the library entries of the dataset
+// after the dataset or its access control list is changed.
+func refreshDatasetLibraryUsable(tx *sqlx.Tx, datasetId int64) error {
+	_, err := tx.Exec(`
+UPDATE dataset_library dsl
+    JOIN dataset ds ON dsl.dataset_id = ds.id
+SET dsl.usable = `+usableBy("dsl.user_id")+`
+WHERE dsl.dataset_id = ?;
+`, datasetId)
+
+	return err
+}
+
+// RefreshDatasetLibraryUsable updates usable of the library entries of the user
+// after the user joined or left a team.
+func (m *mysqlRepository) RefreshDatasetLibraryUsable(userId int64) error {
+	_, err := m.db.Exec(`
+UPDATE dataset_library dsl
+    JOIN dataset ds ON dsl.dataset_id = ds.id
+SET dsl.usable = `+usableBy("dsl.user_id")+`
+WHERE dsl.user_id = ?;
+`, userId)
+
+	return err
+}
+
+func (m *mysqlRepository) FindACLs(datasetId int64) ([]ACL, error) {
+	acls := make([]ACL, 0)
+	err := m.db.Select(&acls, `
+SELECT acl.id                  "id",
+       acl.dataset_id          "dataset_id",
+       acl.user_id             "user_id",
+       acl.team_id             "team_id",
+       acl.permission          "permission",
+       acl.create_time         "create_time",
+       acl.update_time         "update_time",
+       IFNULL(u.name, t.name)  "name"
+FROM dataset_acl acl
+         LEFT JOIN user u ON acl.user_id = u.id
+         LEFT JOIN team t ON acl.team_id = t.id
+WHERE acl.dataset_id = ?
+ORDER BY acl.id;
+`, datasetId)
+
+	return acls, err
+}
+
+// GrantACL grants the permission to the user or the team of acl,
+// replacing the permission granted before.
+func (m *mysqlRepository) GrantACL(acl ACL) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExec(`
+INSERT INTO dataset_acl (dataset_id, user_id, team_id, permission)
+VALUES (:dataset_id, :user_id, :team_id, :permission)
+ON DUPLICATE KEY UPDATE permission = VALUES(permission);
+`, acl)
+	if err != nil {
+		return err
+	}
+
+	if err := refreshDatasetLibraryUsable(tx, acl.DatasetID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *mysqlRepository) RevokeACL(datasetId int64, aclId int64) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM dataset_acl WHERE id = ? AND dataset_id = ?;`, aclId, datasetId)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := refreshDatasetLibraryUsable(tx, datasetId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindGrantedPermission finds the permission granted to the user or the user's teams,
+// or an empty permission if the dataset is not shared with the user.
+func (m *mysqlRepository) FindGrantedPermission(userId int64, datasetId int64) (Permission, error) {
+	// 'TRAIN' > 'READ', so MAX is the strongest permission
+	var permission Permission
+	err := m.db.QueryRowx(`
+SELECT IFNULL(MAX(acl.permission), '')
+FROM dataset_acl acl
+WHERE acl.dataset_id = ?
+  AND (acl.user_id = ?
+    OR acl.team_id IN (SELECT tm.team_id FROM team_member tm WHERE tm.user_id = ?));
+`, datasetId, userId, userId).Scan(&permission)
+
+	return permission, err
+}
+
+// CountActiveDatasetConfigs counts dataset configs of live projects using the dataset, including other users'.
+func (m *mysqlRepository) CountActiveDatasetConfigs(datasetId int64) (int64, error) {
+	var count int64
+	err := m.db.QueryRowx(`
+SELECT COUNT(dc.id)
+FROM dataset_config dc
+         JOIN project p ON dc.project_id = p.id
+WHERE dc.dataset_id = ?
+  AND dc.status = 'EXIST'
+  AND dc.valid = TRUE
+  AND p.status != 'DELETED';
+`, datasetId).Scan(&count)
+
+	return count, err
+}
+
+// IsUsableBy reports whether the user can train with the dataset.
+func (m *mysqlRepository) IsUsableBy(userId int64, datasetId int64) (bool, error) {
+	var usable bool
+	err := m.db.QueryRowx(`
+SELECT EXISTS(SELECT 1
+              FROM dataset ds
+              WHERE ds.id = ?
+                AND `+usableBy("?")+`);
+`, datasetId, userId, userId, userId).Scan(&usable)
+
+	return usable, err
+}
+
 func (m *mysqlRepository) FindDatasetFromDatasetLibraryByUserId(userId int64, offset, limit int) ([]Dataset, error) {
 	rows, err := m.db.Queryx(`
 SELECT ds.id              "id",
@@ -528,6 +654,8 @@ SELECT ds.id              "id",
        ds.status          "status",
        ds.image_id        "image_id",
        ds.kind            "kind",
+       ds.size            "size",
+       ds.profile         "profile",
        ds.create_time     "create_time",
        ds.update_time     "update_time",
        dsl.usable         "usable",
@@ -546,10 +674,10 @@ WHERE dsl.user_id = ?
 func (m *mysqlRepository) AddDatasetToDatasetLibrary(userId int64, datasetId int64) error {
 	_, err := m.db.Exec(`
 INSERT INTO dataset_library (user_id, dataset_id, usable)
-SELECT ? "user_id", ds.id "dataset_id", (ds.public IS TRUE OR ds.user_id = ?) "usable"
+SELECT ? "user_id", ds.id "dataset_id", `+usableBy("?")+` "usable"
 FROM dataset ds
 WHERE ds.id = ? AND ds.status != 'DELETED';
-`, userId, userId, datasetId)
+`, userId, userId, userId, userId, datasetId)
 
 	return err
 }
@@ -564,3 +692,261 @@ WHERE dsl.user_id = ?
 
 	return err
 }
+
+func (m *mysqlRepository) InsertVersion(version Version) (int64, error) {
+	result, err := m.db.NamedExec(`
+INSERT INTO dataset_version (dataset_id,
+                             version_no,
+                             url,
+                             origin_url,
+                             kind,
+                             size,
+                             profile,
+                             status,
+                             create_time,
+                             update_time)
+SELECT :dataset_id,
+       IFNULL(MAX(dsv.version_no), 0) + 1,
+       :url,
+       :origin_url,
+       :kind,
+       :size,
+       :profile,
+       :status,
+       :create_time,
+       :update_time
+FROM dataset_version dsv
+WHERE dsv.dataset_id = :dataset_id;
+`, version)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (m *mysqlRepository) UpdateVersion(version Version) error {
+	_, err := m.db.NamedExec(`
+UPDATE dataset_version
+SET url         = :url,
+    origin_url  = :origin_url,
+    kind        = :kind,
+    size        = :size,
+    profile     = :profile,
+    status      = :status,
+    update_time = :update_time
+WHERE id = :id
+  AND status != 'DELETED';
+`, version)
+
+	return err
+}
+
+func (m *mysqlRepository) FindVersionByID(id int64) (Version, error) {
+	var version Version
+	err := m.db.QueryRowx(`
+SELECT dsv.id,
+       dsv.dataset_id,
+       dsv.version_no,
+       dsv.url,
+       dsv.origin_url,
+       dsv.kind,
+       dsv.size,
+       dsv.profile,
+       dsv.status,
+       dsv.create_time,
+       dsv.update_time
+FROM dataset_version dsv
+WHERE dsv.id = ?;
+`, id).StructScan(&version)
+
+	return version, err
+}
+
+func (m *mysqlRepository) FindLatestVersion(datasetId int64) (Version, error) {
+	var version Version
+	err := m.db.QueryRowx(`
+SELECT dsv.id,
+       dsv.dataset_id,
+       dsv.version_no,
+       dsv.url,
+       dsv.origin_url,
+       dsv.kind,
+       dsv.size,
+       dsv.profile,
+       dsv.status,
+       dsv.create_time,
+       dsv.update_time
+FROM dataset_version dsv
+WHERE dsv.dataset_id = ?
+  AND dsv.status = 'EXIST'
+ORDER BY dsv.version_no DESC
+LIMIT 1;
+`, datasetId).StructScan(&version)
+
+	return version, err
+}
+
+func (m *mysqlRepository) FindVersionsByDatasetId(datasetId int64) ([]Version, error) {
+	rows, err := m.db.Queryx(`
+SELECT dsv.id,
+       dsv.dataset_id,
+       dsv.version_no,
+       dsv.url,
+       dsv.origin_url,
+       dsv.kind,
+       dsv.size,
+       dsv.status,
+       dsv.create_time,
+       dsv.update_time
+FROM dataset_version dsv
+WHERE dsv.dataset_id = ?
+  AND dsv.status != 'DELETED'
+ORDER BY dsv.version_no DESC;
+`, datasetId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]Version, 0)
+	for rows.Next() {
+		var version Version
+		if err := rows.StructScan(&version); err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// deleteUnreferencedVersions deletes versions of the dataset except the ones used by trains,
+// so that past trains stay reproducible.
+// It returns urls of the objects no longer referenced by any version.
+func deleteUnreferencedVersions(tx *sqlx.Tx, datasetId int64) ([]string, error) {
+	var versionIds []int64
+	err := tx.Select(&versionIds, `
+SELECT dsv.id
+FROM dataset_version dsv
+WHERE dsv.dataset_id = ?
+  AND dsv.status != 'DELETED'
+  AND NOT EXISTS(SELECT 1 FROM train_config tc WHERE tc.dataset_version_id = dsv.id)
+FOR UPDATE;
+`, datasetId)
+	if err != nil {
+		return nil, err
+	}
+	if len(versionIds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`UPDATE dataset_version SET status = 'DELETED' WHERE id IN (?);`, versionIds)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+
+	return releaseVersionObjects(tx, versionIds)
+}
+
+func (m *mysqlRepository) InsertVersionObject(object VersionObject) error {
+	_, err := m.db.NamedExec(`
+INSERT IGNORE INTO dataset_version_object (version_id, url, size, user_id)
+VALUES (:version_id, :url, :size, :user_id);
+`, object)
+	return err
+}
+
+func (m *mysqlRepository) DeleteUnreferencedObject(url string, deleteObject func(url string) error) (bool, error) {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// the lock blocks referencing the object until it is deleted,
+	// and the uploader referencing it after then stores it again
+	var references int64
+	err = tx.Get(&references, `
+SELECT COUNT(*)
+FROM dataset_version_object
+WHERE url = ?
+FOR UPDATE;
+`, url)
+	if err != nil {
+		return false, err
+	}
+	if references > 0 {
+		return false, nil
+	}
+
+	if err := deleteObject(url); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (m *mysqlRepository) FindNormalizedUrl(versionId int64, imageOption string) (string, error) {
+	var url string
+	err := m.db.Get(&url, `
+SELECT url
+FROM dataset_version_normalization
+WHERE version_id = ?
+  AND image_option = ?;
+`, versionId, imageOption)
+	return url, err
+}
+
+func (m *mysqlRepository) InsertNormalizedUrl(versionId int64, imageOption string, url string) error {
+	_, err := m.db.Exec(`
+INSERT IGNORE INTO dataset_version_normalization (version_id, image_option, url)
+VALUES (?, ?, ?);
+`, versionId, imageOption, url)
+	return err
+}
+
+// releaseVersionObjects drops object references of the deleted versions.
+// It returns urls of the objects whose reference count became zero.
+func releaseVersionObjects(tx *sqlx.Tx, versionIds []int64) ([]string, error) {
+	query, args, err := sqlx.In(`
+SELECT DISTINCT dsvo.url
+FROM dataset_version_object dsvo
+WHERE dsvo.version_id IN (?)
+  AND NOT EXISTS(SELECT 1
+                 FROM dataset_version_object rdsvo
+                 WHERE rdsvo.url = dsvo.url
+                   AND rdsvo.version_id NOT IN (?));
+`, versionIds, versionIds)
+	if err != nil {
+		return nil, err
+	}
+
+	released := make([]string, 0)
+	if err := tx.Select(&released, query, args...); err != nil {
+		return nil, err
+	}
+
+	query, args, err = sqlx.In(`DELETE FROM dataset_version_object WHERE version_id IN (?);`, versionIds)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+
+	// normalized datasets of the versions are released as their objects
+	query, args, err = sqlx.In(`DELETE FROM dataset_version_normalization WHERE version_id IN (?);`, versionIds)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+
+	return released, nil
+}
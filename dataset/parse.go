@@ -1,10 +1,8 @@
 package dataset
 
 import (
-	"archive/zip"
 	"bytes"
 	"database/sql"
-	"encoding/csv"
 	"fmt"
 	"github.com/gabriel-vasile/mimetype"
 	"io"
@@ -16,10 +14,16 @@ import (
 )
 
 const (
-	_csv  = "text/csv"
-	_zip  = "application/zip"
-	_jpeg = "image/jpeg"
-	_png  = "image/png"
+	_csv     = "text/csv"
+	_tsv     = "text/tab-separated-values"
+	_json    = "application/json"
+	_ndjson  = "application/x-ndjson"
+	_parquet = "application/vnd.apache.parquet"
+	_zip     = "application/zip"
+	_tar     = "application/x-tar"
+	_gzip    = "application/gzip"
+	_jpeg    = "image/jpeg"
+	_png     = "image/png"
 )
 
 type ErrUnSupportedContentType struct {
@@ -35,10 +39,24 @@ func IsUnsupportedContentTypeError(err error) bool {
 	return ok
 }
 
-func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Repository, datasetEntity Dataset) {
+// uploadAsync parses file as the new version of datasetEntity.
+// The dataset mirrors its latest version after the version is uploaded,
+// which may not be this version if a later version is uploaded first.
+// The version fails if it can't be uploaded.
+func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Repository, datasetEntity Dataset, version Version) {
 	log.Debugf("start to upload dataset asynchronously")
 	defer file.Close()
 
+	uploaded := false
+	defer func() {
+		if !uploaded {
+			failVersion(datasetRepo, version)
+		}
+	}()
+
+	// every object is referenced by the version before it is stored
+	uploader := versionUploader{AwsS3Uploader: storage, datasetRepo: datasetRepo, versionId: version.ID}
+
 	// upload origin file
 	mType, err := mimetype.DetectReader(file)
 	if err != nil {
@@ -58,11 +76,11 @@ func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Re
 	var originUrl string
 	switch {
 	case mType.Is(_csv):
-		originUrl, err = storage.UploadFile(file, cloud.WithContentType(_csv), cloud.WithExtension("csv"))
+		originUrl, err = uploader.UploadFile(file, cloud.WithContentType(_csv), cloud.WithExtension("csv"))
 	case mType.Is(_zip):
-		originUrl, err = storage.UploadFile(file, cloud.WithContentType(_zip), cloud.WithExtension("zip"))
+		originUrl, err = uploader.UploadFile(file, cloud.WithContentType(_zip), cloud.WithExtension("zip"))
 	default:
-		originUrl, err = storage.UploadFile(file)
+		originUrl, err = uploader.UploadFile(file)
 	}
 	if err != nil {
 		log.Errorw("failed to upload origin file",
@@ -80,7 +98,7 @@ func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Re
 		return
 	}
 
-	url, kind, err := save(storage, file)
+	url, kind, profile, profiled, err := save(uploader, file)
 	if err != nil {
 		//if IsUnsupportedContentTypeError(err) {
 		//	log.Warn(err)
@@ -92,18 +110,54 @@ func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Re
 		return
 	}
 
-	datasetEntity, err = datasetRepo.FindByID(datasetEntity.ID)
+	version.OriginURL = sql.NullString{
+		Valid:  true,
+		String: originUrl,
+	}
+	version.URL = sql.NullString{
+		Valid:  true,
+		String: url,
+	}
+	version.Kind = kind
+	if profiled {
+		version.Profile, err = profile.toNullJson()
+		if err != nil {
+			log.Errorw("failed to marshal dataset profile",
+				"error", err,
+				"dataset.id", datasetEntity.ID)
+			return
+		}
+	}
+	version.Status = EXIST
+	version.UpdateTime = time.Now()
+
+	if err := datasetRepo.UpdateVersion(version); err != nil {
+		log.Errorw("failed to update dataset version",
+			"error", err,
+			"dataset.id", datasetEntity.ID,
+			"version.id", version.ID)
+		return
+	}
+	uploaded = true
+
+	found, err := datasetRepo.FindByID(datasetEntity.ID)
 	if err != nil {
 		log.Errorw("failed to find dataset by ID",
 			"error", err,
 			"dataset.id", datasetEntity.ID)
+		// the dataset is not updated to the version
+		failVersion(datasetRepo, version)
+		return
 	}
+	datasetEntity = found
 
 	switch datasetEntity.Status {
 	case UPLOADING:
 		datasetEntity.Status = UPLOADED_F
 	case UPLOADED_D:
 		datasetEntity.Status = EXIST
+	case EXIST:
+		// new version of an existing dataset
 	default:
 		// unexpected
 		log.Errorw("dataset status is unexpected",
@@ -111,18 +165,9 @@ func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Re
 			"dataset.id", datasetEntity.ID)
 		return
 	}
-	datasetEntity.OriginURL = sql.NullString{
-		Valid:  true,
-		String: originUrl,
-	}
-	datasetEntity.URL = sql.NullString{
-		Valid:  true,
-		String: url,
-	}
-	datasetEntity.Kind = kind
 	datasetEntity.UpdateTime = time.Now()
 
-	if err := datasetRepo.Update(datasetEntity.ID, datasetEntity); err != nil {
+	if err := datasetRepo.UpdateToLatestVersion(datasetEntity.ID, datasetEntity); err != nil {
 		log.Errorw("failed to update dataset",
 			"error", err,
 			"dataset.id", datasetEntity.ID)
@@ -132,22 +177,48 @@ func uploadAsync(storage *cloud.AwsS3Client, file multipart.File, datasetRepo Re
 	log.Debugf("success to upload dataset asynchronously")
 }
 
-func save(storage *cloud.AwsS3Client, file multipart.File) (string, Kind, error) {
+// failVersion marks the version of which upload failed.
+func failVersion(datasetRepo Repository, version Version) {
+	version.Status = FAILED
+	version.UpdateTime = time.Now()
+	if err := datasetRepo.UpdateVersion(version); err != nil {
+		log.Errorw("failed to fail dataset version",
+			"error", err,
+			"dataset.id", version.DatasetID,
+			"version.id", version.ID)
+	}
+}
+
+// save parses the file to a csv dataset and uploads it.
+// The dataset is saved even if it can't be profiled, in which case profiled is false
+// and the profile only has the image summary of the dataset.
+func save(storage cloud.AwsS3Uploader, file multipart.File) (url string, kind Kind, profile Profile, profiled bool, err error) {
 	f, kind, err := parseToDataset(storage, file)
 	if err != nil {
-		return "", KindUnknown, err
+		return "", KindUnknown, Profile{}, false, err
 	}
 
 	fBytes, err := io.ReadAll(f)
 	if err != nil {
-		return "", KindUnknown, err
+		return "", KindUnknown, Profile{}, false, err
+	}
+
+	profile, err = profileCsv(bytes.NewReader(fBytes))
+	if err != nil {
+		log.Warnw("failed to profile dataset, saved without profile",
+			"error", err)
+		profile = Profile{}
+	}
+	profiled = err == nil
+	if images, ok := f.(*imageCsv); ok {
+		profile.setImages(images.images, images.skipped)
 	}
 
-	url, err := storage.UploadBytes(fBytes, cloud.WithContentType(_csv), cloud.WithExtension("csv"))
-	return url, kind, err
+	url, err = storage.UploadBytes(fBytes, cloud.WithContentType(_csv), cloud.WithExtension("csv"))
+	return url, kind, profile, profiled, err
 }
 
-func parseToDataset(storage *cloud.AwsS3Client, file multipart.File) (io.Reader, Kind, error) {
+func parseToDataset(storage cloud.AwsS3Uploader, file multipart.File) (io.Reader, Kind, error) {
 	mType, err := mimetype.DetectReader(file)
 	if err != nil {
 		return nil, KindUnknown, err
@@ -157,90 +228,27 @@ func parseToDataset(storage *cloud.AwsS3Client, file multipart.File) (io.Reader,
 		return nil, KindUnknown, err
 	}
 
-	switch {
-	case mType.Is(_csv):
-		return file, KindText, nil
-
-	case mType.Is(_zip):
-		return zipToCsv(storage, file)
-
-	default:
+	p, ok := findParser(mType)
+	if !ok {
 		return nil, KindUnknown, ErrUnSupportedContentType{contentType: mType.String()}
 	}
-}
 
-func zipToCsv(storage *cloud.AwsS3Client, file multipart.File) (io.Reader, Kind, error) {
 	fileBytes, err := ioutil.ReadAll(file)
 	if err != nil {
 		return nil, KindUnknown, err
 	}
 
-	reader, err := zip.NewReader(bytes.NewReader(fileBytes), int64(len(fileBytes)))
-	if err != nil {
-		return nil, KindUnknown, err
-	}
-
-	// 압축된 파일 하나하나 읽으면서 jpeg, png 인지 확인. 아니면 에러
-	type dataset struct {
-		label string
-		bytes []byte
-	}
-	datasetList := make([]dataset, 0)
-	var currentDirName string
-	for _, zipFile := range reader.File {
-		if zipFile.FileInfo().IsDir() {
-			currentDirName = zipFile.FileInfo().Name()
-			continue
-		}
-
-		zipFileBytes, err := readZipFile(zipFile)
-		if err != nil {
-			return nil, KindUnknown, err
-		}
-
-		mType := mimetype.Detect(zipFileBytes)
-		switch {
-		case mType.Is(_jpeg), mType.Is(_png):
-			datasetList = append(datasetList, dataset{
-				label: currentDirName,
-				bytes: zipFileBytes,
-			})
-
-		default:
-			return nil, KindUnknown, ErrUnSupportedContentType{contentType: mType.String()}
-		}
-
-	}
-
-	buf := new(bytes.Buffer)
-	csvWriter := csv.NewWriter(buf)
-	defer csvWriter.Flush()
-
-	if err := csvWriter.Write([]string{"url", "label"}); err != nil {
-		return nil, KindUnknown, err
-	}
-
-	for _, ds := range datasetList {
-		url, err := storage.UploadBytes(ds.bytes)
-		if err != nil {
-			return nil, KindUnknown, err
-		}
-
-		log.Debugf("url: %s", url)
-
-		if err := csvWriter.Write([]string{url, ds.label}); err != nil {
-			return nil, KindUnknown, err
-		}
-	}
-
-	return buf, KindImages, nil
+	return p(storage, fileBytes)
 }
 
-func readZipFile(file *zip.File) ([]byte, error) {
-	f, err := file.Open()
-	if err != nil {
-		return nil, err
+// deleteObjects deletes objects released by deleted versions from the storage,
+// unless they are referenced again in the meantime.
+func deleteObjects(storage *cloud.AwsS3Client, datasetRepo Repository, urls []string) {
+	for _, url := range urls {
+		if _, err := datasetRepo.DeleteUnreferencedObject(url, storage.Delete); err != nil {
+			log.Errorw("failed to delete object",
+				"error", err,
+				"url", url)
+		}
 	}
-	defer f.Close()
-	return ioutil.ReadAll(f)
 }
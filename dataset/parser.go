@@ -0,0 +1,67 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/gabriel-vasile/mimetype"
+	"io"
+	"nns_back/cloud"
+)
+
+// parser converts an uploaded file into the internal csv representation.
+// Parsed csv has a header as the first record.
+type parser func(storage cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error)
+
+// parsers is the parser registry keyed by detected mimetype.
+var parsers = map[string]parser{}
+
+func registerParser(p parser, mimeTypes ...string) {
+	for _, mimeType := range mimeTypes {
+		parsers[mimeType] = p
+	}
+}
+
+func init() {
+	// mimetype can not detect parquet by itself
+	mimetype.Extend(isParquet, _parquet, ".parquet")
+
+	registerParser(csvParser, _csv)
+	registerParser(tsvToCsv, _tsv)
+	registerParser(jsonToCsv, _json, _ndjson)
+	registerParser(parquetToCsv, _parquet)
+	registerParser(zipToCsv, _zip)
+	registerParser(tarToCsv, _tar)
+	registerParser(gzipToCsv, _gzip)
+}
+
+// findParser finds the parser of mType, or of the closest parent of mType.
+func findParser(mType *mimetype.MIME) (parser, bool) {
+	for m := mType; m != nil; m = m.Parent() {
+		if p, ok := parsers[m.String()]; ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func csvParser(_ cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	return bytes.NewReader(data), KindText, nil
+}
+
+func tsvToCsv(_ cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	tsvReader := csv.NewReader(bytes.NewReader(data))
+	tsvReader.Comma = '\t'
+	tsvReader.LazyQuotes = true
+
+	records, err := tsvReader.ReadAll()
+	if err != nil {
+		return nil, KindUnknown, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeRecords(buf, records); err != nil {
+		return nil, KindUnknown, err
+	}
+
+	return buf, KindText, nil
+}
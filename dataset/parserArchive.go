@@ -0,0 +1,203 @@
+package dataset
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"nns_back/cloud"
+	"nns_back/log"
+	"path"
+)
+
+// labeledImage is an image in an image archive.
+// Label is the name of the directory containing the image.
+type labeledImage struct {
+	name  string
+	label string
+	bytes []byte
+}
+
+func labelOf(filePath string) string {
+	dir := path.Dir(filePath)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return path.Base(dir)
+}
+
+func zipToCsv(storage cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, KindUnknown, err
+	}
+
+	images := make([]labeledImage, 0, len(reader.File))
+	for _, zipFile := range reader.File {
+		if zipFile.FileInfo().IsDir() {
+			continue
+		}
+
+		zipFileBytes, err := readZipFile(zipFile)
+		if err != nil {
+			return nil, KindUnknown, err
+		}
+
+		images = append(images, labeledImage{
+			name:  zipFile.Name,
+			label: labelOf(zipFile.Name),
+			bytes: zipFileBytes,
+		})
+	}
+
+	return imagesToCsv(storage, images)
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAllLimited(f, _maxUploadSize)
+}
+
+func tarToCsv(storage cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	reader := tar.NewReader(bytes.NewReader(data))
+
+	images := make([]labeledImage, 0)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, KindUnknown, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		tarFileBytes, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, KindUnknown, err
+		}
+
+		images = append(images, labeledImage{
+			name:  header.Name,
+			label: labelOf(header.Name),
+			bytes: tarFileBytes,
+		})
+	}
+
+	return imagesToCsv(storage, images)
+}
+
+// ErrDecompressedTooLarge is returned if the decompressed content of an archive exceeds the upload size limit.
+var ErrDecompressedTooLarge = errors.New("decompressed content too large")
+
+// gzipToCsv decompresses data and parses it with the parser of the decompressed content type.
+// e.g. tar.gz image archive, csv.gz
+func gzipToCsv(storage cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, KindUnknown, err
+	}
+	defer gzipReader.Close()
+
+	decompressed, err := readAllLimited(gzipReader, _maxUploadSize)
+	if err != nil {
+		return nil, KindUnknown, err
+	}
+
+	mType := mimetype.Detect(decompressed)
+	p, ok := findParser(mType)
+	if !ok || mType.Is(_gzip) {
+		return nil, KindUnknown, ErrUnSupportedContentType{contentType: _gzip + "+" + mType.String()}
+	}
+
+	return p(storage, decompressed)
+}
+
+// readAllLimited reads r until EOF, failing with ErrDecompressedTooLarge if r has more than limit bytes,
+// so that a small archive can't be decompressed to a huge content.
+func readAllLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrDecompressedTooLarge
+	}
+	return data, nil
+}
+
+// imagesToCsv validates and uploads each image and writes "url,label" csv.
+// Junk files, unsupported files and corrupt images are skipped and reported
+// instead of failing the whole dataset.
+func imagesToCsv(storage cloud.AwsS3Uploader, images []labeledImage) (io.Reader, Kind, error) {
+	result := &imageCsv{Buffer: new(bytes.Buffer)}
+	csvWriter := csv.NewWriter(result)
+
+	if err := csvWriter.Write([]string{_imageDatasetUrlColumn, _imageDatasetLabelColumn}); err != nil {
+		return nil, KindUnknown, err
+	}
+
+	for _, labeled := range images {
+		if isJunkFile(labeled.name) {
+			result.skipped = append(result.skipped, SkippedFile{Name: labeled.name, Reason: "junk file"})
+			continue
+		}
+
+		mType := mimetype.Detect(labeled.bytes)
+		if !mType.Is(_jpeg) && !mType.Is(_png) {
+			result.skipped = append(result.skipped, SkippedFile{
+				Name:   labeled.name,
+				Reason: ErrUnSupportedContentType{contentType: mType.String()}.Error(),
+			})
+			continue
+		}
+
+		img, _, err := decodeImage(labeled.bytes)
+		if err != nil {
+			result.skipped = append(result.skipped, SkippedFile{Name: labeled.name, Reason: "corrupt image: " + err.Error()})
+			continue
+		}
+
+		url, err := storage.UploadBytes(labeled.bytes, cloud.WithContentType(mType.String()))
+		if err != nil {
+			return nil, KindUnknown, err
+		}
+
+		log.Debugf("url: %s", url)
+
+		if err := csvWriter.Write([]string{url, labeled.label}); err != nil {
+			return nil, KindUnknown, err
+		}
+
+		result.images = append(result.images, ImageProfile{
+			Url:       url,
+			Label:     labeled.label,
+			Width:     img.Bounds().Dx(),
+			Height:    img.Bounds().Dy(),
+			ColorMode: colorModeOf(img),
+		})
+	}
+
+	if len(result.images) == 0 {
+		return nil, KindUnknown, errors.New("image archive has no valid image")
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, KindUnknown, err
+	}
+
+	return result, KindImages, nil
+}
@@ -0,0 +1,122 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"nns_back/cloud"
+)
+
+// jsonToCsv converts json lines, or a json array of objects, to csv.
+// Header is the keys of all objects in order of appearance.
+// Nested objects and arrays are written as json text.
+func jsonToCsv(_ cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var (
+		header      []string
+		columnIndex = map[string]int{}
+		rows        []map[string]string
+	)
+
+	readObject := func() error {
+		row := map[string]string{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key, ok := keyToken.(string)
+			if !ok {
+				return fmt.Errorf("unexpected json token: %v", keyToken)
+			}
+
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+
+			if _, ok := columnIndex[key]; !ok {
+				columnIndex[key] = len(header)
+				header = append(header, key)
+			}
+			row[key], err = jsonValueToString(value)
+			if err != nil {
+				return err
+			}
+		}
+
+		// consume '}'
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+
+		rows = append(rows, row)
+		return nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, KindUnknown, err
+		}
+
+		switch token {
+		case json.Delim('['), json.Delim(']'):
+			// json array of objects
+			continue
+		case json.Delim('{'):
+			if err := readObject(); err != nil {
+				return nil, KindUnknown, err
+			}
+		default:
+			return nil, KindUnknown, fmt.Errorf("json dataset must be objects: unexpected token %v", token)
+		}
+	}
+
+	if len(header) == 0 {
+		return nil, KindUnknown, errors.New("json dataset has no columns")
+	}
+
+	records := make([][]string, 0, len(rows)+1)
+	records = append(records, header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for key, value := range row {
+			record[columnIndex[key]] = value
+		}
+		records = append(records, record)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeRecords(buf, records); err != nil {
+		return nil, KindUnknown, err
+	}
+
+	return buf, KindText, nil
+}
+
+func jsonValueToString(value json.RawMessage) (string, error) {
+	value = bytes.TrimSpace(value)
+	switch {
+	case len(value) == 0, bytes.Equal(value, []byte("null")):
+		return "", nil
+	case value[0] == '"':
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	case value[0] == '{', value[0] == '[':
+		buf := new(bytes.Buffer)
+		err := json.Compact(buf, value)
+		return buf.String(), err
+	default:
+		// number, bool
+		return string(value), nil
+	}
+}
@@ -0,0 +1,103 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"io"
+	"nns_back/cloud"
+	"strings"
+)
+
+var _parquetMagic = []byte("PAR1")
+
+func isParquet(raw []byte, _ uint32) bool {
+	return bytes.HasPrefix(raw, _parquetMagic)
+}
+
+// parquetBuffer is an in-memory read only source.ParquetFile.
+type parquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newParquetBuffer(data []byte) *parquetBuffer {
+	return &parquetBuffer{
+		Reader: bytes.NewReader(data),
+		data:   data,
+	}
+}
+
+func (b *parquetBuffer) Open(string) (source.ParquetFile, error) {
+	return newParquetBuffer(b.data), nil
+}
+
+func (b *parquetBuffer) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet buffer is read only")
+}
+
+func (b *parquetBuffer) Write([]byte) (int, error) {
+	return 0, errors.New("parquet buffer is read only")
+}
+
+func (b *parquetBuffer) Close() error {
+	return nil
+}
+
+// parquetToCsv converts a flat parquet file to csv.
+// Nested column names are joined with ".".
+func parquetToCsv(_ cloud.AwsS3Uploader, data []byte) (io.Reader, Kind, error) {
+	pr, err := reader.NewParquetColumnReader(newParquetBuffer(data), 1)
+	if err != nil {
+		return nil, KindUnknown, err
+	}
+	defer pr.ReadStop()
+
+	rowCount := pr.GetNumRows()
+	columnPaths := pr.SchemaHandler.ValueColumns
+
+	header := make([]string, 0, len(columnPaths))
+	columns := make([][]interface{}, 0, len(columnPaths))
+	for i, path := range columnPaths {
+		values, _, _, err := pr.ReadColumnByIndex(int64(i), rowCount)
+		if err != nil {
+			return nil, KindUnknown, err
+		}
+
+		// repeated column has a different number of values from rows
+		if int64(len(values)) != rowCount {
+			return nil, KindUnknown, fmt.Errorf("unsupported repeated parquet column: %s", path)
+		}
+
+		exPath := strings.Split(pr.SchemaHandler.InPathToExPath[path], common.PAR_GO_PATH_DELIMITER)
+		header = append(header, strings.Join(exPath[1:], "."))
+		columns = append(columns, values)
+	}
+
+	buf := new(bytes.Buffer)
+	csvWriter := csv.NewWriter(buf)
+	if err := csvWriter.Write(header); err != nil {
+		return nil, KindUnknown, err
+	}
+
+	record := make([]string, len(columns))
+	for row := int64(0); row < rowCount; row++ {
+		for i, column := range columns {
+			if column[row] == nil {
+				record[i] = ""
+			} else {
+				record[i] = fmt.Sprint(column[row])
+			}
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return nil, KindUnknown, err
+		}
+	}
+
+	csvWriter.Flush()
+	return buf, KindText, csvWriter.Error()
+}
@@ -0,0 +1,240 @@
+package dataset
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"io/ioutil"
+	"nns_back/cloud"
+	"nns_back/log"
+	"os"
+	"testing"
+)
+
+// parse detects the mimetype of data and parses it with the registered parser.
+func parse(t *testing.T, storage cloud.AwsS3Uploader, data []byte) ([][]string, Kind) {
+	t.Helper()
+	assert := assert.New(t)
+
+	p, ok := findParser(mimetype.Detect(data))
+	if !assert.True(ok, "parser not found: %s", mimetype.Detect(data)) {
+		t.FailNow()
+	}
+
+	r, kind, err := p(storage, data)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	assert.NoError(err)
+	return records, kind
+}
+
+func Test_parse_csv(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/csv.csv")
+	assert.NoError(t, err)
+
+	records, kind := parse(t, nil, data)
+	assert.Equal(t, KindText, kind)
+	assert.Len(t, records, 3)
+}
+
+func Test_parse_tsv(t *testing.T) {
+	data := []byte("x\ty\tlabel\n1\thello, world\ta\n2\tbye\tb\n")
+
+	records, kind := parse(t, nil, data)
+	assert.Equal(t, KindText, kind)
+	assert.Equal(t, [][]string{
+		{"x", "y", "label"},
+		{"1", "hello, world", "a"},
+		{"2", "bye", "b"},
+	}, records)
+}
+
+func Test_parse_jsonLines(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "json lines",
+			data: `{"x": 1, "text": "hi", "label": "a"}
+{"x": 2.5, "label": "b", "nested": {"k": [1, 2]}}
+{"x": null, "text": "bye", "label": true}
+`,
+		},
+		{
+			name: "json array",
+			data: `[{"x": 1, "text": "hi", "label": "a"},
+{"x": 2.5, "label": "b", "nested": {"k": [1, 2]}},
+{"x": null, "text": "bye", "label": true}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, kind := parse(t, nil, []byte(tt.data))
+			assert.Equal(t, KindText, kind)
+			assert.Equal(t, [][]string{
+				{"x", "text", "label", "nested"},
+				{"1", "hi", "a", ""},
+				{"2.5", "", "b", `{"k":[1,2]}`},
+				{"", "bye", "true", ""},
+			}, records)
+		})
+	}
+}
+
+func Test_parse_jsonNotObject(t *testing.T) {
+	_, _, err := jsonToCsv(nil, []byte("[1, 2, 3]"))
+	assert.Error(t, err)
+}
+
+type parquetRecord struct {
+	Name  string  `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Age   int32   `parquet:"name=age, type=INT32"`
+	Score float64 `parquet:"name=score, type=DOUBLE"`
+	Label *string `parquet:"name=label, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+func Test_parse_parquet(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	pw, err := writer.NewParquetWriterFromWriter(buf, new(parquetRecord), 1)
+	assert.NoError(err)
+
+	label := "cat"
+	assert.NoError(pw.Write(parquetRecord{Name: "kim", Age: 20, Score: 1.5, Label: &label}))
+	assert.NoError(pw.Write(parquetRecord{Name: "lee", Age: 30, Score: 2}))
+	assert.NoError(pw.WriteStop())
+
+	records, kind := parse(t, nil, buf.Bytes())
+	assert.Equal(KindText, kind)
+	assert.Equal([][]string{
+		{"name", "age", "score", "label"},
+		{"kim", "20", "1.5", "cat"},
+		{"lee", "30", "2", ""},
+	}, records)
+}
+
+func newMockStorage() *cloud.MockAwsS3Uploader {
+	storage := &cloud.MockAwsS3Uploader{}
+	storage.On("UploadBytes", mock.Anything).Return("https://s3.ap-northeast-2.amazonaws.com/dataset/image.png", nil)
+	storage.On("UploadBytes", mock.Anything, mock.Anything).Return("https://s3.ap-northeast-2.amazonaws.com/dataset/image.png", nil)
+	storage.On("UploadBytes", mock.Anything, mock.Anything, mock.Anything).Return("https://s3.ap-northeast-2.amazonaws.com/dataset/data.csv", nil)
+	return storage
+}
+
+func Test_parse_zip(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	data, err := ioutil.ReadFile("testdata/zip.zip")
+	assert.NoError(t, err)
+
+	storage := newMockStorage()
+	records, kind := parse(t, storage, data)
+	assert.Equal(t, KindImages, kind)
+	assert.Equal(t, []string{"url", "label"}, records[0])
+
+	labels := map[string]int{}
+	for _, record := range records[1:] {
+		labels[record[1]]++
+	}
+	assert.Equal(t, map[string]int{"train": 4, "validate": 4}, labels)
+	storage.AssertNumberOfCalls(t, "UploadBytes", 8)
+}
+
+// tarGz archives testdata/zip directory
+func tarGz(t *testing.T, compress bool) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	var w io.Writer = buf
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(buf)
+		w = gzipWriter
+	}
+	tarWriter := tar.NewWriter(w)
+
+	for _, dir := range []string{"train", "validate"} {
+		assert.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "zip/" + dir + "/", Typeflag: tar.TypeDir, Mode: 0755}))
+
+		files, err := ioutil.ReadDir("testdata/zip/" + dir)
+		assert.NoError(t, err)
+		for _, file := range files {
+			data, err := os.ReadFile("testdata/zip/" + dir + "/" + file.Name())
+			assert.NoError(t, err)
+
+			assert.NoError(t, tarWriter.WriteHeader(&tar.Header{
+				Name:     "zip/" + dir + "/" + file.Name(),
+				Typeflag: tar.TypeReg,
+				Mode:     0644,
+				Size:     int64(len(data)),
+			}))
+			_, err = tarWriter.Write(data)
+			assert.NoError(t, err)
+		}
+	}
+
+	assert.NoError(t, tarWriter.Close())
+	if gzipWriter != nil {
+		assert.NoError(t, gzipWriter.Close())
+	}
+	return buf.Bytes()
+}
+
+func Test_parse_tarGz(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	for _, compress := range []bool{true, false} {
+		storage := newMockStorage()
+		records, kind := parse(t, storage, tarGz(t, compress))
+		assert.Equal(t, KindImages, kind)
+		assert.Len(t, records, 9)
+
+		labels := map[string]int{}
+		for _, record := range records[1:] {
+			labels[record[1]]++
+		}
+		assert.Equal(t, map[string]int{"train": 4, "validate": 4}, labels)
+	}
+}
+
+func Test_parse_csvGz(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+	_, err := gzipWriter.Write([]byte("a,b\n1,2\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+
+	records, kind := parse(t, nil, buf.Bytes())
+	assert.Equal(t, KindText, kind)
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+}
+
+func Test_readAllLimited(t *testing.T) {
+	data, err := readAllLimited(bytes.NewReader([]byte("12345")), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("12345"), data)
+
+	_, err = readAllLimited(bytes.NewReader([]byte("123456")), 5)
+	assert.Equal(t, ErrDecompressedTooLarge, err)
+}
+
+func Test_findParser_unsupported(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/zip/train/original_1.png")
+	assert.NoError(t, err)
+
+	_, ok := findParser(mimetype.Detect(data))
+	assert.False(t, ok)
+}
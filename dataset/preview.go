@@ -0,0 +1,239 @@
+package dataset
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"net/http"
+	"nns_back/log"
+	"nns_back/util"
+	"strconv"
+)
+
+const (
+	_maxPreviewPageSize      = 100
+	_defaultSamplesPerLabel  = 5
+	_maxSamplesPerLabel      = 20
+	_samplesPerLabelQueryKey = "samples"
+	_imageDatasetUrlColumn   = "url"
+	_imageDatasetLabelColumn = "label"
+)
+
+type DatasetPreviewDto struct {
+	Kind       Kind            `json:"kind"`
+	Header     []string        `json:"header"`
+	Rows       [][]string      `json:"rows"`
+	Pagination util.Pagination `json:"pagination"`
+
+	// sample image urls per label. images dataset only
+	Samples map[string][]string `json:"samples,omitempty"`
+}
+
+func (h *handler) GetDatasetPreview(w http.ResponseWriter, r *http.Request) {
+	datasetId, _ := util.Atoi64(mux.Vars(r)["datasetId"])
+
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorf("failed to get userId")
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	ds, err := h.datasetRepository.FindByID(datasetId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warnw("invalid datasetId",
+				"requested datasetId", datasetId)
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+			return
+		}
+
+		log.Errorf("failed to FindByID(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	accessible, err := IsAccessible(h.datasetRepository, ds, userId)
+	if err != nil {
+		log.Errorf("failed to find dataset permission: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !accessible {
+		// this dataset is inaccessible
+		log.Warnw("invalid datasetId",
+			"requested datasetId", datasetId)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+		return
+	}
+
+	if !ds.URL.Valid {
+		util.WriteError(w, http.StatusBadRequest, util.ErrDatasetUploadNotComplete)
+		return
+	}
+
+	samplesPerLabel := _defaultSamplesPerLabel
+	if v := r.URL.Query().Get(_samplesPerLabelQueryKey); v != "" {
+		samplesPerLabel, err = strconv.Atoi(v)
+		if err != nil || samplesPerLabel < 0 || samplesPerLabel > _maxSamplesPerLabel {
+			log.Warnw("invalid samples query parameter",
+				"input value", v)
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidQueryParm)
+			return
+		}
+	}
+
+	// use profiled row count if exist, or count while reading
+	rowCount := int64(math.MaxInt32)
+	if profile, err := ds.DecodeProfile(); err == nil {
+		rowCount = profile.RowCount
+	}
+	pagination := util.NewPaginationFromRequest(r, rowCount)
+	if pagination.Limit() < 1 || pagination.Limit() > _maxPreviewPageSize {
+		log.Warnw("invalid preview page size",
+			"page size", pagination.Limit())
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidQueryParm)
+		return
+	}
+
+	resp, err := h.httpClient.Get(ds.URL.String)
+	if err != nil {
+		log.Errorw("failed to http get",
+			"error", err,
+			"url", ds.URL)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Errorw("failed to get dataset",
+			"status code", resp.StatusCode,
+			"url", ds.URL)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if ds.Kind != KindImages {
+		samplesPerLabel = 0
+	}
+	preview, err := previewCsv(resp.Body, pagination.Offset(), pagination.Limit(), samplesPerLabel)
+	if err != nil {
+		log.Errorw("failed to preview csv",
+			"error", err,
+			"dataset.id", ds.ID)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	responseBody := DatasetPreviewDto{
+		Kind:       ds.Kind,
+		Header:     preview.header,
+		Rows:       preview.rows,
+		Pagination: util.NewPagination(pagination.CurPage, pagination.PageSize, preview.rowCount),
+		Samples:    preview.samples,
+	}
+	util.WriteJson(w, http.StatusOK, responseBody)
+}
+
+type csvPreview struct {
+	header   []string
+	rows     [][]string
+	rowCount int64
+	samples  map[string][]string
+}
+
+// previewCsv reads the header and rows in [offset, offset+limit) of the csv.
+// If samplesPerLabel is positive, it also collects the first image urls of each label.
+func previewCsv(r io.Reader, offset, limit, samplesPerLabel int) (csvPreview, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return csvPreview{header: []string{}, rows: [][]string{}}, nil
+	}
+	if err != nil {
+		return csvPreview{}, err
+	}
+
+	preview := csvPreview{
+		header: header,
+		rows:   make([][]string, 0, limit),
+	}
+
+	urlIndex, labelIndex := indexOf(header, _imageDatasetUrlColumn), indexOf(header, _imageDatasetLabelColumn)
+	if samplesPerLabel > 0 && urlIndex >= 0 && labelIndex >= 0 {
+		preview.samples = make(map[string][]string)
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return csvPreview{}, err
+		}
+
+		if preview.rowCount >= int64(offset) && len(preview.rows) < limit {
+			preview.rows = append(preview.rows, record)
+		}
+		preview.rowCount++
+
+		if preview.samples != nil && urlIndex < len(record) && labelIndex < len(record) {
+			label := record[labelIndex]
+			if len(preview.samples[label]) < samplesPerLabel {
+				preview.samples[label] = append(preview.samples[label], record[urlIndex])
+			}
+		}
+	}
+
+	return preview, nil
+}
+
+// SampleRows reads the header and the first limit rows of the csv at url.
+func SampleRows(httpClient *http.Client, url string, limit int) ([]string, [][]string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Get(url: %s)", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to get dataset: response status code : %d", resp.StatusCode)
+	}
+
+	return readSampleRows(resp.Body, limit)
+}
+
+func readSampleRows(r io.Reader, limit int) ([]string, [][]string, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return []string{}, [][]string{}, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read csv")
+	}
+
+	rows := make([][]string, 0, limit)
+	for len(rows) < limit {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to read csv")
+		}
+		rows = append(rows, record)
+	}
+
+	return header, rows, nil
+}
@@ -0,0 +1,83 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func Test_previewCsv(t *testing.T) {
+	const data = `url,label
+a1.png,a
+a2.png,a
+b1.png,b
+a3.png,a
+b2.png,b
+`
+
+	tests := []struct {
+		name            string
+		offset          int
+		limit           int
+		samplesPerLabel int
+		wantRows        [][]string
+		wantSamples     map[string][]string
+	}{
+		{
+			name:     "first page",
+			offset:   0,
+			limit:    2,
+			wantRows: [][]string{{"a1.png", "a"}, {"a2.png", "a"}},
+		},
+		{
+			name:     "last page",
+			offset:   4,
+			limit:    2,
+			wantRows: [][]string{{"b2.png", "b"}},
+		},
+		{
+			name:     "out of range",
+			offset:   10,
+			limit:    2,
+			wantRows: [][]string{},
+		},
+		{
+			name:            "samples per label",
+			offset:          0,
+			limit:           1,
+			samplesPerLabel: 2,
+			wantRows:        [][]string{{"a1.png", "a"}},
+			wantSamples: map[string][]string{
+				"a": {"a1.png", "a2.png"},
+				"b": {"b1.png", "b2.png"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			preview, err := previewCsv(strings.NewReader(data), tt.offset, tt.limit, tt.samplesPerLabel)
+			assert.NoError(err)
+			assert.Equal([]string{"url", "label"}, preview.header)
+			assert.EqualValues(5, preview.rowCount)
+			assert.Equal(tt.wantRows, preview.rows)
+			assert.Equal(tt.wantSamples, preview.samples)
+		})
+	}
+}
+
+func Test_readSampleRows(t *testing.T) {
+	assert := assert.New(t)
+
+	header, rows, err := readSampleRows(strings.NewReader("x,y\n1,a\n2\n3,c\n"), 2)
+	assert.NoError(err)
+	assert.Equal([]string{"x", "y"}, header)
+	assert.Equal([][]string{{"1", "a"}, {"2"}}, rows)
+
+	header, rows, err = readSampleRows(strings.NewReader(""), 2)
+	assert.NoError(err)
+	assert.Empty(header)
+	assert.Empty(rows)
+}
@@ -0,0 +1,252 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"nns_back/util"
+	"strconv"
+	"strings"
+)
+
+// Profile is the schema and statistics of a parsed csv dataset.
+type Profile struct {
+	RowCount int64           `json:"rowCount"`
+	Columns  []ColumnProfile `json:"columns"`
+
+	// image dataset only
+	ImageSummary *ImageSummary `json:"imageSummary,omitempty"`
+	// the first _maxSkippedFiles skipped files. the count of all is in ImageSummary
+	Skipped []SkippedFile `json:"skipped,omitempty"`
+}
+
+type ColumnType string
+
+const (
+	ColumnTypeNumeric     ColumnType = "NUMERIC"
+	ColumnTypeCategorical ColumnType = "CATEGORICAL"
+	ColumnTypeText        ColumnType = "TEXT"
+	ColumnTypeImageUrl    ColumnType = "IMAGE_URL"
+)
+
+type ColumnProfile struct {
+	Name      string     `json:"name"`
+	Type      ColumnType `json:"type"`
+	NullCount int64      `json:"nullCount"`
+
+	// numeric column only
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+	Mean *float64 `json:"mean,omitempty"`
+
+	// value counts. recorded only if the column has few distinct values,
+	// so it is the label distribution when this column is used as a label.
+	Distribution map[string]int64 `json:"distribution,omitempty"`
+}
+
+const (
+	_maxDistributionSize = 100
+	_maxCategoricalRatio = 0.5
+	_maxSkippedFiles     = 100
+)
+
+var ErrProfileNotExist = errors.New("dataset profile not exist")
+
+// Column finds a column profile by name.
+func (p Profile) Column(name string) (ColumnProfile, bool) {
+	for _, c := range p.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return ColumnProfile{}, false
+}
+
+// ColumnNames returns names of all columns in order.
+func (p Profile) ColumnNames() []string {
+	names := make([]string, 0, len(p.Columns))
+	for _, c := range p.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// DecodeProfile returns the stored profile of the dataset.
+// It returns ErrProfileNotExist if the dataset is not profiled yet.
+func (d Dataset) DecodeProfile() (Profile, error) {
+	if !d.Profile.Valid {
+		return Profile{}, ErrProfileNotExist
+	}
+
+	var profile Profile
+	err := json.Unmarshal(d.Profile.Json, &profile)
+	return profile, err
+}
+
+func (p Profile) toNullJson() (util.NullJson, error) {
+	jsoned, err := json.Marshal(p)
+	if err != nil {
+		return util.NullJson{}, err
+	}
+	return util.NullJson{Json: jsoned, Valid: true}, nil
+}
+
+type columnProfiler struct {
+	name string
+
+	count      int64 // not null count
+	nullCount  int64
+	notNumeric bool
+	notUrl     bool
+	min        float64
+	max        float64
+	sum        float64
+	values     map[string]int64 // nil if distinct values exceed _maxDistributionSize
+}
+
+func (c *columnProfiler) add(value string) {
+	value = strings.TrimSpace(value)
+	if IsNull(value) {
+		c.nullCount++
+		return
+	}
+	c.count++
+
+	if !c.notNumeric {
+		if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) {
+			if c.count == 1 || f < c.min {
+				c.min = f
+			}
+			if c.count == 1 || f > c.max {
+				c.max = f
+			}
+			c.sum += f
+		} else {
+			c.notNumeric = true
+		}
+	}
+
+	if !c.notUrl && !isImageUrl(value) {
+		c.notUrl = true
+	}
+
+	if c.values != nil {
+		c.values[value]++
+		if len(c.values) > _maxDistributionSize {
+			c.values = nil
+		}
+	}
+}
+
+func (c *columnProfiler) profile() ColumnProfile {
+	result := ColumnProfile{
+		Name:         c.name,
+		NullCount:    c.nullCount,
+		Distribution: c.values,
+	}
+
+	switch {
+	case c.count == 0:
+		result.Type = ColumnTypeText
+	case !c.notNumeric:
+		result.Type = ColumnTypeNumeric
+		mean := c.sum / float64(c.count)
+		result.Min, result.Max, result.Mean = &c.min, &c.max, &mean
+	case !c.notUrl:
+		result.Type = ColumnTypeImageUrl
+		result.Distribution = nil
+	case c.values != nil && float64(len(c.values)) <= float64(c.count)*_maxCategoricalRatio:
+		result.Type = ColumnTypeCategorical
+	default:
+		result.Type = ColumnTypeText
+	}
+
+	return result
+}
+
+// IsNull reports whether the csv value is a missing value.
+func IsNull(value string) bool {
+	switch strings.ToLower(value) {
+	case "", "null", "nan", "na", "n/a":
+		return true
+	}
+	return false
+}
+
+func isImageUrl(value string) bool {
+	lower := strings.ToLower(value)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return false
+	}
+
+	for _, ext := range []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// profileCsv reads whole csv records from r and profiles each column.
+// The first record is the header.
+func profileCsv(r io.Reader) (Profile, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return Profile{}, errors.New("empty csv")
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+
+	columns := make([]*columnProfiler, 0, len(header))
+	for _, name := range header {
+		columns = append(columns, &columnProfiler{
+			name:   name,
+			values: make(map[string]int64),
+		})
+	}
+
+	var rowCount int64
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Profile{}, err
+		}
+		rowCount++
+
+		for i, column := range columns {
+			if i < len(record) {
+				column.add(record[i])
+			} else {
+				column.add("")
+			}
+		}
+	}
+
+	profile := Profile{
+		RowCount: rowCount,
+		Columns:  make([]ColumnProfile, 0, len(columns)),
+	}
+	for _, column := range columns {
+		profile.Columns = append(profile.Columns, column.profile())
+	}
+
+	return profile, nil
+}
+
+// setImages summarizes the images of the image dataset.
+func (p *Profile) setImages(images []ImageProfile, skipped []SkippedFile) {
+	p.ImageSummary = summarizeImages(images, skipped)
+	if len(skipped) > _maxSkippedFiles {
+		skipped = skipped[:_maxSkippedFiles]
+	}
+	p.Skipped = skipped
+}
@@ -0,0 +1,72 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func Test_profileCsv(t *testing.T) {
+	assert := assert.New(t)
+
+	const data = `age,city,comment,image,label
+10,seoul,this is a long comment,https://s3.ap-northeast-2.amazonaws.com/dataset/a.png,1
+20,busan,another different comment,https://s3.ap-northeast-2.amazonaws.com/dataset/b.png,0
+,seoul,yet another comment,https://s3.ap-northeast-2.amazonaws.com/dataset/c.jpg,1
+30,seoul,the last comment,https://s3.ap-northeast-2.amazonaws.com/dataset/d.jpeg,1
+`
+
+	profile, err := profileCsv(strings.NewReader(data))
+	assert.NoError(err)
+	assert.EqualValues(4, profile.RowCount)
+	assert.Equal([]string{"age", "city", "comment", "image", "label"}, profile.ColumnNames())
+
+	age, ok := profile.Column("age")
+	assert.True(ok)
+	assert.Equal(ColumnTypeNumeric, age.Type)
+	assert.EqualValues(1, age.NullCount)
+	assert.Equal(10.0, *age.Min)
+	assert.Equal(30.0, *age.Max)
+	assert.Equal(20.0, *age.Mean)
+
+	city, _ := profile.Column("city")
+	assert.Equal(ColumnTypeCategorical, city.Type)
+	assert.Equal(map[string]int64{"seoul": 3, "busan": 1}, city.Distribution)
+
+	comment, _ := profile.Column("comment")
+	assert.Equal(ColumnTypeText, comment.Type)
+
+	image, _ := profile.Column("image")
+	assert.Equal(ColumnTypeImageUrl, image.Type)
+	assert.Nil(image.Distribution)
+
+	label, _ := profile.Column("label")
+	assert.Equal(ColumnTypeNumeric, label.Type)
+	assert.Equal(map[string]int64{"1": 3, "0": 1}, label.Distribution)
+
+	_, ok = profile.Column("not exist")
+	assert.False(ok)
+}
+
+func Test_profileCsv_empty(t *testing.T) {
+	_, err := profileCsv(strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestDataset_DecodeProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Dataset{}.DecodeProfile()
+	assert.Equal(ErrProfileNotExist, err)
+
+	profile, err := profileCsv(strings.NewReader("a,b\n1,x\n"))
+	assert.NoError(err)
+
+	ds := Dataset{}
+	ds.Profile, err = profile.toNullJson()
+	assert.NoError(err)
+
+	decoded, err := ds.DecodeProfile()
+	assert.NoError(err)
+	assert.Equal(profile, decoded)
+}
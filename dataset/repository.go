@@ -5,19 +5,39 @@ type Repository interface {
 	FindByID(id int64) (Dataset, error)
 	Insert(dataset Dataset) (int64, error)
 	Update(id int64, dataset Dataset) error
-	Delete(id int64) error
+	// UpdateToLatestVersion updates the dataset like Update, mirroring its latest uploaded version.
+	UpdateToLatestVersion(id int64, dataset Dataset) error
+	Delete(id int64) (DeleteResult, error)
 
 	// dataset list
-	CountPublic(userId int64) (int64, error)
-	//CountPublicByUserName(userName string) (int64, error)
-	//CountPublicByUserNameLike(userName string) (int64, error)
-	//CountPublicByTitle(title string) (int64, error)
-	//CountPublicByTitleLike(title string) (int64, error)
-	FindAllPublic(userId int64, offset, limit int) ([]Dataset, error)
-	//FindAllPublicByUserName(userId int64, userName string, offset, limit int) ([]Dataset, error)
-	//FindAllPublicByUserNameLike(userId int64, userName string, offset, limit int) ([]Dataset, error)
-	//FindAllPublicByTitle(userId int64, title string, offset, limit int) ([]Dataset, error)
-	//FindAllPublicByTitleLike(userId int64, title string, offset, limit int) ([]Dataset, error)
+	CountPublicBy(userId int64, query CatalogQuery) (int64, error)
+	FindAllPublicBy(userId int64, query CatalogQuery, offset, limit int) ([]Dataset, error)
+
+	// dataset versions
+	InsertVersion(version Version) (int64, error)
+	UpdateVersion(version Version) error
+	FindVersionByID(id int64) (Version, error)
+	FindLatestVersion(datasetId int64) (Version, error)
+	FindVersionsByDatasetId(datasetId int64) ([]Version, error)
+	InsertVersionObject(object VersionObject) error
+	// DeleteUnreferencedObject deletes the object at url by deleteObject if no version references it.
+	// It returns whether the object is deleted.
+	DeleteUnreferencedObject(url string, deleteObject func(url string) error) (bool, error)
+	FindNormalizedUrl(versionId int64, imageOption string) (string, error)
+	InsertNormalizedUrl(versionId int64, imageOption string, url string) error
+
+	// dataset tags
+	FindTagsByDatasetIds(datasetIds []int64) (map[int64][]string, error)
+	ReplaceTags(datasetId int64, tags []string) error
+
+	// dataset access control
+	FindACLs(datasetId int64) ([]ACL, error)
+	GrantACL(acl ACL) error
+	RevokeACL(datasetId int64, aclId int64) error
+	FindGrantedPermission(userId int64, datasetId int64) (Permission, error)
+	IsUsableBy(userId int64, datasetId int64) (bool, error)
+	CountActiveDatasetConfigs(datasetId int64) (int64, error)
+	RefreshDatasetLibraryUsable(userId int64) error
 
 	// dataset library features
 	FindDatasetFromDatasetLibraryByUserId(userId int64, offset, limit int) ([]Dataset, error)
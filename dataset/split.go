@@ -0,0 +1,211 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"nns_back/cloud"
+)
+
+// SplitOption is how a parsed dataset is divided into train, validation and test sets.
+// Ratios must sum to 1. If Stratify is true, every split keeps the label distribution
+// of the whole dataset. The same Seed always produces the same split.
+type SplitOption struct {
+	TrainRatio float64
+	ValidRatio float64
+	TestRatio  float64
+	Stratify   bool
+	Label      string
+	Seed       int64
+}
+
+// SplitResult holds the storage urls of the split dataset files.
+// ValidUrl and TestUrl are empty if the split has no rows.
+type SplitResult struct {
+	TrainUrl string
+	ValidUrl string
+	TestUrl  string
+}
+
+const _splitRatioEpsilon = 1e-6
+
+var ErrInvalidSplitRatio = errors.New("invalid split ratio")
+
+func (o SplitOption) Validate() error {
+	for _, ratio := range []float64{o.TrainRatio, o.ValidRatio, o.TestRatio} {
+		if ratio < 0 || ratio > 1 {
+			return ErrInvalidSplitRatio
+		}
+	}
+
+	if o.TrainRatio == 0 {
+		return ErrInvalidSplitRatio
+	}
+
+	if math.Abs(o.TrainRatio+o.ValidRatio+o.TestRatio-1) > _splitRatioEpsilon {
+		return ErrInvalidSplitRatio
+	}
+
+	return nil
+}
+
+// SplitToStorage downloads the parsed csv dataset at url, splits it
+// and uploads each split to storage.
+func SplitToStorage(httpClient *http.Client, storage cloud.AwsS3Uploader, url string, option SplitOption) (SplitResult, error) {
+	records, err := downloadRecords(httpClient, url)
+	if err != nil {
+		return SplitResult{}, err
+	}
+
+	train, valid, test, err := split(records, option)
+	if err != nil {
+		return SplitResult{}, err
+	}
+
+	var result SplitResult
+	if result.TrainUrl, err = uploadRecords(storage, train); err != nil {
+		return SplitResult{}, err
+	}
+	if len(valid) > 1 {
+		if result.ValidUrl, err = uploadRecords(storage, valid); err != nil {
+			return SplitResult{}, err
+		}
+	}
+	if len(test) > 1 {
+		if result.TestUrl, err = uploadRecords(storage, test); err != nil {
+			return SplitResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+func downloadRecords(httpClient *http.Client, url string) ([][]string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Get(url: %s)", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get dataset: response status code : %d", resp.StatusCode)
+	}
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read csv")
+	}
+	return records, nil
+}
+
+func uploadRecords(storage cloud.AwsS3Uploader, records [][]string) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := writeRecords(buf, records); err != nil {
+		return "", err
+	}
+
+	return storage.UploadBytes(buf.Bytes(), cloud.WithContentType(_csv), cloud.WithExtension("csv"))
+}
+
+func writeRecords(w io.Writer, records [][]string) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.WriteAll(records); err != nil {
+		return err
+	}
+	return csvWriter.Error()
+}
+
+// split divides records (header first) into train, validation and test records.
+// Every result keeps the header as its first record.
+func split(records [][]string, option SplitOption) (train, valid, test [][]string, err error) {
+	if err := option.Validate(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(records) < 2 {
+		return nil, nil, nil, errors.New("dataset has no rows")
+	}
+
+	header, rows := records[0], records[1:]
+
+	// group row indexes. without stratify, all rows are in one group
+	var groups [][]int
+	if option.Stratify {
+		labelIndex := indexOf(header, option.Label)
+		if labelIndex < 0 {
+			return nil, nil, nil, fmt.Errorf("label %q not exist in dataset", option.Label)
+		}
+
+		groupIndex := make(map[string]int)
+		for i, row := range rows {
+			if labelIndex >= len(row) {
+				return nil, nil, nil, fmt.Errorf("row %d has no label column", i+1)
+			}
+
+			gi, ok := groupIndex[row[labelIndex]]
+			if !ok {
+				gi = len(groups)
+				groupIndex[row[labelIndex]] = gi
+				groups = append(groups, nil)
+			}
+			groups[gi] = append(groups[gi], i)
+		}
+	} else {
+		all := make([]int, len(rows))
+		for i := range all {
+			all[i] = i
+		}
+		groups = [][]int{all}
+	}
+
+	rng := rand.New(rand.NewSource(option.Seed))
+
+	train = [][]string{header}
+	valid = [][]string{header}
+	test = [][]string{header}
+	for _, group := range groups {
+		rng.Shuffle(len(group), func(i, j int) {
+			group[i], group[j] = group[j], group[i]
+		})
+
+		trainCount := int(math.Round(float64(len(group)) * option.TrainRatio))
+		validCount := int(math.Round(float64(len(group)) * option.ValidRatio))
+		if trainCount > len(group) {
+			trainCount = len(group)
+		}
+		// a small stratum is rounded down to no train row otherwise, and its label is never trained
+		if trainCount == 0 {
+			trainCount = 1
+		}
+		if trainCount+validCount > len(group) || option.TestRatio == 0 {
+			validCount = len(group) - trainCount
+		}
+
+		for i, rowIndex := range group {
+			switch {
+			case i < trainCount:
+				train = append(train, rows[rowIndex])
+			case i < trainCount+validCount:
+				valid = append(valid, rows[rowIndex])
+			default:
+				test = append(test, rows[rowIndex])
+			}
+		}
+	}
+
+	return train, valid, test, nil
+}
+
+func indexOf(header []string, column string) int {
+	for i, v := range header {
+		if v == column {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,139 @@
+package dataset
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func generateRecords(n int, labels ...string) [][]string {
+	records := [][]string{{"x", "label"}}
+	for i := 0; i < n; i++ {
+		records = append(records, []string{fmt.Sprint(i), labels[i%len(labels)]})
+	}
+	return records
+}
+
+func Test_split(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   [][]string
+		option    SplitOption
+		wantTrain int
+		wantValid int
+		wantTest  int
+		wanterr   bool
+	}{
+		{
+			name:      "70/20/10",
+			records:   generateRecords(100, "a", "b"),
+			option:    SplitOption{TrainRatio: 0.7, ValidRatio: 0.2, TestRatio: 0.1, Seed: 1},
+			wantTrain: 70,
+			wantValid: 20,
+			wantTest:  10,
+		},
+		{
+			name:      "stratify",
+			records:   generateRecords(100, "a", "b", "c", "d"),
+			option:    SplitOption{TrainRatio: 0.8, ValidRatio: 0.2, Stratify: true, Label: "label", Seed: 1},
+			wantTrain: 80,
+			wantValid: 20,
+			wantTest:  0,
+		},
+		{
+			name:      "small stratum",
+			records:   generateRecords(12, "a", "a", "a", "a", "a", "a", "a", "a", "a", "a", "a", "b"),
+			option:    SplitOption{TrainRatio: 0.2, ValidRatio: 0.4, TestRatio: 0.4, Stratify: true, Label: "label", Seed: 1},
+			wantTrain: 3,
+			wantValid: 4,
+			wantTest:  5,
+		},
+		{
+			name:      "single row",
+			records:   generateRecords(1, "a"),
+			option:    SplitOption{TrainRatio: 0.1, ValidRatio: 0.9, Seed: 1},
+			wantTrain: 1,
+			wantValid: 0,
+			wantTest:  0,
+		},
+		{
+			name:    "ratio sum is not 1",
+			records: generateRecords(10, "a"),
+			option:  SplitOption{TrainRatio: 0.5, ValidRatio: 0.2},
+			wanterr: true,
+		},
+		{
+			name:    "stratify label not exist",
+			records: generateRecords(10, "a"),
+			option:  SplitOption{TrainRatio: 1, Stratify: true, Label: "y"},
+			wanterr: true,
+		},
+		{
+			name:    "no rows",
+			records: generateRecords(0, "a"),
+			option:  SplitOption{TrainRatio: 1},
+			wanterr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			train, valid, test, err := split(tt.records, tt.option)
+			if tt.wanterr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+
+			// header is in every split
+			assert.Equal(tt.records[0], train[0])
+			assert.Equal(tt.records[0], valid[0])
+			assert.Equal(tt.records[0], test[0])
+
+			assert.Len(train, tt.wantTrain+1)
+			assert.Len(valid, tt.wantValid+1)
+			assert.Len(test, tt.wantTest+1)
+		})
+	}
+}
+
+func Test_split_deterministic(t *testing.T) {
+	assert := assert.New(t)
+	option := SplitOption{TrainRatio: 0.6, ValidRatio: 0.2, TestRatio: 0.2, Stratify: true, Label: "label", Seed: 42}
+
+	train1, valid1, test1, err := split(generateRecords(50, "a", "b"), option)
+	assert.NoError(err)
+	train2, valid2, test2, err := split(generateRecords(50, "a", "b"), option)
+	assert.NoError(err)
+
+	assert.Equal(train1, train2)
+	assert.Equal(valid1, valid2)
+	assert.Equal(test1, test2)
+
+	option.Seed = 43
+	train3, _, _, err := split(generateRecords(50, "a", "b"), option)
+	assert.NoError(err)
+	assert.NotEqual(train1, train3)
+}
+
+func Test_split_stratifyKeepsDistribution(t *testing.T) {
+	assert := assert.New(t)
+
+	// 75% a, 25% b
+	records := generateRecords(80, "a", "a", "a", "b")
+	option := SplitOption{TrainRatio: 0.5, ValidRatio: 0.5, Stratify: true, Label: "label", Seed: 7}
+
+	train, valid, _, err := split(records, option)
+	assert.NoError(err)
+
+	for _, records := range [][][]string{train[1:], valid[1:]} {
+		count := map[string]int{}
+		for _, record := range records {
+			count[record[1]]++
+		}
+		assert.Equal(30, count["a"])
+		assert.Equal(10, count["b"])
+	}
+}
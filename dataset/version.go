@@ -0,0 +1,130 @@
+package dataset
+
+import (
+	"database/sql"
+	"github.com/pkg/errors"
+	"io"
+	"mime/multipart"
+	"nns_back/cloud"
+	"nns_back/util"
+	"time"
+)
+
+// Version is an immutable snapshot of an uploaded dataset file.
+// Every upload creates a new version and the dataset mirrors its latest version.
+type Version struct {
+	ID         int64          `db:"id"`
+	DatasetID  int64          `db:"dataset_id"`
+	VersionNo  int64          `db:"version_no"`
+	URL        sql.NullString `db:"url"`
+	OriginURL  sql.NullString `db:"origin_url"`
+	Kind       Kind           `db:"kind"`
+	Size       int64          `db:"size"`
+	Profile    util.NullJson  `db:"profile"`
+	Status     string         `db:"status"` // UPLOADING -> EXIST -> DELETED, UPLOADING -> FAILED
+	CreateTime time.Time      `db:"create_time"`
+	UpdateTime time.Time      `db:"update_time"`
+}
+
+var ErrVersionNotExist = errors.New("dataset version not exist")
+
+// Snapshot returns the dataset as of the version.
+func (v Version) Snapshot(ds Dataset) Dataset {
+	ds.URL = v.URL
+	ds.OriginURL = v.OriginURL
+	ds.Kind = v.Kind
+	ds.Size = v.Size
+	ds.Profile = v.Profile
+	return ds
+}
+
+// FindSnapshot finds the dataset as of the version with versionId,
+// or as of the latest version if versionId is not valid.
+// Datasets uploaded before versioning have no version, so they are returned as they are
+// with an invalid version id.
+func FindSnapshot(repo Repository, datasetId int64, versionId sql.NullInt64) (Dataset, sql.NullInt64, error) {
+	ds, err := repo.FindByID(datasetId)
+	if err != nil {
+		return Dataset{}, sql.NullInt64{}, err
+	}
+
+	var version Version
+	if versionId.Valid {
+		version, err = repo.FindVersionByID(versionId.Int64)
+		if err == sql.ErrNoRows || (err == nil && (version.DatasetID != ds.ID || version.Status != EXIST)) {
+			return Dataset{}, sql.NullInt64{}, ErrVersionNotExist
+		}
+	} else {
+		version, err = repo.FindLatestVersion(ds.ID)
+		if err == sql.ErrNoRows {
+			return ds, sql.NullInt64{}, nil
+		}
+	}
+	if err != nil {
+		return Dataset{}, sql.NullInt64{}, err
+	}
+
+	return version.Snapshot(ds), sql.NullInt64{Int64: version.ID, Valid: true}, nil
+}
+
+// VersionObject is an object referenced by a dataset version.
+type VersionObject struct {
+	VersionId int64  `db:"version_id"`
+	Url       string `db:"url"`
+	Size      int64  `db:"size"`
+	// the user who derived the object from the version, such as the split dataset of the user's train,
+	// whose storage usage counts the object. not valid if the object is uploaded as the version.
+	UserId sql.NullInt64 `db:"user_id"`
+}
+
+// versionUploader uploads the objects of a dataset version,
+// each of which is referenced by the version before it is stored.
+type versionUploader struct {
+	cloud.AwsS3Uploader
+	datasetRepo Repository
+	versionId   int64
+	userId      sql.NullInt64
+}
+
+// NewVersionUploader returns the uploader of the files derived from the version for the user,
+// such as split or normalized datasets, so that they are deleted with the version
+// and counted in the storage usage of the user.
+// The storage itself is returned if versionId is not valid.
+func NewVersionUploader(storage cloud.AwsS3Uploader, datasetRepo Repository, versionId sql.NullInt64, userId int64) cloud.AwsS3Uploader {
+	if !versionId.Valid {
+		return storage
+	}
+	return versionUploader{
+		AwsS3Uploader: storage,
+		datasetRepo:   datasetRepo,
+		versionId:     versionId.Int64,
+		userId:        sql.NullInt64{Int64: userId, Valid: true},
+	}
+}
+
+func (u versionUploader) UploadFile(file multipart.File, options ...cloud.Option) (string, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return u.AwsS3Uploader.UploadFile(file, append(options, u.reference(size))...)
+}
+
+func (u versionUploader) UploadBytes(file []byte, options ...cloud.Option) (string, error) {
+	return u.AwsS3Uploader.UploadBytes(file, append(options, u.reference(int64(len(file))))...)
+}
+
+func (u versionUploader) reference(size int64) cloud.Option {
+	return cloud.WithReference(func(url string) error {
+		return u.datasetRepo.InsertVersionObject(VersionObject{
+			VersionId: u.versionId,
+			Url:       url,
+			Size:      size,
+			UserId:    u.userId,
+		})
+	})
+}
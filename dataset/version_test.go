@@ -0,0 +1,151 @@
+package dataset
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"nns_back/log"
+	"testing"
+)
+
+// versionRepository is a Repository with in-memory datasets and versions.
+type versionRepository struct {
+	Repository
+	datasets map[int64]Dataset
+	versions map[int64]Version
+}
+
+func (r versionRepository) FindByID(id int64) (Dataset, error) {
+	ds, ok := r.datasets[id]
+	if !ok {
+		return Dataset{}, sql.ErrNoRows
+	}
+	return ds, nil
+}
+
+func (r versionRepository) FindVersionByID(id int64) (Version, error) {
+	version, ok := r.versions[id]
+	if !ok {
+		return Version{}, sql.ErrNoRows
+	}
+	return version, nil
+}
+
+func (r versionRepository) FindLatestVersion(datasetId int64) (Version, error) {
+	var latest *Version
+	for _, version := range r.versions {
+		version := version
+		if version.DatasetID == datasetId && version.Status == EXIST && (latest == nil || version.VersionNo > latest.VersionNo) {
+			latest = &version
+		}
+	}
+	if latest == nil {
+		return Version{}, sql.ErrNoRows
+	}
+	return *latest, nil
+}
+
+func TestFindSnapshot(t *testing.T) {
+	repo := versionRepository{
+		datasets: map[int64]Dataset{
+			1: {ID: 1, URL: sql.NullString{String: "v2.csv", Valid: true}},
+			2: {ID: 2, URL: sql.NullString{String: "legacy.csv", Valid: true}},
+		},
+		versions: map[int64]Version{
+			10: {ID: 10, DatasetID: 1, VersionNo: 1, URL: sql.NullString{String: "v1.csv", Valid: true}, Kind: KindText, Status: EXIST},
+			11: {ID: 11, DatasetID: 1, VersionNo: 2, URL: sql.NullString{String: "v2.csv", Valid: true}, Kind: KindText, Status: EXIST},
+			12: {ID: 12, DatasetID: 1, VersionNo: 3, Status: UPLOADING},
+			20: {ID: 20, DatasetID: 3, VersionNo: 1, Status: EXIST},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		datasetId   int64
+		versionId   sql.NullInt64
+		wantUrl     string
+		wantVersion sql.NullInt64
+		wantErr     error
+	}{
+		{
+			name:        "latest",
+			datasetId:   1,
+			wantUrl:     "v2.csv",
+			wantVersion: sql.NullInt64{Int64: 11, Valid: true},
+		},
+		{
+			name:        "pinned",
+			datasetId:   1,
+			versionId:   sql.NullInt64{Int64: 10, Valid: true},
+			wantUrl:     "v1.csv",
+			wantVersion: sql.NullInt64{Int64: 10, Valid: true},
+		},
+		{
+			name:      "uploading version",
+			datasetId: 1,
+			versionId: sql.NullInt64{Int64: 12, Valid: true},
+			wantErr:   ErrVersionNotExist,
+		},
+		{
+			name:      "version of another dataset",
+			datasetId: 1,
+			versionId: sql.NullInt64{Int64: 20, Valid: true},
+			wantErr:   ErrVersionNotExist,
+		},
+		{
+			name:      "version not exist",
+			datasetId: 1,
+			versionId: sql.NullInt64{Int64: 99, Valid: true},
+			wantErr:   ErrVersionNotExist,
+		},
+		{
+			name:      "legacy dataset without versions",
+			datasetId: 2,
+			wantUrl:   "legacy.csv",
+		},
+		{
+			name:      "dataset not exist",
+			datasetId: 9,
+			wantErr:   sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, versionId, err := FindSnapshot(repo, tt.datasetId, tt.versionId)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.datasetId, ds.ID)
+			assert.Equal(t, tt.wantUrl, ds.URL.String)
+			assert.Equal(t, tt.wantVersion, versionId)
+		})
+	}
+}
+
+func (r versionRepository) UpdateVersion(version Version) error {
+	r.versions[version.ID] = version
+	return nil
+}
+
+// brokenFile is a multipart.File failing every read.
+type brokenFile struct{}
+
+func (brokenFile) Read(p []byte) (int, error)                   { return 0, errors.New("broken") }
+func (brokenFile) ReadAt(p []byte, off int64) (int, error)      { return 0, errors.New("broken") }
+func (brokenFile) Seek(offset int64, whence int) (int64, error) { return 0, errors.New("broken") }
+func (brokenFile) Close() error                                 { return nil }
+
+func Test_uploadAsync_failed(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	version := Version{ID: 1, DatasetID: 1, VersionNo: 1, Status: UPLOADING}
+	repo := versionRepository{versions: map[int64]Version{1: version}}
+
+	uploadAsync(nil, brokenFile{}, repo, Dataset{ID: 1}, version)
+	assert.Equal(t, FAILED, repo.versions[1].Status)
+}
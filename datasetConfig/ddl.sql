@@ -4,10 +4,25 @@ create table nns.dataset_config
         primary key,
     project_id bigint not null,
     dataset_id bigint not null,
+    dataset_version_id bigint null,
     name varchar(200) not null,
     shuffle tinyint(1) not null,
     label varchar(1024) not null,
     normalization_method varchar(1024) null,
+    split_usage tinyint(1) default 0 not null,
+    split_train_ratio double default 1 not null,
+    split_valid_ratio double default 0 not null,
+    split_test_ratio double default 0 not null,
+    split_stratify tinyint(1) default 0 not null,
+    split_seed bigint default 0 not null,
+    image_usage tinyint(1) default 0 not null,
+    image_width int default 0 not null,
+    image_height int default 0 not null,
+    image_color_mode varchar(20) default '' not null,
+    image_format varchar(20) default '' not null,
+    pipeline json null,
+    valid tinyint(1) default 1 not null,
+    invalid_reason varchar(20) null,
     status varchar(10) not null,
     create_time datetime default CURRENT_TIMESTAMP not null,
     update_time datetime default CURRENT_TIMESTAMP not null on update CURRENT_TIMESTAMP
@@ -16,3 +31,8 @@ create table nns.dataset_config
 create index dataset_config__index_project_id
     on nns.dataset_config (project_id);
 
+create index dataset_config__index_dataset_id
+    on nns.dataset_config (dataset_id);
+
+create index dataset_config__index_dataset_version_id
+    on nns.dataset_config (dataset_version_id);
@@ -3,8 +3,8 @@ package datasetConfig
 import (
 	"database/sql"
 	"github.com/gorilla/mux"
-	"github.com/pkg/errors"
 	"net/http"
+	"nns_back/dataset"
 	"nns_back/log"
 	"nns_back/repository"
 	"nns_back/util"
@@ -14,12 +14,16 @@ import (
 type handler struct {
 	datasetConfigRepository Repository
 	projectRepository       repository.ProjectRepository
+	datasetRepository       dataset.Repository
+	httpClient              *http.Client
 }
 
-func NewHandler(projectRepository repository.ProjectRepository, datasetConfigRepository Repository) *handler {
+func NewHandler(projectRepository repository.ProjectRepository, datasetConfigRepository Repository, datasetRepository dataset.Repository, httpClient *http.Client) *handler {
 	return &handler{
 		projectRepository:       projectRepository,
 		datasetConfigRepository: datasetConfigRepository,
+		datasetRepository:       datasetRepository,
+		httpClient:              httpClient,
 	}
 }
 
@@ -35,6 +39,13 @@ type DatasetConfigDto struct {
 	Shuffle       bool                          `json:"shuffle"`
 	Label         string                        `json:"label"`
 	Normalization DatasetConfigNormalizationDto `json:"normalization"`
+	Split         DatasetConfigSplitDto         `json:"split"`
+	Image         DatasetConfigImageDto         `json:"image"`
+	Pipeline      Pipeline                      `json:"pipeline"`
+
+	// response only
+	Valid         bool   `json:"valid"`
+	InvalidReason string `json:"invalidReason,omitempty"`
 }
 
 type DatasetConfigNormalizationDto struct {
@@ -42,21 +53,77 @@ type DatasetConfigNormalizationDto struct {
 	Method string `json:"method"`
 }
 
+// DatasetConfigSplitDto divides the dataset into train, validation and test sets when training starts.
+type DatasetConfigSplitDto struct {
+	Usage           bool    `json:"usage"`
+	TrainRatio      float64 `json:"trainRatio"`
+	ValidationRatio float64 `json:"validationRatio"`
+	TestRatio       float64 `json:"testRatio"`
+	Stratify        bool    `json:"stratify"`
+	Seed            int64   `json:"seed"`
+}
+
+// DatasetConfigImageDto resizes and converts every image of an image dataset when training starts.
+// It is ignored for other kinds of datasets.
+type DatasetConfigImageDto struct {
+	Usage     bool   `json:"usage"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	ColorMode string `json:"colorMode"`
+	Format    string `json:"format"`
+}
+
 type DatasetDto struct {
-	Id   int64  `json:"id"`
-	Name string `json:"name"`
+	Id        int64  `json:"id"`
+	Name      string `json:"name"`
+	VersionId *int64 `json:"versionId"` // latest version if null
 }
 
 func (d DatasetConfigDto) Validate() error {
+	var errs FieldErrors
+
 	if d.Name == "" {
-		return errors.New("name is required")
+		errs.add("name", "name is required")
+	}
+
+	if d.Dataset.Id <= 0 {
+		errs.add("dataset.id", "dataset is required")
 	}
 
 	if d.Label == "" {
-		return errors.New("label is required")
+		errs.add("label", "label is required")
+	}
+
+	if d.Normalization.Usage && d.Normalization.Method == "" {
+		errs.add("normalization.method", "method is required")
 	}
 
-	return nil
+	if d.Split.Usage {
+		option := dataset.SplitOption{
+			TrainRatio: d.Split.TrainRatio,
+			ValidRatio: d.Split.ValidationRatio,
+			TestRatio:  d.Split.TestRatio,
+		}
+		if err := option.Validate(); err != nil {
+			errs.add("split", err.Error())
+		}
+	}
+
+	if d.Image.Usage {
+		option := dataset.ImageOption{
+			Width:     d.Image.Width,
+			Height:    d.Image.Height,
+			ColorMode: dataset.ColorMode(d.Image.ColorMode),
+			Format:    dataset.ImageFormat(d.Image.Format),
+		}
+		if err := option.Validate(); err != nil {
+			errs.add("image", err.Error())
+		}
+	}
+
+	d.Pipeline.validate(&errs)
+
+	return errs.err()
 }
 
 func (h *handler) GetDatasetConfigList(w http.ResponseWriter, r *http.Request) {
@@ -99,11 +166,19 @@ func (h *handler) GetDatasetConfigList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, datasetConfig := range datasetConfigList {
+		pipeline, err := datasetConfig.DecodePipeline()
+		if err != nil {
+			log.Errorf("failed to DecodePipeline(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+
 		responseBody.DatasetConfigs = append(responseBody.DatasetConfigs, DatasetConfigDto{
 			Id: datasetConfig.Id,
 			Dataset: DatasetDto{
-				Id:   datasetConfig.DatasetId,
-				Name: datasetConfig.DatasetName.String,
+				Id:        datasetConfig.DatasetId,
+				VersionId: nullInt64ToPtr(datasetConfig.DatasetVersionId),
+				Name:      datasetConfig.DatasetName.String,
 			},
 			Name:    datasetConfig.Name,
 			Shuffle: datasetConfig.Shuffle,
@@ -112,6 +187,24 @@ func (h *handler) GetDatasetConfigList(w http.ResponseWriter, r *http.Request) {
 				Usage:  datasetConfig.NormalizationMethod.Valid,
 				Method: datasetConfig.NormalizationMethod.String,
 			},
+			Split: DatasetConfigSplitDto{
+				Usage:           datasetConfig.SplitUsage,
+				TrainRatio:      datasetConfig.SplitTrainRatio,
+				ValidationRatio: datasetConfig.SplitValidRatio,
+				TestRatio:       datasetConfig.SplitTestRatio,
+				Stratify:        datasetConfig.SplitStratify,
+				Seed:            datasetConfig.SplitSeed,
+			},
+			Image: DatasetConfigImageDto{
+				Usage:     datasetConfig.ImageUsage,
+				Width:     datasetConfig.ImageWidth,
+				Height:    datasetConfig.ImageHeight,
+				ColorMode: datasetConfig.ImageColorMode,
+				Format:    datasetConfig.ImageFormat,
+			},
+			Pipeline:      pipeline,
+			Valid:         datasetConfig.Valid,
+			InvalidReason: datasetConfig.InvalidReason.String,
 		})
 	}
 
@@ -142,11 +235,19 @@ func (h *handler) GetDatasetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pipeline, err := datasetConfig.DecodePipeline()
+	if err != nil {
+		log.Errorf("failed to DecodePipeline(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
 	responseBody := DatasetConfigDto{
 		Id: datasetConfig.Id,
 		Dataset: DatasetDto{
-			Id:   datasetConfig.DatasetId,
-			Name: datasetConfig.DatasetName.String,
+			Id:        datasetConfig.DatasetId,
+			VersionId: nullInt64ToPtr(datasetConfig.DatasetVersionId),
+			Name:      datasetConfig.DatasetName.String,
 		},
 		Name:    datasetConfig.Name,
 		Shuffle: datasetConfig.Shuffle,
@@ -155,6 +256,24 @@ func (h *handler) GetDatasetConfig(w http.ResponseWriter, r *http.Request) {
 			Usage:  datasetConfig.NormalizationMethod.Valid,
 			Method: datasetConfig.NormalizationMethod.String,
 		},
+		Split: DatasetConfigSplitDto{
+			Usage:           datasetConfig.SplitUsage,
+			TrainRatio:      datasetConfig.SplitTrainRatio,
+			ValidationRatio: datasetConfig.SplitValidRatio,
+			TestRatio:       datasetConfig.SplitTestRatio,
+			Stratify:        datasetConfig.SplitStratify,
+			Seed:            datasetConfig.SplitSeed,
+		},
+		Image: DatasetConfigImageDto{
+			Usage:     datasetConfig.ImageUsage,
+			Width:     datasetConfig.ImageWidth,
+			Height:    datasetConfig.ImageHeight,
+			ColorMode: datasetConfig.ImageColorMode,
+			Format:    datasetConfig.ImageFormat,
+		},
+		Pipeline:      pipeline,
+		Valid:         datasetConfig.Valid,
+		InvalidReason: datasetConfig.InvalidReason.String,
 	}
 
 	util.WriteJson(w, http.StatusOK, responseBody)
@@ -165,6 +284,10 @@ func (h *handler) CreateDatasetConfig(w http.ResponseWriter, r *http.Request) {
 	if err := util.BindJson(r.Body, &requestBody); err != nil {
 		log.Warnw("failed to bind json",
 			"error", err)
+		if fieldErrors, ok := err.(FieldErrors); ok {
+			writeFieldErrors(w, fieldErrors)
+			return
+		}
 		util.WriteError(w, http.StatusBadRequest, util.ErrBadRequest)
 		return
 	}
@@ -187,16 +310,41 @@ func (h *handler) CreateDatasetConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	newDatasetConfig := DatasetConfig{
-		ProjectId: project.Id,
-		DatasetId: requestBody.Dataset.Id,
-		Name:      requestBody.Name,
-		Shuffle:   requestBody.Shuffle,
+		ProjectId:        project.Id,
+		DatasetId:        requestBody.Dataset.Id,
+		DatasetVersionId: ptrToNullInt64(requestBody.Dataset.VersionId),
+		Name:             requestBody.Name,
+		Shuffle:          requestBody.Shuffle,
 		NormalizationMethod: sql.NullString{
 			Valid:  requestBody.Normalization.Usage,
 			String: requestBody.Normalization.Method,
 		},
-		Label:  requestBody.Label,
-		Status: util.StatusEXIST,
+		Label:           requestBody.Label,
+		SplitUsage:      requestBody.Split.Usage,
+		SplitTrainRatio: requestBody.Split.TrainRatio,
+		SplitValidRatio: requestBody.Split.ValidationRatio,
+		SplitTestRatio:  requestBody.Split.TestRatio,
+		SplitStratify:   requestBody.Split.Stratify,
+		SplitSeed:       requestBody.Split.Seed,
+		ImageUsage:      requestBody.Image.Usage,
+		ImageWidth:      requestBody.Image.Width,
+		ImageHeight:     requestBody.Image.Height,
+		ImageColorMode:  requestBody.Image.ColorMode,
+		ImageFormat:     requestBody.Image.Format,
+		Valid:           true,
+		Status:          util.StatusEXIST,
+	}
+
+	newDatasetConfig.Pipeline, err = requestBody.Pipeline.toNullJson()
+	if err != nil {
+		log.Errorf("failed to toNullJson(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	// check dataset is usable and the config is valid for it
+	if _, ok := h.checkDataset(w, userId, newDatasetConfig); !ok {
+		return
 	}
 
 	// check name duplicate
@@ -226,6 +374,10 @@ func (h *handler) UpdateDatasetConfig(w http.ResponseWriter, r *http.Request) {
 	if err := util.BindJson(r.Body, &requestBody); err != nil {
 		log.Warnw("failed to bind json",
 			"error", err)
+		if fieldErrors, ok := err.(FieldErrors); ok {
+			writeFieldErrors(w, fieldErrors)
+			return
+		}
 		util.WriteError(w, http.StatusBadRequest, util.ErrBadRequest)
 		return
 	}
@@ -254,11 +406,29 @@ func (h *handler) UpdateDatasetConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	datasetConfig.DatasetId = requestBody.Dataset.Id
+	datasetConfig.DatasetVersionId = ptrToNullInt64(requestBody.Dataset.VersionId)
 	datasetConfig.Name = requestBody.Name
 	datasetConfig.Shuffle = requestBody.Shuffle
 	datasetConfig.NormalizationMethod.Valid = requestBody.Normalization.Usage
 	datasetConfig.NormalizationMethod.String = requestBody.Normalization.Method
 	datasetConfig.Label = requestBody.Label
+	datasetConfig.SplitUsage = requestBody.Split.Usage
+	datasetConfig.SplitTrainRatio = requestBody.Split.TrainRatio
+	datasetConfig.SplitValidRatio = requestBody.Split.ValidationRatio
+	datasetConfig.SplitTestRatio = requestBody.Split.TestRatio
+	datasetConfig.SplitStratify = requestBody.Split.Stratify
+	datasetConfig.SplitSeed = requestBody.Split.Seed
+	datasetConfig.ImageUsage = requestBody.Image.Usage
+	datasetConfig.ImageWidth = requestBody.Image.Width
+	datasetConfig.ImageHeight = requestBody.Image.Height
+	datasetConfig.ImageColorMode = requestBody.Image.ColorMode
+	datasetConfig.ImageFormat = requestBody.Image.Format
+	datasetConfig.Pipeline, err = requestBody.Pipeline.toNullJson()
+	if err != nil {
+		log.Errorf("failed to toNullJson(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
 
 	projectNo, _ := strconv.Atoi(mux.Vars(r)["projectNo"])
 	project, err := h.projectRepository.SelectProject(repository.ClassifiedByProjectNo(userId, projectNo))
@@ -268,6 +438,15 @@ func (h *handler) UpdateDatasetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// check dataset is usable and the config is valid for it
+	if _, ok := h.checkDataset(w, userId, datasetConfig); !ok {
+		return
+	}
+
+	// the config is valid again for the new dataset
+	datasetConfig.Valid = true
+	datasetConfig.InvalidReason = sql.NullString{}
+
 	// check name duplicate
 	if finded, err := h.datasetConfigRepository.FindByProjectIdAndDatasetConfigName(project.Id, datasetConfig.Name); err == nil && finded.Id != datasetConfig.Id {
 		log.Warnw("duplicate entity",
@@ -289,6 +468,75 @@ func (h *handler) UpdateDatasetConfig(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// checkDataset finds the dataset version of the config.
+// It writes an error response and returns false if the dataset is not usable by the user
+// or the config is not valid for the dataset version.
+func (h *handler) checkDataset(w http.ResponseWriter, userId int64, config DatasetConfig) (dataset.Dataset, bool) {
+	var errs FieldErrors
+
+	// the dataset must be added to the library of the user
+	if _, err := h.datasetRepository.FindDatasetFromDatasetLibraryByDatasetId(userId, config.DatasetId); err != nil {
+		if err != sql.ErrNoRows {
+			log.Errorf("failed to FindDatasetFromDatasetLibraryByDatasetId(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return dataset.Dataset{}, false
+		}
+		errs.add("dataset.id", "dataset is not in the library")
+	} else {
+		usable, err := h.datasetRepository.IsUsableBy(userId, config.DatasetId)
+		if err != nil {
+			log.Errorf("failed to IsUsableBy(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return dataset.Dataset{}, false
+		}
+		if !usable {
+			errs.add("dataset.id", "dataset is not usable")
+		}
+	}
+
+	if len(errs) > 0 {
+		log.Warnw("invalid dataset config",
+			"error", errs,
+			"requested datasetId", config.DatasetId)
+		writeFieldErrors(w, errs)
+		return dataset.Dataset{}, false
+	}
+
+	ds, _, err := dataset.FindSnapshot(h.datasetRepository, config.DatasetId, config.DatasetVersionId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			errs.add("dataset.id", "dataset does not exist")
+		} else if err == dataset.ErrVersionNotExist {
+			errs.add("dataset.versionId", "version does not exist")
+		} else {
+			log.Errorf("failed to FindSnapshot(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return dataset.Dataset{}, false
+		}
+	} else {
+		errs, err = validateWithDataset(config, ds)
+		if err != nil {
+			log.Errorf("failed to validateWithDataset(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return dataset.Dataset{}, false
+		}
+	}
+
+	if len(errs) > 0 {
+		log.Warnw("invalid dataset config",
+			"error", errs,
+			"requested datasetId", config.DatasetId)
+		writeFieldErrors(w, errs)
+		return dataset.Dataset{}, false
+	}
+
+	return ds, true
+}
+
+func writeFieldErrors(w http.ResponseWriter, errs FieldErrors) {
+	util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetConfig, util.KeyValue("fields", errs))
+}
+
 func (h *handler) DeleteDatasetConfig(w http.ResponseWriter, r *http.Request) {
 	userId, ok := r.Context().Value("userId").(int64)
 	if !ok {
@@ -321,3 +569,17 @@ func (h *handler) DeleteDatasetConfig(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func nullInt64ToPtr(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
+
+func ptrToNullInt64(p *int64) sql.NullInt64 {
+	if p == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *p, Valid: true}
+}
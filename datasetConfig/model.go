@@ -2,6 +2,7 @@ package datasetConfig
 
 import (
 	"database/sql"
+	"nns_back/dataset"
 	"nns_back/util"
 	"time"
 )
@@ -10,10 +11,25 @@ type DatasetConfig struct {
 	Id                  int64          `db:"id"`
 	ProjectId           int64          `db:"project_id"`
 	DatasetId           int64          `db:"dataset_id"`
+	DatasetVersionId    sql.NullInt64  `db:"dataset_version_id"` // latest version if not valid
 	Name                string         `db:"name"`
 	Shuffle             bool           `db:"shuffle"`
 	NormalizationMethod sql.NullString `db:"normalization_method"`
 	Label               string         `db:"label"`
+	SplitUsage          bool           `db:"split_usage"`
+	SplitTrainRatio     float64        `db:"split_train_ratio"`
+	SplitValidRatio     float64        `db:"split_valid_ratio"`
+	SplitTestRatio      float64        `db:"split_test_ratio"`
+	SplitStratify       bool           `db:"split_stratify"`
+	SplitSeed           int64          `db:"split_seed"`
+	ImageUsage          bool           `db:"image_usage"`
+	ImageWidth          int            `db:"image_width"`
+	ImageHeight         int            `db:"image_height"`
+	ImageColorMode      string         `db:"image_color_mode"`
+	ImageFormat         string         `db:"image_format"`
+	Pipeline            util.NullJson  `db:"pipeline"`       // preprocessing Pipeline, null if none
+	Valid               bool           `db:"valid"`          // false if it can't train anymore, such as its dataset was deleted
+	InvalidReason       sql.NullString `db:"invalid_reason"` // why it is not valid, such as dataset.ConfigInvalidReasonDatasetDeleted
 	Status              util.Status    `db:"status"`
 	CreateTime          time.Time      `db:"create_time"`
 	UpdateTime          time.Time      `db:"update_time"`
@@ -21,3 +37,13 @@ type DatasetConfig struct {
 	// others
 	DatasetName sql.NullString `db:"dataset_name"`
 }
+
+// ImageOption is how images are normalized before training when ImageUsage is true.
+func (d DatasetConfig) ImageOption() dataset.ImageOption {
+	return dataset.ImageOption{
+		Width:     d.ImageWidth,
+		Height:    d.ImageHeight,
+		ColorMode: dataset.ColorMode(d.ImageColorMode),
+		Format:    dataset.ImageFormat(d.ImageFormat),
+	}
+}
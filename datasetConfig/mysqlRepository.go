@@ -19,10 +19,25 @@ func (r *mysqlRepository) FindByProjectIdAndDatasetConfigName(projectId int64, d
 SELECT dc.id,
        dc.project_id,
        dc.dataset_id,
+       dc.dataset_version_id,
        dc.name,
        dc.shuffle,
        dc.label,
        dc.normalization_method,
+       dc.split_usage,
+       dc.split_train_ratio,
+       dc.split_valid_ratio,
+       dc.split_test_ratio,
+       dc.split_stratify,
+       dc.split_seed,
+       dc.image_usage,
+       dc.image_width,
+       dc.image_height,
+       dc.image_color_mode,
+       dc.image_format,
+       dc.pipeline,
+       dc.valid,
+       dc.invalid_reason,
        dc.status,
        dc.create_time,
        dc.update_time
@@ -50,10 +65,25 @@ func (r *mysqlRepository) FindAllByProjectId(projectId int64, offset int, limit
 SELECT dc.id,
        dc.project_id,
        dc.dataset_id,
+       dc.dataset_version_id,
        dc.name,
        dc.shuffle,
        dc.label,
        dc.normalization_method,
+       dc.split_usage,
+       dc.split_train_ratio,
+       dc.split_valid_ratio,
+       dc.split_test_ratio,
+       dc.split_stratify,
+       dc.split_seed,
+       dc.image_usage,
+       dc.image_width,
+       dc.image_height,
+       dc.image_color_mode,
+       dc.image_format,
+       dc.pipeline,
+       dc.valid,
+       dc.invalid_reason,
        dc.status,
        dc.create_time,
        dc.update_time,
@@ -89,10 +119,25 @@ func (r *mysqlRepository) FindByUserIdAndId(userId int64, id int64) (DatasetConf
 SELECT dc.id,
        dc.project_id,
        dc.dataset_id,
+       dc.dataset_version_id,
        dc.name,
        dc.shuffle,
        dc.label,
        dc.normalization_method,
+       dc.split_usage,
+       dc.split_train_ratio,
+       dc.split_valid_ratio,
+       dc.split_test_ratio,
+       dc.split_stratify,
+       dc.split_seed,
+       dc.image_usage,
+       dc.image_width,
+       dc.image_height,
+       dc.image_color_mode,
+       dc.image_format,
+       dc.pipeline,
+       dc.valid,
+       dc.invalid_reason,
        dc.status,
        dc.create_time,
        dc.update_time,
@@ -112,17 +157,47 @@ func (r *mysqlRepository) Insert(datasetConfig DatasetConfig) (int64, error) {
 	result, err := r.db.NamedExec(`
 INSERT INTO dataset_config (project_id,
                             dataset_id,
+                            dataset_version_id,
                             name,
                             shuffle,
                             label,
                             normalization_method,
+                            split_usage,
+                            split_train_ratio,
+                            split_valid_ratio,
+                            split_test_ratio,
+                            split_stratify,
+                            split_seed,
+                            image_usage,
+                            image_width,
+                            image_height,
+                            image_color_mode,
+                            image_format,
+                            pipeline,
+                            valid,
+                            invalid_reason,
                             status)
 VALUES (:project_id,
         :dataset_id,
+        :dataset_version_id,
         :name,
         :shuffle,
         :label,
         :normalization_method,
+        :split_usage,
+        :split_train_ratio,
+        :split_valid_ratio,
+        :split_test_ratio,
+        :split_stratify,
+        :split_seed,
+        :image_usage,
+        :image_width,
+        :image_height,
+        :image_color_mode,
+        :image_format,
+        :pipeline,
+        :valid,
+        :invalid_reason,
         :status);`, datasetConfig)
 	if err != nil {
 		return 0, err
@@ -136,10 +211,25 @@ func (r *mysqlRepository) Update(datasetConfig DatasetConfig) error {
 UPDATE dataset_config
 SET project_id           = :project_id,
     dataset_id           = :dataset_id,
+    dataset_version_id   = :dataset_version_id,
     name                 = :name,
     shuffle              = :shuffle,
     label                = :label,
     normalization_method = :normalization_method,
+    split_usage          = :split_usage,
+    split_train_ratio    = :split_train_ratio,
+    split_valid_ratio    = :split_valid_ratio,
+    split_test_ratio     = :split_test_ratio,
+    split_stratify       = :split_stratify,
+    split_seed           = :split_seed,
+    image_usage          = :image_usage,
+    image_width          = :image_width,
+    image_height         = :image_height,
+    image_color_mode     = :image_color_mode,
+    image_format         = :image_format,
+    pipeline             = :pipeline,
+    valid                = :valid,
+    invalid_reason       = :invalid_reason,
     status               = :status
 WHERE id = :id;`, datasetConfig)
 	return err
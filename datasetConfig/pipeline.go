@@ -0,0 +1,486 @@
+package datasetConfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"nns_back/dataset"
+	"nns_back/util"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type StepType string
+
+const (
+	StepTypeDrop        StepType = "DROP"        // removes the columns
+	StepTypeImpute      StepType = "IMPUTE"      // fills missing values
+	StepTypeOneHot      StepType = "ONE_HOT"     // replaces each column with a 0/1 column per category
+	StepTypeOrdinal     StepType = "ORDINAL"     // replaces each category with its index in sorted categories
+	StepTypeStandardize StepType = "STANDARDIZE" // scales to zero mean and unit variance
+	StepTypeMinMax      StepType = "MIN_MAX"     // scales to [0, 1]
+	StepTypeTokenize    StepType = "TOKENIZE"    // splits text into space separated words
+)
+
+type ImputeStrategy string
+
+const (
+	ImputeStrategyMean         ImputeStrategy = "MEAN"
+	ImputeStrategyMedian       ImputeStrategy = "MEDIAN"
+	ImputeStrategyMostFrequent ImputeStrategy = "MOST_FREQUENT"
+	ImputeStrategyConstant     ImputeStrategy = "CONSTANT"
+)
+
+const _maxPipelineSteps = 50
+
+// Step is a transformation applied to the columns of a tabular dataset.
+type Step struct {
+	Type    StepType `json:"type"`
+	Columns []string `json:"columns"`
+
+	// IMPUTE only
+	Strategy ImputeStrategy `json:"strategy,omitempty"`
+	Value    string         `json:"value,omitempty"` // CONSTANT strategy only
+
+	// TOKENIZE only
+	Lowercase bool `json:"lowercase,omitempty"`
+	MaxTokens int  `json:"maxTokens,omitempty"` // unlimited if 0
+}
+
+// Pipeline is the ordered preprocessing steps the trainer applies to the dataset before training.
+// Statistics such as mean and categories are fitted on the rows the pipeline is applied to.
+type Pipeline []Step
+
+// validate checks the steps without the dataset.
+func (p Pipeline) validate(errs *FieldErrors) {
+	if len(p) > _maxPipelineSteps {
+		errs.add("pipeline", fmt.Sprintf("pipeline can have at most %d steps", _maxPipelineSteps))
+		return
+	}
+
+	for i, step := range p {
+		field := fmt.Sprintf("pipeline[%d]", i)
+
+		switch step.Type {
+		case StepTypeDrop, StepTypeOneHot, StepTypeOrdinal, StepTypeStandardize, StepTypeMinMax:
+		case StepTypeImpute:
+			switch step.Strategy {
+			case ImputeStrategyMean, ImputeStrategyMedian, ImputeStrategyMostFrequent:
+			case ImputeStrategyConstant:
+				if step.Value == "" {
+					errs.add(field+".value", "value is required for CONSTANT strategy")
+				}
+			default:
+				errs.add(field+".strategy", fmt.Sprintf("unknown impute strategy %q", step.Strategy))
+			}
+		case StepTypeTokenize:
+			if step.MaxTokens < 0 {
+				errs.add(field+".maxTokens", "maxTokens must not be negative")
+			}
+		default:
+			errs.add(field+".type", fmt.Sprintf("unknown step type %q", step.Type))
+		}
+
+		if len(step.Columns) == 0 {
+			errs.add(field+".columns", "columns are required")
+		}
+		for _, column := range step.Columns {
+			if column == "" {
+				errs.add(field+".columns", "column name is required")
+				break
+			}
+		}
+	}
+}
+
+// validateWithProfile checks every column of the steps exists at the step
+// and has a type the step can be applied to.
+func (p Pipeline) validateWithProfile(profile dataset.Profile, label string, errs *FieldErrors) {
+	columnTypes := make(map[string]dataset.ColumnType, len(profile.Columns))
+	for _, c := range profile.Columns {
+		columnTypes[c.Name] = c.Type
+	}
+
+	for i, step := range p {
+		field := fmt.Sprintf("pipeline[%d].columns", i)
+
+		for _, column := range step.Columns {
+			columnType, ok := columnTypes[column]
+			if !ok {
+				errs.add(field, fmt.Sprintf("%q is not a column at this step", column))
+				continue
+			}
+
+			if !step.accepts(columnType) {
+				errs.add(field, fmt.Sprintf("%s can not be applied to %s column %q", step.Type, columnType, column))
+				continue
+			}
+
+			switch step.Type {
+			case StepTypeDrop, StepTypeOneHot:
+				if column == label {
+					errs.add(field, fmt.Sprintf("label %q can not be removed by %s", column, step.Type))
+					continue
+				}
+				// one-hot columns depend on the values, so they can not be referenced by later steps
+				delete(columnTypes, column)
+			case StepTypeOrdinal:
+				columnTypes[column] = dataset.ColumnTypeNumeric
+			}
+		}
+	}
+}
+
+// accepts reports whether the step can be applied to a column of columnType.
+func (s Step) accepts(columnType dataset.ColumnType) bool {
+	switch s.Type {
+	case StepTypeStandardize, StepTypeMinMax:
+		return columnType == dataset.ColumnTypeNumeric
+	case StepTypeImpute:
+		if s.Strategy == ImputeStrategyMean || s.Strategy == ImputeStrategyMedian {
+			return columnType == dataset.ColumnTypeNumeric
+		}
+		return true
+	case StepTypeOneHot, StepTypeOrdinal:
+		return columnType == dataset.ColumnTypeCategorical || columnType == dataset.ColumnTypeNumeric
+	case StepTypeTokenize:
+		return columnType == dataset.ColumnTypeText || columnType == dataset.ColumnTypeCategorical
+	}
+	return true
+}
+
+func (p Pipeline) toNullJson() (util.NullJson, error) {
+	if len(p) == 0 {
+		return util.NullJson{}, nil
+	}
+
+	jsoned, err := json.Marshal(p)
+	if err != nil {
+		return util.NullJson{}, err
+	}
+	return util.NullJson{Json: jsoned, Valid: true}, nil
+}
+
+// DecodePipeline returns the stored pipeline of the config, or nil if there is none.
+func (d DatasetConfig) DecodePipeline() (Pipeline, error) {
+	if !d.Pipeline.Valid {
+		return nil, nil
+	}
+
+	var pipeline Pipeline
+	err := json.Unmarshal(d.Pipeline.Json, &pipeline)
+	return pipeline, err
+}
+
+// Apply transforms the csv header and rows by every step in order.
+// It is how the trainer preprocesses the dataset, used to preview the pipeline on sample rows.
+func (p Pipeline) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	t := newTable(header, rows)
+
+	for i, step := range p {
+		if err := t.apply(step); err != nil {
+			return nil, nil, fmt.Errorf("pipeline[%d]: %w", i, err)
+		}
+	}
+
+	return t.header, t.rows, nil
+}
+
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func newTable(header []string, rows [][]string) *table {
+	t := &table{
+		header: append([]string(nil), header...),
+		rows:   make([][]string, 0, len(rows)),
+	}
+
+	// copy rows, and pad short rows with missing values
+	for _, row := range rows {
+		copied := make([]string, len(header))
+		copy(copied, row)
+		t.rows = append(t.rows, copied)
+	}
+
+	return t
+}
+
+func (t *table) apply(step Step) error {
+	for _, column := range step.Columns {
+		index := indexOf(t.header, column)
+		if index < 0 {
+			return fmt.Errorf("column %q not exist", column)
+		}
+
+		var err error
+		switch step.Type {
+		case StepTypeDrop:
+			t.replace(index, nil, func(row []string) []string { return nil })
+		case StepTypeImpute:
+			err = t.impute(index, step.Strategy, step.Value)
+		case StepTypeOneHot:
+			t.oneHot(index)
+		case StepTypeOrdinal:
+			t.ordinal(index)
+		case StepTypeStandardize:
+			err = t.standardize(index)
+		case StepTypeMinMax:
+			err = t.minMax(index)
+		case StepTypeTokenize:
+			t.tokenize(index, step.Lowercase, step.MaxTokens)
+		default:
+			err = fmt.Errorf("unknown step type %q", step.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %q: %w", step.Type, column, err)
+		}
+	}
+
+	return nil
+}
+
+// replace replaces the column at index with columns, and the value of each row with the result of f.
+func (t *table) replace(index int, columns []string, f func(row []string) []string) {
+	t.header = splice(t.header, index, columns)
+	for i, row := range t.rows {
+		t.rows[i] = splice(row, index, f(row))
+	}
+}
+
+func splice(s []string, index int, values []string) []string {
+	result := make([]string, 0, len(s)-1+len(values))
+	result = append(result, s[:index]...)
+	result = append(result, values...)
+	return append(result, s[index+1:]...)
+}
+
+func (t *table) impute(index int, strategy ImputeStrategy, constant string) error {
+	var fill string
+	switch strategy {
+	case ImputeStrategyMean, ImputeStrategyMedian:
+		values, err := t.numbers(index)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		if strategy == ImputeStrategyMean {
+			fill = formatFloat(mean(values))
+		} else {
+			fill = formatFloat(median(values))
+		}
+	case ImputeStrategyMostFrequent:
+		fill = mostFrequent(t.categories(index), t.column(index))
+	case ImputeStrategyConstant:
+		fill = constant
+	default:
+		return fmt.Errorf("unknown impute strategy %q", strategy)
+	}
+
+	for _, row := range t.rows {
+		if isMissing(row[index]) {
+			row[index] = fill
+		}
+	}
+	return nil
+}
+
+func (t *table) oneHot(index int) {
+	categories := t.categories(index)
+
+	columns := make([]string, 0, len(categories))
+	for _, category := range categories {
+		columns = append(columns, t.header[index]+"_"+category)
+	}
+
+	t.replace(index, columns, func(row []string) []string {
+		value := strings.TrimSpace(row[index])
+		encoded := make([]string, 0, len(categories))
+		for _, category := range categories {
+			if value == category {
+				encoded = append(encoded, "1")
+			} else {
+				encoded = append(encoded, "0")
+			}
+		}
+		return encoded
+	})
+}
+
+func (t *table) ordinal(index int) {
+	categories := t.categories(index)
+
+	for _, row := range t.rows {
+		if isMissing(row[index]) {
+			row[index] = ""
+			continue
+		}
+		row[index] = strconv.Itoa(sort.SearchStrings(categories, strings.TrimSpace(row[index])))
+	}
+}
+
+func (t *table) standardize(index int) error {
+	values, err := t.numbers(index)
+	if err != nil || len(values) == 0 {
+		return err
+	}
+
+	m := mean(values)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - m) * (v - m)
+	}
+	std := math.Sqrt(variance / float64(len(values)))
+
+	return t.scale(index, func(v float64) float64 {
+		if std == 0 {
+			return 0
+		}
+		return (v - m) / std
+	})
+}
+
+func (t *table) minMax(index int) error {
+	values, err := t.numbers(index)
+	if err != nil || len(values) == 0 {
+		return err
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+
+	return t.scale(index, func(v float64) float64 {
+		if max == min {
+			return 0
+		}
+		return (v - min) / (max - min)
+	})
+}
+
+// scale replaces every not missing value of the numeric column with the result of f.
+func (t *table) scale(index int, f func(float64) float64) error {
+	for _, row := range t.rows {
+		if isMissing(row[index]) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(row[index]), 64)
+		if err != nil {
+			return err
+		}
+		row[index] = formatFloat(f(v))
+	}
+	return nil
+}
+
+func (t *table) tokenize(index int, lowercase bool, maxTokens int) {
+	for _, row := range t.rows {
+		value := row[index]
+		if lowercase {
+			value = strings.ToLower(value)
+		}
+
+		tokens := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if maxTokens > 0 && len(tokens) > maxTokens {
+			tokens = tokens[:maxTokens]
+		}
+		row[index] = strings.Join(tokens, " ")
+	}
+}
+
+func (t *table) column(index int) []string {
+	values := make([]string, 0, len(t.rows))
+	for _, row := range t.rows {
+		if !isMissing(row[index]) {
+			values = append(values, strings.TrimSpace(row[index]))
+		}
+	}
+	return values
+}
+
+// categories returns the sorted distinct values of the column.
+func (t *table) categories(index int) []string {
+	set := make(map[string]struct{})
+	for _, value := range t.column(index) {
+		set[value] = struct{}{}
+	}
+
+	categories := make([]string, 0, len(set))
+	for value := range set {
+		categories = append(categories, value)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func (t *table) numbers(index int) ([]float64, error) {
+	values := make([]float64, 0, len(t.rows))
+	for _, value := range t.column(index) {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func isMissing(value string) bool {
+	return dataset.IsNull(strings.TrimSpace(value))
+}
+
+// mostFrequent returns the most frequent value, the first of categories on a tie.
+func mostFrequent(categories []string, values []string) string {
+	counts := make(map[string]int, len(categories))
+	for _, v := range values {
+		counts[v]++
+	}
+
+	result := ""
+	for _, category := range categories {
+		if counts[category] > counts[result] || result == "" {
+			result = category
+		}
+	}
+	return result
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func indexOf(s []string, value string) int {
+	for i, v := range s {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
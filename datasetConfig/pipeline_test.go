@@ -0,0 +1,156 @@
+package datasetConfig
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nns_back/dataset"
+	"testing"
+)
+
+func TestPipeline_Apply(t *testing.T) {
+	header := []string{"age", "city", "memo", "label"}
+	rows := [][]string{
+		{"10", "seoul", "Hello, World!", "yes"},
+		{"", "busan", "a b c", "no"},
+		{"30", "seoul", "", "yes"},
+		{"20", "NA"},
+	}
+
+	tests := []struct {
+		name       string
+		pipeline   Pipeline
+		wantHeader []string
+		wantRows   [][]string
+		wantErr    bool
+	}{
+		{
+			name:       "drop",
+			pipeline:   Pipeline{{Type: StepTypeDrop, Columns: []string{"memo", "city"}}},
+			wantHeader: []string{"age", "label"},
+			wantRows:   [][]string{{"10", "yes"}, {"", "no"}, {"30", "yes"}, {"20", ""}},
+		},
+		{
+			name: "impute and scale",
+			pipeline: Pipeline{
+				{Type: StepTypeImpute, Columns: []string{"age"}, Strategy: ImputeStrategyMedian},
+				{Type: StepTypeMinMax, Columns: []string{"age"}},
+				{Type: StepTypeDrop, Columns: []string{"city", "memo", "label"}},
+			},
+			wantHeader: []string{"age"},
+			wantRows:   [][]string{{"0"}, {"0.5"}, {"1"}, {"0.5"}},
+		},
+		{
+			name: "standardize skips missing values",
+			pipeline: Pipeline{
+				{Type: StepTypeStandardize, Columns: []string{"age"}},
+				{Type: StepTypeDrop, Columns: []string{"city", "memo", "label"}},
+			},
+			wantHeader: []string{"age"},
+			wantRows:   [][]string{{"-1.224744871391589"}, {""}, {"1.224744871391589"}, {"0"}},
+		},
+		{
+			name: "one-hot and ordinal",
+			pipeline: Pipeline{
+				{Type: StepTypeImpute, Columns: []string{"city"}, Strategy: ImputeStrategyMostFrequent},
+				{Type: StepTypeOneHot, Columns: []string{"city"}},
+				{Type: StepTypeOrdinal, Columns: []string{"label"}},
+				{Type: StepTypeDrop, Columns: []string{"age", "memo"}},
+			},
+			wantHeader: []string{"city_busan", "city_seoul", "label"},
+			wantRows:   [][]string{{"0", "1", "1"}, {"1", "0", "0"}, {"0", "1", "1"}, {"0", "1", ""}},
+		},
+		{
+			name: "tokenize",
+			pipeline: Pipeline{
+				{Type: StepTypeTokenize, Columns: []string{"memo"}, Lowercase: true, MaxTokens: 2},
+				{Type: StepTypeDrop, Columns: []string{"age", "city", "label"}},
+			},
+			wantHeader: []string{"memo"},
+			wantRows:   [][]string{{"hello world"}, {"a b"}, {""}, {""}},
+		},
+		{
+			name:     "not numeric",
+			pipeline: Pipeline{{Type: StepTypeMinMax, Columns: []string{"city"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "dropped column",
+			pipeline: Pipeline{{Type: StepTypeDrop, Columns: []string{"age"}}, {Type: StepTypeMinMax, Columns: []string{"age"}}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHeader, gotRows, err := tt.pipeline.Apply(header, rows)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHeader, gotHeader)
+			assert.Equal(t, tt.wantRows, gotRows)
+		})
+	}
+
+	// source rows are not modified
+	assert.Equal(t, []string{"", "busan", "a b c", "no"}, rows[1])
+}
+
+func TestPipeline_validateWithProfile(t *testing.T) {
+	profile := dataset.Profile{Columns: []dataset.ColumnProfile{
+		{Name: "age", Type: dataset.ColumnTypeNumeric},
+		{Name: "city", Type: dataset.ColumnTypeCategorical},
+		{Name: "memo", Type: dataset.ColumnTypeText},
+		{Name: "label", Type: dataset.ColumnTypeCategorical},
+	}}
+
+	tests := []struct {
+		name     string
+		pipeline Pipeline
+		fields   []string
+	}{
+		{
+			name: "valid",
+			pipeline: Pipeline{
+				{Type: StepTypeImpute, Columns: []string{"age"}, Strategy: ImputeStrategyMean},
+				{Type: StepTypeStandardize, Columns: []string{"age"}},
+				{Type: StepTypeOrdinal, Columns: []string{"city"}},
+				{Type: StepTypeMinMax, Columns: []string{"city"}},
+				{Type: StepTypeTokenize, Columns: []string{"memo"}},
+			},
+		},
+		{
+			name:     "unknown column",
+			pipeline: Pipeline{{Type: StepTypeDrop, Columns: []string{"name"}}},
+			fields:   []string{"pipeline[0].columns"},
+		},
+		{
+			name:     "column type",
+			pipeline: Pipeline{{Type: StepTypeStandardize, Columns: []string{"city"}}, {Type: StepTypeOneHot, Columns: []string{"memo"}}},
+			fields:   []string{"pipeline[0].columns", "pipeline[1].columns"},
+		},
+		{
+			name:     "label removed",
+			pipeline: Pipeline{{Type: StepTypeDrop, Columns: []string{"label"}}},
+			fields:   []string{"pipeline[0].columns"},
+		},
+		{
+			name:     "one-hot column referenced",
+			pipeline: Pipeline{{Type: StepTypeOneHot, Columns: []string{"city"}}, {Type: StepTypeDrop, Columns: []string{"city"}}},
+			fields:   []string{"pipeline[1].columns"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs FieldErrors
+			tt.pipeline.validateWithProfile(profile, "label", &errs)
+
+			fields := make([]string, 0)
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+			assert.ElementsMatch(t, tt.fields, fields)
+		})
+	}
+}
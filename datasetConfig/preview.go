@@ -0,0 +1,141 @@
+package datasetConfig
+
+import (
+	"fmt"
+	"net/http"
+	"nns_back/dataset"
+	"nns_back/log"
+	"nns_back/util"
+)
+
+const (
+	_defaultPreviewRows = 10
+	_maxPreviewRows     = 100
+)
+
+type PreviewPipelineRequestBody struct {
+	Dataset  DatasetDto `json:"dataset"`
+	Label    string     `json:"label"`
+	Pipeline Pipeline   `json:"pipeline"`
+	Rows     int        `json:"rows"` // number of sample rows, _defaultPreviewRows if 0
+}
+
+func (p PreviewPipelineRequestBody) Validate() error {
+	var errs FieldErrors
+
+	if p.Dataset.Id <= 0 {
+		errs.add("dataset.id", "dataset is required")
+	}
+
+	if p.Label == "" {
+		errs.add("label", "label is required")
+	}
+
+	if p.Rows < 0 || p.Rows > _maxPreviewRows {
+		errs.add("rows", fmt.Sprintf("rows must be 0 to %d", _maxPreviewRows))
+	}
+
+	p.Pipeline.validate(&errs)
+
+	return errs.err()
+}
+
+type PreviewPipelineResponseBody struct {
+	Source      PipelinePreviewTableDto `json:"source"`
+	Transformed PipelinePreviewTableDto `json:"transformed"`
+}
+
+type PipelinePreviewTableDto struct {
+	Header []string   `json:"header"`
+	Rows   [][]string `json:"rows"`
+}
+
+// PreviewPipeline applies the pipeline to the first rows of the dataset,
+// so that the pipeline can be checked before saving the dataset config.
+// Statistics of the steps are fitted on the sample rows, not the whole dataset.
+func (h *handler) PreviewPipeline(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	var requestBody PreviewPipelineRequestBody
+	if err := util.BindJson(r.Body, &requestBody); err != nil {
+		log.Warnw("failed to bind json",
+			"error", err)
+		if fieldErrors, ok := err.(FieldErrors); ok {
+			writeFieldErrors(w, fieldErrors)
+			return
+		}
+		util.WriteError(w, http.StatusBadRequest, util.ErrBadRequest)
+		return
+	}
+
+	config := DatasetConfig{
+		DatasetId:        requestBody.Dataset.Id,
+		DatasetVersionId: ptrToNullInt64(requestBody.Dataset.VersionId),
+		Label:            requestBody.Label,
+	}
+
+	var err error
+	config.Pipeline, err = requestBody.Pipeline.toNullJson()
+	if err != nil {
+		log.Errorf("failed to toNullJson(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	ds, ok := h.checkDataset(w, userId, config)
+	if !ok {
+		return
+	}
+
+	if ds.Kind == dataset.KindImages {
+		writeFieldErrors(w, FieldErrors{{Field: "pipeline", Message: "pipeline is not supported for image dataset"}})
+		return
+	}
+
+	if !ds.URL.Valid {
+		util.WriteError(w, http.StatusBadRequest, util.ErrDatasetUploadNotComplete)
+		return
+	}
+
+	rows := requestBody.Rows
+	if rows == 0 {
+		rows = _defaultPreviewRows
+	}
+
+	header, sampleRows, err := dataset.SampleRows(h.httpClient, ds.URL.String, rows)
+	if err != nil {
+		log.Errorw("failed to read sample rows",
+			"error", err,
+			"dataset.id", ds.ID)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	transformedHeader, transformedRows, err := requestBody.Pipeline.Apply(header, sampleRows)
+	if err != nil {
+		// the sample rows don't fit the pipeline, such as not numeric values to scale
+		log.Warnw("failed to apply pipeline",
+			"error", err,
+			"dataset.id", ds.ID)
+		writeFieldErrors(w, FieldErrors{{Field: "pipeline", Message: err.Error()}})
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, PreviewPipelineResponseBody{
+		Source: PipelinePreviewTableDto{
+			Header: header,
+			Rows:   sampleRows,
+		},
+		Transformed: PipelinePreviewTableDto{
+			Header: transformedHeader,
+			Rows:   transformedRows,
+		},
+	})
+}
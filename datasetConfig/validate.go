@@ -0,0 +1,137 @@
+package datasetConfig
+
+import (
+	"fmt"
+	"nns_back/dataset"
+	"strings"
+)
+
+// FieldError is a validation error of a field of the request body.
+// Field is the json path of the field, such as "normalization.method".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors are every validation error of a dataset config.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+func (e *FieldErrors) add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// err returns nil if there are no errors,
+// so that empty FieldErrors is not returned as a non-nil error.
+func (e FieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type NormalizationMethod string
+
+const (
+	NormalizationMethodMinMax   NormalizationMethod = "MIN_MAX"  // scales each column to [0, 1]
+	NormalizationMethodStandard NormalizationMethod = "STANDARD" // scales each column to zero mean and unit variance
+	NormalizationMethodImage    NormalizationMethod = "IMAGE"    // scales each pixel to [0, 1]
+)
+
+// normalizationMethodsOf returns the normalization methods supported for the kind of dataset.
+func normalizationMethodsOf(kind dataset.Kind) []NormalizationMethod {
+	if kind == dataset.KindImages {
+		return []NormalizationMethod{NormalizationMethodImage}
+	}
+	return []NormalizationMethod{NormalizationMethodMinMax, NormalizationMethodStandard}
+}
+
+// isValidNormalizationMethod reports whether method is supported for the kind of dataset.
+func isValidNormalizationMethod(kind dataset.Kind, method string) bool {
+	for _, m := range normalizationMethodsOf(kind) {
+		if string(m) == method {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidLabel reports whether label is a column of the dataset.
+// Datasets not profiled yet can not be verified, so any label is valid for them.
+func isValidLabel(ds dataset.Dataset, label string) (bool, error) {
+	if ds.Kind == dataset.KindImages {
+		return label == dataset.ImageDatasetLabelColumn, nil
+	}
+
+	profile, err := ds.DecodeProfile()
+	if err == dataset.ErrProfileNotExist {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := profile.Column(label)
+	return ok, nil
+}
+
+// validateWithDataset validates the fields of the dataset config depending on the dataset.
+func validateWithDataset(config DatasetConfig, ds dataset.Dataset) (FieldErrors, error) {
+	var errs FieldErrors
+
+	valid, err := isValidLabel(ds, config.Label)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		if ds.Kind == dataset.KindImages {
+			errs.add("label", fmt.Sprintf("label of image dataset must be %q", dataset.ImageDatasetLabelColumn))
+		} else {
+			errs.add("label", fmt.Sprintf("%q is not a column of the dataset", config.Label))
+		}
+	}
+
+	if config.NormalizationMethod.Valid && !isValidNormalizationMethod(ds.Kind, config.NormalizationMethod.String) {
+		errs.add("normalization.method", fmt.Sprintf("%q is not supported for %s dataset, must be one of %v",
+			config.NormalizationMethod.String, ds.Kind, normalizationMethodsOf(ds.Kind)))
+	}
+
+	pipeline, err := config.DecodePipeline()
+	if err != nil {
+		return nil, err
+	}
+	if len(pipeline) > 0 {
+		if err := validatePipeline(pipeline, ds, config.Label, &errs); err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, nil
+}
+
+// validatePipeline validates the pipeline against the columns of the dataset.
+// Datasets not profiled yet can not be verified, so any column is valid for them.
+func validatePipeline(pipeline Pipeline, ds dataset.Dataset, label string, errs *FieldErrors) error {
+	if ds.Kind == dataset.KindImages {
+		errs.add("pipeline", "pipeline is not supported for image dataset")
+		return nil
+	}
+
+	profile, err := ds.DecodeProfile()
+	if err == dataset.ErrProfileNotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipeline.validateWithProfile(profile, label, errs)
+	return nil
+}
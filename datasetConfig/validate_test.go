@@ -0,0 +1,103 @@
+package datasetConfig
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"nns_back/dataset"
+	"nns_back/util"
+	"testing"
+)
+
+func Test_validateWithDataset(t *testing.T) {
+	text := dataset.Dataset{
+		Kind:    dataset.KindText,
+		Profile: util.NullJson{Json: []byte(`{"rowCount":2,"columns":[{"name":"x"},{"name":"y"}]}`), Valid: true},
+	}
+	images := dataset.Dataset{Kind: dataset.KindImages}
+	unprofiled := dataset.Dataset{Kind: dataset.KindUnknown}
+
+	tests := []struct {
+		name   string
+		ds     dataset.Dataset
+		config DatasetConfig
+		fields []string
+	}{
+		{
+			name:   "valid text",
+			ds:     text,
+			config: DatasetConfig{Label: "y", NormalizationMethod: sql.NullString{String: "STANDARD", Valid: true}},
+		},
+		{
+			name:   "valid image",
+			ds:     images,
+			config: DatasetConfig{Label: "label", NormalizationMethod: sql.NullString{String: "IMAGE", Valid: true}},
+		},
+		{
+			name:   "no normalization",
+			ds:     text,
+			config: DatasetConfig{Label: "x"},
+		},
+		{
+			name:   "unprofiled",
+			ds:     unprofiled,
+			config: DatasetConfig{Label: "anything", NormalizationMethod: sql.NullString{String: "MIN_MAX", Valid: true}},
+		},
+		{
+			name:   "unknown column",
+			ds:     text,
+			config: DatasetConfig{Label: "z"},
+			fields: []string{"label"},
+		},
+		{
+			name:   "image label",
+			ds:     images,
+			config: DatasetConfig{Label: "y"},
+			fields: []string{"label"},
+		},
+		{
+			name:   "method of other kind",
+			ds:     text,
+			config: DatasetConfig{Label: "y", NormalizationMethod: sql.NullString{String: "IMAGE", Valid: true}},
+			fields: []string{"normalization.method"},
+		},
+		{
+			name:   "every field",
+			ds:     images,
+			config: DatasetConfig{Label: "y", NormalizationMethod: sql.NullString{String: "unknown", Valid: true}},
+			fields: []string{"label", "normalization.method"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := validateWithDataset(tt.config, tt.ds)
+			assert.NoError(t, err)
+
+			fields := make([]string, 0)
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+			assert.ElementsMatch(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestDatasetConfigDto_Validate(t *testing.T) {
+	valid := DatasetConfigDto{Dataset: DatasetDto{Id: 1}, Name: "config", Label: "y"}
+	assert.NoError(t, valid.Validate())
+
+	invalid := DatasetConfigDto{
+		Normalization: DatasetConfigNormalizationDto{Usage: true},
+		Split:         DatasetConfigSplitDto{Usage: true, TrainRatio: 0.9, ValidationRatio: 0.9},
+	}
+	err := invalid.Validate()
+
+	fieldErrors, ok := err.(FieldErrors)
+	if assert.True(t, ok) {
+		fields := make([]string, 0)
+		for _, fe := range fieldErrors {
+			fields = append(fields, fe.Field)
+		}
+		assert.Equal(t, []string{"name", "dataset.id", "label", "normalization.method", "split"}, fields)
+	}
+}
@@ -12,15 +12,20 @@ type FitRequestBody struct {
 	Config    json.RawMessage       `json:"config"`
 	Content   json.RawMessage       `json:"content"`
 	DataSet   FitRequestBodyDataSet `json:"data_set"`
+
+	// CallbackSecret is the key to sign the callbacks of the train with HMAC-SHA256.
+	CallbackSecret string `json:"callback_secret"`
 }
 
 type FitRequestBodyDataSet struct {
 	TrainUri      string                             `json:"train_uri"`
 	ValidationUri string                             `json:"validation_uri"`
+	TestUri       string                             `json:"test_uri"`
 	Shuffle       bool                               `json:"shuffle"`
 	Label         string                             `json:"label"`
 	Normalization FitRequestBodyDataSetNormalization `json:"normalization"`
 	Kind          string                             `json:"kind"`
+	Pipeline      json.RawMessage                    `json:"pipeline,omitempty"` // preprocessing steps applied in order, tabular dataset only
 }
 
 type FitRequestBodyDataSetNormalization struct {
@@ -28,6 +33,14 @@ type FitRequestBodyDataSetNormalization struct {
 	Method string `json:"method"`
 }
 
+type CancelRequestBody struct {
+	TrainId int64 `json:"train_id"`
+	UserId  int64 `json:"user_id"`
+}
+
 type Fitter interface {
 	Fit(payload FitRequestBody) (*http.Response, error)
+
+	// Cancel stops the running train.
+	Cancel(payload CancelRequestBody) (*http.Response, error)
 }
@@ -3,42 +3,50 @@ package externalAPI
 import (
 	"bytes"
 	"encoding/json"
-	"moul.io/http2curl"
 	"net/http"
 	"nns_back/log"
 )
 
+const DefaultFitterUrl = "http://nnstudio.io:8081"
+
 type fitterImpl struct {
 	httpClient *http.Client
+	baseUrl    string
 }
 
-func NewFitter(httpClient *http.Client) Fitter {
+// NewFitter returns the Fitter requesting the trainer at baseUrl, such as DefaultFitterUrl.
+func NewFitter(httpClient *http.Client, baseUrl string) Fitter {
 	return &fitterImpl{
 		httpClient: httpClient,
+		baseUrl:    baseUrl,
 	}
 }
 
 func (c *fitterImpl) Fit(payload FitRequestBody) (*http.Response, error) {
-	const requestUrl = "http://nnstudio.io:8081/api/fit"
+	return c.post("/api/fit", payload)
+}
+
+func (c *fitterImpl) Cancel(payload CancelRequestBody) (*http.Response, error) {
+	return c.post("/api/cancel", payload)
+}
 
+func (c *fitterImpl) post(path string, payload interface{}) (*http.Response, error) {
 	jsoned, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(jsoned))
+	req, err := http.NewRequest(http.MethodPost, c.baseUrl+path, bytes.NewBuffer(jsoned))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
-	command, err := http2curl.GetCurlCommand(req)
-	if err != nil {
-		return nil, err
-	}
-
-	log.Debug(command)
+	// the payload is not logged, since it has the callback secret of the train
+	log.Debugw("fitter request",
+		"method", req.Method,
+		"url", req.URL.String())
 
 	return c.httpClient.Do(req)
 }
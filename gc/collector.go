@@ -0,0 +1,181 @@
+package gc
+
+import (
+	"github.com/pkg/errors"
+	"net/http"
+	"nns_back/cloud"
+	"nns_back/dataset"
+	"nns_back/log"
+	"time"
+)
+
+// Bucket is a storage bucket to collect orphan objects from.
+type Bucket interface {
+	List() ([]cloud.Object, error)
+	Delete(url string) error
+}
+
+const DefaultGracePeriod = 24 * time.Hour
+
+// Collector finds objects in the buckets which are not referenced by the database anymore,
+// such as files of deleted datasets, trains and projects.
+//
+// Objects are uploaded before the rows referencing them are written,
+// so objects younger than GracePeriod are never deleted.
+type Collector struct {
+	Repository  Repository
+	Buckets     []Bucket
+	HttpClient  *http.Client
+	GracePeriod time.Duration
+
+	imageUrls func(csvUrl string) ([]string, error)
+	now       func() time.Time
+}
+
+// Orphan is an object not referenced by the database.
+type Orphan struct {
+	Url          string    `json:"url"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Expired      bool      `json:"expired"` // older than the grace period
+	Deleted      bool      `json:"deleted"`
+}
+
+type Report struct {
+	DryRun      bool      `json:"dryRun"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+	Objects     int       `json:"objects"`
+	Orphans     []Orphan  `json:"orphans"`
+	OrphanSize  int64     `json:"orphanSize"`
+	Deleted     int       `json:"deleted"`
+	DeletedSize int64     `json:"deletedSize"`
+	Failed      int       `json:"failed"`
+}
+
+// Run collects orphan objects.
+// In dry run mode the orphans are only reported,
+// otherwise orphans older than the grace period are deleted.
+func (c *Collector) Run(dryRun bool) (Report, error) {
+	report := Report{
+		DryRun:    dryRun,
+		StartTime: c.timeNow(),
+		Orphans:   make([]Orphan, 0),
+	}
+
+	// list before finding references,
+	// so that objects referenced while listing are not regarded as orphans.
+	listings := make([][]cloud.Object, len(c.Buckets))
+	objects := make([]cloud.Object, 0)
+	for i, bucket := range c.Buckets {
+		listed, err := bucket.List()
+		if err != nil {
+			return Report{}, errors.Wrap(err, "failed to list objects")
+		}
+		listings[i] = listed
+		objects = append(objects, listed...)
+	}
+	report.Objects = len(objects)
+
+	referenced, err := c.findReferencedUrls(objects)
+	if err != nil {
+		return Report{}, err
+	}
+
+	expiry := report.StartTime.Add(-c.gracePeriod())
+	for i, bucket := range c.Buckets {
+		for _, object := range listings[i] {
+			if _, ok := referenced[object.Url]; ok {
+				continue
+			}
+
+			orphan := Orphan{
+				Url:          object.Url,
+				Size:         object.Size,
+				LastModified: object.LastModified,
+				Expired:      object.LastModified.Before(expiry),
+			}
+			report.OrphanSize += orphan.Size
+
+			if !dryRun && orphan.Expired {
+				if err := bucket.Delete(orphan.Url); err != nil {
+					log.Errorw("failed to delete orphan object",
+						"error", err,
+						"url", orphan.Url)
+					report.Failed++
+				} else {
+					orphan.Deleted = true
+					report.Deleted++
+					report.DeletedSize += orphan.Size
+				}
+			}
+
+			report.Orphans = append(report.Orphans, orphan)
+		}
+	}
+
+	report.EndTime = c.timeNow()
+	return report, nil
+}
+
+// findReferencedUrls finds urls referenced by the database,
+// including images listed in the referenced image dataset csv files.
+func (c *Collector) findReferencedUrls(objects []cloud.Object) (map[string]struct{}, error) {
+	urls, err := c.Repository.FindReferencedUrls()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find referenced urls")
+	}
+
+	referenced := make(map[string]struct{}, len(urls))
+	for _, url := range urls {
+		referenced[url] = struct{}{}
+	}
+
+	csvUrls, err := c.Repository.FindReferencedCsvUrls()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find referenced csv urls")
+	}
+
+	listed := make(map[string]struct{}, len(objects))
+	for _, object := range objects {
+		listed[object.Url] = struct{}{}
+	}
+
+	for _, csvUrl := range csvUrls {
+		// csv files not listed are not ours, or were deleted already
+		if _, ok := listed[csvUrl]; !ok {
+			continue
+		}
+
+		imageUrls, err := c.findImageUrls(csvUrl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read images of %s", csvUrl)
+		}
+		for _, url := range imageUrls {
+			referenced[url] = struct{}{}
+		}
+	}
+
+	return referenced, nil
+}
+
+func (c *Collector) findImageUrls(csvUrl string) ([]string, error) {
+	if c.imageUrls != nil {
+		return c.imageUrls(csvUrl)
+	}
+	return dataset.ImageUrls(c.HttpClient, csvUrl)
+}
+
+func (c *Collector) gracePeriod() time.Duration {
+	if c.GracePeriod <= 0 {
+		return DefaultGracePeriod
+	}
+	return c.GracePeriod
+}
+
+func (c *Collector) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,121 @@
+package gc
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"nns_back/cloud"
+	"nns_back/log"
+	"testing"
+	"time"
+)
+
+type fakeBucket struct {
+	objects []cloud.Object
+	deleted []string
+	failUrl string
+}
+
+func (b *fakeBucket) List() ([]cloud.Object, error) {
+	return b.objects, nil
+}
+
+func (b *fakeBucket) Delete(url string) error {
+	if url == b.failUrl {
+		return errors.New("access denied")
+	}
+	b.deleted = append(b.deleted, url)
+	return nil
+}
+
+type fakeRepository struct {
+	urls    []string
+	csvUrls []string
+}
+
+func (r fakeRepository) FindReferencedUrls() ([]string, error) {
+	return r.urls, nil
+}
+
+func (r fakeRepository) FindReferencedCsvUrls() ([]string, error) {
+	return r.csvUrls, nil
+}
+
+func newTestCollector(bucket *fakeBucket, now time.Time) *Collector {
+	return &Collector{
+		Repository: fakeRepository{
+			urls:    []string{"dataset.csv", "origin.zip", "model.zip", "not-listed.csv"},
+			csvUrls: []string{"dataset.csv", "not-listed.csv"},
+		},
+		Buckets:     []Bucket{bucket},
+		GracePeriod: time.Hour,
+		imageUrls: func(csvUrl string) ([]string, error) {
+			if csvUrl != "dataset.csv" {
+				return nil, errors.New("not listed csv must not be read")
+			}
+			return []string{"image-1.png", "image-2.png"}, nil
+		},
+		now: func() time.Time { return now },
+	}
+}
+
+func TestCollector_Run(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	now := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-2 * time.Hour)
+	objects := []cloud.Object{
+		{Url: "dataset.csv", Size: 10, LastModified: old},
+		{Url: "origin.zip", Size: 10, LastModified: old},
+		{Url: "image-1.png", Size: 10, LastModified: old},
+		{Url: "image-2.png", Size: 10, LastModified: old},
+		{Url: "model.zip", Size: 10, LastModified: old},
+		{Url: "deleted-model.zip", Size: 100, LastModified: old},
+		{Url: "deleted-image.png", Size: 20, LastModified: old},
+		{Url: "uploading.csv", Size: 30, LastModified: now.Add(-time.Minute)},
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		bucket := &fakeBucket{objects: objects}
+		report, err := newTestCollector(bucket, now).Run(true)
+		assert.NoError(t, err)
+
+		assert.Empty(t, bucket.deleted)
+		assert.Equal(t, 8, report.Objects)
+		assert.Equal(t, []Orphan{
+			{Url: "deleted-model.zip", Size: 100, LastModified: old, Expired: true},
+			{Url: "deleted-image.png", Size: 20, LastModified: old, Expired: true},
+			{Url: "uploading.csv", Size: 30, LastModified: now.Add(-time.Minute)},
+		}, report.Orphans)
+		assert.Equal(t, int64(150), report.OrphanSize)
+		assert.Equal(t, 0, report.Deleted)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		bucket := &fakeBucket{objects: objects, failUrl: "deleted-image.png"}
+		report, err := newTestCollector(bucket, now).Run(false)
+		assert.NoError(t, err)
+
+		// objects in the grace period are kept
+		assert.Equal(t, []string{"deleted-model.zip"}, bucket.deleted)
+		assert.Equal(t, 1, report.Deleted)
+		assert.Equal(t, int64(100), report.DeletedSize)
+		assert.Equal(t, 1, report.Failed)
+		assert.True(t, report.Orphans[0].Deleted)
+		assert.False(t, report.Orphans[1].Deleted)
+		assert.False(t, report.Orphans[2].Deleted)
+	})
+}
+
+func TestCollector_RunImageUrlsError(t *testing.T) {
+	bucket := &fakeBucket{objects: []cloud.Object{{Url: "dataset.csv"}, {Url: "image.png"}}}
+	collector := newTestCollector(bucket, time.Now())
+	collector.imageUrls = func(string) ([]string, error) {
+		return nil, errors.New("timeout")
+	}
+
+	// never delete with partial references
+	_, err := collector.Run(false)
+	assert.Error(t, err)
+	assert.Empty(t, bucket.deleted)
+}
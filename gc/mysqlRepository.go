@@ -0,0 +1,79 @@
+package gc
+
+import "github.com/jmoiron/sqlx"
+
+type mysqlRepository struct {
+	db *sqlx.DB
+}
+
+func NewMysqlRepository(db *sqlx.DB) Repository {
+	return &mysqlRepository{
+		db: db,
+	}
+}
+
+// A train is live until it or its project is deleted.
+const _liveTrainCondition = `t.status != 'DEL'
+  AND EXISTS(SELECT 1 FROM project p WHERE p.id = t.project_id AND p.status != 'DELETED')`
+
+// A version is live while its dataset is not deleted,
+// or while a live train was trained with it.
+const _liveVersionCondition = `dsv.status != 'DELETED'
+  AND (EXISTS(SELECT 1 FROM dataset ds WHERE ds.id = dsv.dataset_id AND ds.status != 'DELETED')
+    OR EXISTS(SELECT 1
+              FROM train_config tc
+                       JOIN train t ON tc.train_id = t.id
+              WHERE tc.dataset_version_id = dsv.id
+                AND ` + _liveTrainCondition + `))`
+
+const _referencedCsvUrlsQuery = `
+SELECT ds.url AS url FROM dataset ds WHERE ds.status != 'DELETED'
+UNION
+SELECT dsv.url FROM dataset_version dsv WHERE ` + _liveVersionCondition + `
+UNION
+SELECT tc.train_dataset_url FROM train_config tc JOIN train t ON tc.train_id = t.id WHERE ` + _liveTrainCondition + `
+UNION
+SELECT tc.valid_dataset_url FROM train_config tc JOIN train t ON tc.train_id = t.id WHERE ` + _liveTrainCondition + `
+UNION
+SELECT tc.test_dataset_url FROM train_config tc JOIN train t ON tc.train_id = t.id WHERE ` + _liveTrainCondition
+
+func (m *mysqlRepository) FindReferencedUrls() ([]string, error) {
+	var urls []string
+	err := m.db.Select(&urls, `
+SELECT url FROM (`+_referencedCsvUrlsQuery+`
+UNION
+SELECT ds.origin_url FROM dataset ds WHERE ds.status != 'DELETED'
+UNION
+SELECT dsv.origin_url FROM dataset_version dsv WHERE `+_liveVersionCondition+`
+UNION
+SELECT dsvo.url FROM dataset_version_object dsvo JOIN dataset_version dsv ON dsvo.version_id = dsv.id WHERE `+_liveVersionCondition+`
+UNION
+SELECT t.result_url FROM train t WHERE `+_liveTrainCondition+`
+UNION
+SELECT i.url
+FROM image i
+WHERE EXISTS(SELECT 1 FROM user u WHERE u.profile_image = i.id AND u.status != 'DELETED')
+   OR EXISTS(SELECT 1 FROM dataset ds WHERE ds.image_id = i.id AND ds.status != 'DELETED')
+) referenced
+WHERE url IS NOT NULL AND url != '';
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (m *mysqlRepository) FindReferencedCsvUrls() ([]string, error) {
+	var urls []string
+	err := m.db.Select(&urls, `
+SELECT url FROM (`+_referencedCsvUrlsQuery+`
+) referenced
+WHERE url IS NOT NULL AND url != '';
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,9 @@
+package gc
+
+type Repository interface {
+	// FindReferencedUrls finds urls of every object referenced by live rows.
+	FindReferencedUrls() ([]string, error)
+	// FindReferencedCsvUrls finds urls of the referenced dataset csv files,
+	// which may list images uploaded separately.
+	FindReferencedCsvUrls() ([]string, error)
+}
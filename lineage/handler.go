@@ -0,0 +1,306 @@
+package lineage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"nns_back/dataset"
+	"nns_back/log"
+	"nns_back/util"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type handler struct {
+	repository        Repository
+	datasetRepository dataset.Repository
+}
+
+func NewHandler(repository Repository, datasetRepository dataset.Repository) *handler {
+	return &handler{
+		repository:        repository,
+		datasetRepository: datasetRepository,
+	}
+}
+
+type DatasetLineageResponseBody struct {
+	DatasetId int64         `json:"datasetId"`
+	Configs   []ConfigDto   `json:"configs"`
+	Projects  []ProjectDto  `json:"projects"`
+	Trains    []TrainDto    `json:"trains"`
+	Others    OtherUsersDto `json:"others"`
+}
+
+type ConfigDto struct {
+	Id               int64  `json:"id"`
+	Name             string `json:"name"`
+	DatasetVersionId *int64 `json:"datasetVersionId"` // latest version if null
+	Valid            bool   `json:"valid"`
+	ProjectNo        int    `json:"projectNo"`
+}
+
+type ProjectDto struct {
+	ProjectNo int    `json:"projectNo"`
+	Name      string `json:"name"`
+	Configs   int    `json:"configs"`
+	Trains    int    `json:"trains"`
+}
+
+type TrainDto struct {
+	TrainNo          int64     `json:"trainNo"`
+	Name             string    `json:"name"`
+	Status           string    `json:"status"`
+	DatasetVersionId *int64    `json:"datasetVersionId"`
+	VersionNo        *int64    `json:"versionNo"`
+	DatasetConfigId  *int64    `json:"datasetConfigId"`
+	ProjectNo        int       `json:"projectNo"`
+	CreateTime       time.Time `json:"createTime"`
+}
+
+// OtherUsersDto counts the references of other users of a public or shared dataset.
+// Their projects are not exposed.
+type OtherUsersDto struct {
+	Users    int `json:"users"`
+	Configs  int `json:"configs"`
+	Projects int `json:"projects"`
+	Trains   int `json:"trains"`
+}
+
+// GetDatasetLineage lists the dataset configs, projects and trains which used the dataset,
+// so that the impact of changing or deleting the dataset can be seen.
+func (h *handler) GetDatasetLineage(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	datasetId, err := util.Atoi64(mux.Vars(r)["datasetId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	ds, err := h.datasetRepository.FindByID(datasetId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warnw("invalid datasetId",
+				"requested datasetId", datasetId)
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+			return
+		}
+		log.Errorf("failed to FindByID(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	accessible, err := dataset.IsAccessible(h.datasetRepository, ds, userId)
+	if err != nil {
+		log.Errorf("failed to find dataset permission: %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !accessible {
+		log.Warnw("inaccessible dataset",
+			"requested datasetId", datasetId,
+			"userId", userId)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetId)
+		return
+	}
+
+	configs, err := h.repository.FindConfigsByDatasetId(datasetId)
+	if err != nil {
+		log.Errorf("failed to FindConfigsByDatasetId(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	trains, err := h.repository.FindTrainsByDatasetId(datasetId)
+	if err != nil {
+		log.Errorf("failed to FindTrainsByDatasetId(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, newDatasetLineageResponseBody(datasetId, userId, configs, trains))
+}
+
+// newDatasetLineageResponseBody lists the references of the user,
+// and counts the references of other users.
+func newDatasetLineageResponseBody(datasetId int64, userId int64, configs []ConfigRef, trains []TrainRef) DatasetLineageResponseBody {
+	resp := DatasetLineageResponseBody{
+		DatasetId: datasetId,
+		Configs:   make([]ConfigDto, 0),
+		Projects:  make([]ProjectDto, 0),
+		Trains:    make([]TrainDto, 0),
+	}
+
+	projects := make(map[int64]*ProjectDto)
+	project := func(id int64, no int, name string) *ProjectDto {
+		if _, ok := projects[id]; !ok {
+			projects[id] = &ProjectDto{ProjectNo: no, Name: name}
+		}
+		return projects[id]
+	}
+
+	otherUsers := make(map[int64]struct{})
+	otherProjects := make(map[int64]struct{})
+
+	for _, c := range configs {
+		if c.UserId != userId {
+			otherUsers[c.UserId] = struct{}{}
+			otherProjects[c.ProjectId] = struct{}{}
+			resp.Others.Configs++
+			continue
+		}
+
+		resp.Configs = append(resp.Configs, ConfigDto{
+			Id:               c.Id,
+			Name:             c.Name,
+			DatasetVersionId: nullInt64ToPtr(c.DatasetVersionId),
+			Valid:            c.Valid,
+			ProjectNo:        c.ProjectNo,
+		})
+		project(c.ProjectId, c.ProjectNo, c.ProjectName).Configs++
+	}
+
+	for _, t := range trains {
+		if t.UserId != userId {
+			otherUsers[t.UserId] = struct{}{}
+			otherProjects[t.ProjectId] = struct{}{}
+			resp.Others.Trains++
+			continue
+		}
+
+		resp.Trains = append(resp.Trains, TrainDto{
+			TrainNo:          t.TrainNo,
+			Name:             t.Name.String,
+			Status:           t.Status,
+			DatasetVersionId: nullInt64ToPtr(t.DatasetVersionId),
+			VersionNo:        nullInt64ToPtr(t.VersionNo),
+			DatasetConfigId:  nullInt64ToPtr(t.DatasetConfigId),
+			ProjectNo:        t.ProjectNo,
+			CreateTime:       t.CreateTime,
+		})
+		project(t.ProjectId, t.ProjectNo, t.ProjectName).Trains++
+	}
+
+	for _, p := range projects {
+		resp.Projects = append(resp.Projects, *p)
+	}
+	sort.Slice(resp.Projects, func(i, j int) bool {
+		return resp.Projects[i].ProjectNo < resp.Projects[j].ProjectNo
+	})
+
+	resp.Others.Users = len(otherUsers)
+	resp.Others.Projects = len(otherProjects)
+
+	return resp
+}
+
+type TrainLineageResponseBody struct {
+	TrainNo       int64                  `json:"trainNo"`
+	Status        string                 `json:"status"`
+	Dataset       TrainLineageDatasetDto `json:"dataset"`
+	DatasetConfig TrainLineageConfigDto  `json:"datasetConfig"`
+}
+
+type TrainLineageDatasetDto struct {
+	Id        *int64 `json:"id"` // null if unknown
+	Name      string `json:"name"`
+	Deleted   bool   `json:"deleted"`
+	VersionId *int64 `json:"versionId"`
+	VersionNo *int64 `json:"versionNo"`
+
+	// the split urls the train was trained with
+	TrainUrl      string `json:"trainUrl"`
+	ValidationUrl string `json:"validationUrl"`
+	TestUrl       string `json:"testUrl"`
+}
+
+// TrainLineageConfigDto is the dataset config as it was when the train started.
+type TrainLineageConfigDto struct {
+	Id                  *int64          `json:"id"` // null if unknown
+	Name                string          `json:"name"`
+	Deleted             bool            `json:"deleted"`
+	Shuffle             bool            `json:"shuffle"`
+	Label               string          `json:"label"`
+	NormalizationMethod *string         `json:"normalizationMethod"`
+	Pipeline            json.RawMessage `json:"pipeline"`
+}
+
+// GetTrainLineage shows the exact dataset and config the train used.
+func (h *handler) GetTrainLineage(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectNo, err := strconv.Atoi(vars["projectNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+	trainNo, err := util.Atoi64(vars["trainNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	lineage, err := h.repository.FindTrain(userId, projectNo, trainNo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorf("failed to FindTrain(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	var normalizationMethod *string
+	if lineage.NormalizationMethod.Valid {
+		normalizationMethod = &lineage.NormalizationMethod.String
+	}
+
+	util.WriteJson(w, http.StatusOK, TrainLineageResponseBody{
+		TrainNo: lineage.TrainNo,
+		Status:  lineage.Status,
+		Dataset: TrainLineageDatasetDto{
+			Id:            nullInt64ToPtr(lineage.DatasetId),
+			Name:          lineage.DatasetName.String,
+			Deleted:       lineage.DatasetStatus.String == dataset.DELETED,
+			VersionId:     nullInt64ToPtr(lineage.DatasetVersionId),
+			VersionNo:     nullInt64ToPtr(lineage.VersionNo),
+			TrainUrl:      lineage.TrainDatasetUrl,
+			ValidationUrl: lineage.ValidDatasetUrl.String,
+			TestUrl:       lineage.TestDatasetUrl.String,
+		},
+		DatasetConfig: TrainLineageConfigDto{
+			Id:                  nullInt64ToPtr(lineage.DatasetConfigId),
+			Name:                lineage.DatasetConfigName.String,
+			Deleted:             lineage.DatasetConfigStatus.String == string(util.StatusDELETED),
+			Shuffle:             lineage.Shuffle,
+			Label:               lineage.Label,
+			NormalizationMethod: normalizationMethod,
+			Pipeline:            lineage.Pipeline.Json,
+		},
+	})
+}
+
+func nullInt64ToPtr(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
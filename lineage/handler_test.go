@@ -0,0 +1,38 @@
+package lineage
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_newDatasetLineageResponseBody(t *testing.T) {
+	assert := assert.New(t)
+
+	configs := []ConfigRef{
+		{Id: 1, Name: "mine", UserId: 1, ProjectId: 10, ProjectNo: 2, ProjectName: "second"},
+		{Id: 2, Name: "theirs", UserId: 2, ProjectId: 20, ProjectNo: 1, ProjectName: "private"},
+	}
+	trains := []TrainRef{
+		{Id: 1, TrainNo: 1, Status: "FIN", UserId: 1, ProjectId: 11, ProjectNo: 1, ProjectName: "first",
+			DatasetConfigId: sql.NullInt64{Int64: 3, Valid: true}},
+		{Id: 2, TrainNo: 2, Status: "TRAIN", UserId: 1, ProjectId: 10, ProjectNo: 2, ProjectName: "second",
+			DatasetConfigId: sql.NullInt64{Int64: 1, Valid: true}},
+		{Id: 3, TrainNo: 1, Status: "FIN", UserId: 3, ProjectId: 30, ProjectNo: 1, ProjectName: "private"},
+	}
+
+	resp := newDatasetLineageResponseBody(5, 1, configs, trains)
+
+	assert.Equal(int64(5), resp.DatasetId)
+	if assert.Len(resp.Configs, 1) {
+		assert.Equal("mine", resp.Configs[0].Name)
+	}
+	if assert.Len(resp.Trains, 2) {
+		assert.Equal(int64(3), *resp.Trains[0].DatasetConfigId)
+	}
+	assert.Equal([]ProjectDto{
+		{ProjectNo: 1, Name: "first", Configs: 0, Trains: 1},
+		{ProjectNo: 2, Name: "second", Configs: 1, Trains: 1},
+	}, resp.Projects)
+	assert.Equal(OtherUsersDto{Users: 2, Configs: 1, Projects: 2, Trains: 1}, resp.Others)
+}
@@ -0,0 +1,63 @@
+package lineage
+
+import (
+	"database/sql"
+	"nns_back/util"
+	"time"
+)
+
+// ConfigRef is a dataset config referencing a dataset.
+type ConfigRef struct {
+	Id               int64         `db:"id"`
+	Name             string        `db:"name"`
+	DatasetVersionId sql.NullInt64 `db:"dataset_version_id"` // latest version if not valid
+	Valid            bool          `db:"valid"`
+	UserId           int64         `db:"user_id"`
+	ProjectId        int64         `db:"project_id"`
+	ProjectNo        int           `db:"project_no"`
+	ProjectName      string        `db:"project_name"`
+}
+
+// TrainRef is a train trained with a dataset.
+type TrainRef struct {
+	Id               int64          `db:"id"`
+	TrainNo          int64          `db:"train_no"`
+	Name             sql.NullString `db:"name"`
+	Status           string         `db:"status"`
+	DatasetVersionId sql.NullInt64  `db:"dataset_version_id"`
+	VersionNo        sql.NullInt64  `db:"version_no"`
+	DatasetConfigId  sql.NullInt64  `db:"dataset_config_id"`
+	UserId           int64          `db:"user_id"`
+	ProjectId        int64          `db:"project_id"`
+	ProjectNo        int            `db:"project_no"`
+	ProjectName      string         `db:"project_name"`
+	CreateTime       time.Time      `db:"create_time"`
+}
+
+// TrainLineage is the dataset and config a train used.
+// The dataset and config may be changed or deleted after the train,
+// so the values the train actually used are recorded in the train config.
+type TrainLineage struct {
+	TrainId int64  `db:"train_id"`
+	TrainNo int64  `db:"train_no"`
+	Status  string `db:"status"`
+
+	DatasetId        sql.NullInt64  `db:"dataset_id"` // null for trains before lineage was recorded and not versioned
+	DatasetName      sql.NullString `db:"dataset_name"`
+	DatasetStatus    sql.NullString `db:"dataset_status"`
+	DatasetVersionId sql.NullInt64  `db:"dataset_version_id"`
+	VersionNo        sql.NullInt64  `db:"version_no"`
+
+	DatasetConfigId     sql.NullInt64  `db:"dataset_config_id"`
+	DatasetConfigName   sql.NullString `db:"dataset_config_name"`
+	DatasetConfigStatus sql.NullString `db:"dataset_config_status"`
+
+	// values used by the train
+	TrainDatasetUrl     string         `db:"train_dataset_url"`
+	ValidDatasetUrl     sql.NullString `db:"valid_dataset_url"`
+	TestDatasetUrl      sql.NullString `db:"test_dataset_url"`
+	Shuffle             bool           `db:"dataset_shuffle"`
+	Label               string         `db:"dataset_label"`
+	NormalizationMethod sql.NullString `db:"dataset_normalization_method"`
+	Pipeline            util.NullJson  `db:"dataset_pipeline"`
+}
@@ -0,0 +1,118 @@
+package lineage
+
+import "github.com/jmoiron/sqlx"
+
+type mysqlRepository struct {
+	db *sqlx.DB
+}
+
+func NewMysqlRepository(db *sqlx.DB) Repository {
+	return &mysqlRepository{
+		db: db,
+	}
+}
+
+// trains before the dataset id was recorded are traced by the dataset version.
+const _trainDatasetId = `COALESCE(tc.dataset_id, dsv.dataset_id)`
+
+func (m *mysqlRepository) FindConfigsByDatasetId(datasetId int64) ([]ConfigRef, error) {
+	configs := make([]ConfigRef, 0)
+	err := m.db.Select(&configs, `
+SELECT dc.id                 "id",
+       dc.name               "name",
+       dc.dataset_version_id "dataset_version_id",
+       dc.valid              "valid",
+       p.user_id             "user_id",
+       p.id                  "project_id",
+       p.project_no          "project_no",
+       p.name                "project_name"
+FROM dataset_config dc
+         JOIN project p ON dc.project_id = p.id
+WHERE dc.dataset_id = ?
+  AND dc.status = 'EXIST'
+  AND p.status != 'DELETED'
+ORDER BY dc.id;
+`, datasetId)
+
+	return configs, err
+}
+
+// _trainRefColumns are the columns of TrainRef from train t, train_config tc, project p and dataset_version dsv.
+const _trainRefColumns = `t.id                  "id",
+       t.train_no            "train_no",
+       t.name                "name",
+       t.status              "status",
+       tc.dataset_version_id "dataset_version_id",
+       dsv.version_no        "version_no",
+       tc.dataset_config_id  "dataset_config_id",
+       p.user_id             "user_id",
+       p.id                  "project_id",
+       p.project_no          "project_no",
+       p.name                "project_name",
+       tc.create_time        "create_time"`
+
+// FindTrainsByDatasetId finds the trains by the dataset id of the train config,
+// and the trains before the dataset id was recorded by the dataset of the version,
+// in separate queries so that each can use the index of the dataset id.
+func (m *mysqlRepository) FindTrainsByDatasetId(datasetId int64) ([]TrainRef, error) {
+	trains := make([]TrainRef, 0)
+	err := m.db.Select(&trains, `
+SELECT `+_trainRefColumns+`
+FROM train t
+         JOIN train_config tc ON t.id = tc.train_id
+         JOIN project p ON t.project_id = p.id
+         LEFT JOIN dataset_version dsv ON tc.dataset_version_id = dsv.id
+WHERE tc.dataset_id = ?
+  AND t.status != 'DEL'
+  AND p.status != 'DELETED'
+UNION ALL
+SELECT `+_trainRefColumns+`
+FROM dataset_version dsv
+         JOIN train_config tc ON dsv.id = tc.dataset_version_id
+         JOIN train t ON tc.train_id = t.id
+         JOIN project p ON t.project_id = p.id
+WHERE dsv.dataset_id = ?
+  AND tc.dataset_id IS NULL
+  AND t.status != 'DEL'
+  AND p.status != 'DELETED'
+ORDER BY id;
+`, datasetId, datasetId)
+
+	return trains, err
+}
+
+func (m *mysqlRepository) FindTrain(userId int64, projectNo int, trainNo int64) (TrainLineage, error) {
+	var lineage TrainLineage
+	err := m.db.QueryRowx(`
+SELECT t.id                            "train_id",
+       t.train_no                      "train_no",
+       t.status                        "status",
+       `+_trainDatasetId+`             "dataset_id",
+       ds.name                         "dataset_name",
+       ds.status                       "dataset_status",
+       tc.dataset_version_id           "dataset_version_id",
+       dsv.version_no                  "version_no",
+       tc.dataset_config_id            "dataset_config_id",
+       dc.name                         "dataset_config_name",
+       dc.status                       "dataset_config_status",
+       tc.train_dataset_url            "train_dataset_url",
+       tc.valid_dataset_url            "valid_dataset_url",
+       tc.test_dataset_url             "test_dataset_url",
+       tc.dataset_shuffle              "dataset_shuffle",
+       tc.dataset_label                "dataset_label",
+       tc.dataset_normalization_method "dataset_normalization_method",
+       tc.dataset_pipeline             "dataset_pipeline"
+FROM train t
+         JOIN train_config tc ON t.id = tc.train_id
+         JOIN project p ON t.project_id = p.id
+         LEFT JOIN dataset_version dsv ON tc.dataset_version_id = dsv.id
+         LEFT JOIN dataset ds ON `+_trainDatasetId+` = ds.id
+         LEFT JOIN dataset_config dc ON tc.dataset_config_id = dc.id
+WHERE p.user_id = ?
+  AND p.project_no = ?
+  AND t.train_no = ?
+  AND t.status != 'DEL';
+`, userId, projectNo, trainNo).StructScan(&lineage)
+
+	return lineage, err
+}
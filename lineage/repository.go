@@ -0,0 +1,10 @@
+package lineage
+
+type Repository interface {
+	// FindConfigsByDatasetId finds active dataset configs of live projects using the dataset.
+	FindConfigsByDatasetId(datasetId int64) ([]ConfigRef, error)
+	// FindTrainsByDatasetId finds trains of live projects trained with the dataset.
+	FindTrainsByDatasetId(datasetId int64) ([]TrainRef, error)
+	// FindTrain finds the dataset and config the train of the user used.
+	FindTrain(userId int64, projectNo int, trainNo int64) (TrainLineage, error)
+}
@@ -31,6 +31,12 @@ func main() {
 	db.SetMaxOpenConns(10)
 	db.SetMaxIdleConns(10)
 
+	// storage garbage collector
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		service.StartStorageGC(db, os.Args[2:])
+		return
+	}
+
 	// start server
 	service.Start(":8080", db, service.SetSessionStore([]byte(os.Getenv("SESSKEY"))))
 }
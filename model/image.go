@@ -8,14 +8,16 @@ type Image struct {
 	Id         int64     `db:"id"`
 	UserId     int64     `db:"user_id"`
 	Url        string    `db:"url"`
+	Size       int64     `db:"size"` // bytes
 	CreateTime time.Time `db:"create_time"`
 	UpdateTime time.Time `db:"update_time"`
 }
 
-func NewImage(userId int64, url string) Image {
+func NewImage(userId int64, url string, size int64) Image {
 	return Image{
 		UserId:     userId,
 		Url:        url,
+		Size:       size,
 		CreateTime: time.Now(),
 		UpdateTime: time.Now(),
 	}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Team is a group of users to share datasets with.
+type Team struct {
+	Id         int64     `db:"id"`
+	OwnerId    int64     `db:"owner_id"`
+	Name       string    `db:"name"`
+	CreateTime time.Time `db:"create_time"`
+	UpdateTime time.Time `db:"update_time"`
+}
+
+func NewTeam(ownerId int64, name string) Team {
+	return Team{
+		OwnerId:    ownerId,
+		Name:       name,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}
+}
+
+type TeamMember struct {
+	TeamId     int64     `db:"team_id"`
+	UserId     int64     `db:"user_id"`
+	UserName   string    `db:"user_name"`
+	CreateTime time.Time `db:"create_time"`
+}
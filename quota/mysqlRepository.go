@@ -0,0 +1,109 @@
+package quota
+
+import "github.com/jmoiron/sqlx"
+
+type mysqlRepository struct {
+	db           *sqlx.DB
+	defaultQuota int64
+}
+
+// NewMysqlRepository returns a Repository
+// which applies defaultQuota to users without their own quota.
+func NewMysqlRepository(db *sqlx.DB, defaultQuota int64) Repository {
+	return &mysqlRepository{
+		db:           db,
+		defaultQuota: defaultQuota,
+	}
+}
+
+func (m *mysqlRepository) FindUsage(userId int64) (Usage, error) {
+	return findUsage(m.db, userId, m.defaultQuota)
+}
+
+func (m *mysqlRepository) ReserveUsage(userId int64, size int64, fn func(usage Usage) error) (int64, error) {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the usage of the user is locked by the user row, so that the next reservation waits until
+	// this one is committed, and then sums the usage including it
+	var lockedId int64
+	if err := tx.Get(&lockedId, `SELECT id FROM user WHERE id = ? FOR UPDATE;`, userId); err != nil {
+		return 0, err
+	}
+
+	usage, err := findUsage(tx, userId, m.defaultQuota)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := fn(usage); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO storage_reservation (user_id, size) VALUES (?, ?);`, userId, size)
+	if err != nil {
+		return 0, err
+	}
+	reservationId, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return reservationId, tx.Commit()
+}
+
+func (m *mysqlRepository) ReleaseUsage(reservationId int64) error {
+	_, err := m.db.Exec(`DELETE FROM storage_reservation WHERE id = ?;`, reservationId)
+	return err
+}
+
+// findUsage sums sizes of the objects kept for the user.
+// Versions of deleted datasets are kept while trains use them,
+// and images are kept while they are in use or just uploaded.
+// Files derived from dataset versions for the user's trains are kept with the versions.
+// Reservations of the stores in progress are counted, unless left by a store interrupted an hour ago.
+func findUsage(q sqlx.Queryer, userId int64, defaultQuota int64) (Usage, error) {
+	var usage Usage
+	err := q.QueryRowx(`
+SELECT (SELECT IFNULL(SUM(dsv.size), 0)
+        FROM dataset_version dsv
+                 JOIN dataset ds ON dsv.dataset_id = ds.id
+        WHERE ds.user_id = ?
+          AND dsv.status != 'DELETED'
+          AND (ds.status != 'DELETED'
+            OR EXISTS(SELECT 1
+                      FROM train_config tc
+                               JOIN train t ON tc.train_id = t.id
+                      WHERE tc.dataset_version_id = dsv.id
+                        AND t.status != 'DEL')))
+           + (SELECT IFNULL(SUM(ds.size), 0)
+              FROM dataset ds
+              WHERE ds.user_id = ?
+                AND ds.status != 'DELETED'
+                AND NOT EXISTS(SELECT 1 FROM dataset_version dsv WHERE dsv.dataset_id = ds.id)) "datasets",
+       (SELECT IFNULL(SUM(dsvo.size), 0)
+        FROM dataset_version_object dsvo
+                 JOIN dataset_version dsv ON dsvo.version_id = dsv.id
+        WHERE dsvo.user_id = ?
+          AND dsv.status != 'DELETED') "derived",
+       (SELECT IFNULL(SUM(i.size), 0)
+        FROM image i
+        WHERE i.user_id = ?
+          AND (i.create_time > NOW() - INTERVAL 1 DAY
+            OR EXISTS(SELECT 1 FROM user u WHERE u.profile_image = i.id AND u.status != 'DELETED')
+            OR EXISTS(SELECT 1 FROM dataset ds WHERE ds.image_id = i.id AND ds.status != 'DELETED'))) "images",
+       (SELECT IFNULL(SUM(t.result_size), 0)
+        FROM train t
+        WHERE t.user_id = ?
+          AND t.status != 'DEL') "models",
+       (SELECT IFNULL(SUM(sr.size), 0)
+        FROM storage_reservation sr
+        WHERE sr.user_id = ?
+          AND sr.create_time > NOW() - INTERVAL 1 HOUR) "reserved",
+       IFNULL((SELECT u.storage_quota FROM user u WHERE u.id = ?), ?) "quota";
+`, userId, userId, userId, userId, userId, userId, userId, defaultQuota).StructScan(&usage)
+	return usage, err
+}
@@ -0,0 +1,60 @@
+package quota
+
+import (
+	"github.com/pkg/errors"
+	"nns_back/log"
+)
+
+// DefaultQuota is the storage quota of users without their own quota, in bytes.
+const DefaultQuota int64 = 5 << 30
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Usage is the bytes stored by a user.
+type Usage struct {
+	Datasets int64 `db:"datasets"` // uploaded dataset files of every version
+	Derived  int64 `db:"derived"`  // split and normalized dataset files of trains
+	Images   int64 `db:"images"`
+	Models   int64 `db:"models"`   // trained models
+	Reserved int64 `db:"reserved"` // bytes being stored
+	Quota    int64 `db:"quota"`
+}
+
+func (u Usage) Total() int64 {
+	return u.Datasets + u.Derived + u.Images + u.Models + u.Reserved
+}
+
+func (u Usage) Available() int64 {
+	if available := u.Quota - u.Total(); available > 0 {
+		return available
+	}
+	return 0
+}
+
+// Reserve stores size more bytes for the user by store, or returns ErrQuotaExceeded if it exceeds the user's quota.
+// freed is the bytes released by the store, such as a replaced file.
+// The bytes are reserved before store is called, so that concurrent stores of a user can't exceed the quota together
+// without waiting for each other, and the reservation is released when store returns.
+// store must have written what the usage counts when it returns.
+func Reserve(repo Repository, userId int64, size, freed int64, store func() error) error {
+	reservationId, err := repo.ReserveUsage(userId, size, func(usage Usage) error {
+		if usage.Total()-freed+size > usage.Quota {
+			return ErrQuotaExceeded
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the reservation left is not counted after a while
+		if err := repo.ReleaseUsage(reservationId); err != nil {
+			log.Errorw("failed to release storage reservation",
+				"error", err,
+				"userId", userId,
+				"reservationId", reservationId)
+		}
+	}()
+
+	return store()
+}
@@ -0,0 +1,94 @@
+package quota
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakeRepository struct {
+	usage    Usage
+	err      error
+	reserved map[int64]int64 // size by reservation id
+}
+
+func (r *fakeRepository) FindUsage(int64) (Usage, error) {
+	return r.usage, r.err
+}
+
+func (r *fakeRepository) ReserveUsage(userId int64, size int64, fn func(usage Usage) error) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if err := fn(r.usage); err != nil {
+		return 0, err
+	}
+	reservationId := int64(len(r.reserved) + 1)
+	r.reserved[reservationId] = size
+	r.usage.Reserved += size
+	return reservationId, nil
+}
+
+func (r *fakeRepository) ReleaseUsage(reservationId int64) error {
+	r.usage.Reserved -= r.reserved[reservationId]
+	delete(r.reserved, reservationId)
+	return nil
+}
+
+func TestUsage(t *testing.T) {
+	usage := Usage{Datasets: 40, Derived: 10, Images: 10, Models: 30, Quota: 100}
+	assert.Equal(t, int64(90), usage.Total())
+	assert.Equal(t, int64(10), usage.Available())
+
+	// quota lowered below usage
+	usage.Quota = 80
+	assert.Equal(t, int64(0), usage.Available())
+}
+
+func TestReserve(t *testing.T) {
+	repo := &fakeRepository{
+		usage:    Usage{Datasets: 50, Images: 10, Models: 30, Quota: 100},
+		reserved: map[int64]int64{},
+	}
+
+	tests := []struct {
+		name  string
+		size  int64
+		freed int64
+		want  error
+	}{
+		{name: "fits", size: 10},
+		{name: "exceeds", size: 11, want: ErrQuotaExceeded},
+		{name: "replaces", size: 40, freed: 30},
+		{name: "replaces with larger", size: 41, freed: 30, want: ErrQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := false
+			err := Reserve(repo, 1, tt.size, tt.freed, func() error {
+				// the bytes are reserved while stored
+				assert.Equal(t, tt.size, repo.usage.Reserved)
+				stored = true
+				return nil
+			})
+			assert.Equal(t, tt.want, err)
+			assert.Equal(t, tt.want == nil, stored)
+			assert.Zero(t, repo.usage.Reserved)
+		})
+	}
+
+	// the bytes being stored are not available to the concurrent stores
+	err := Reserve(repo, 1, 5, 0, func() error {
+		return Reserve(repo, 1, 6, 0, func() error { return nil })
+	})
+	assert.Equal(t, ErrQuotaExceeded, err)
+	assert.Zero(t, repo.usage.Reserved)
+
+	storeErr := errors.New("upload failed")
+	assert.Equal(t, storeErr, Reserve(repo, 1, 0, 0, func() error { return storeErr }))
+	assert.Zero(t, repo.usage.Reserved)
+
+	dbErr := errors.New("connection refused")
+	assert.Equal(t, dbErr, Reserve(&fakeRepository{err: dbErr}, 1, 0, 0, func() error { return nil }))
+}
@@ -0,0 +1,10 @@
+package quota
+
+type Repository interface {
+	FindUsage(userId int64) (Usage, error)
+	// ReserveUsage calls fn with the usage of the user, locking the usage of the user until fn returns,
+	// and reserves size bytes for the user unless fn returns an error.
+	// The reserved bytes are counted in the usage until the reservation is released.
+	ReserveUsage(userId int64, size int64, fn func(usage Usage) error) (reservationId int64, err error)
+	ReleaseUsage(reservationId int64) error
+}
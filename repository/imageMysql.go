@@ -21,6 +21,7 @@ func (r *imageMysqlRepository) SelectImage(userId, id int64) (model.Image, error
 SELECT i.id, 
        i.user_id, 
        i.url, 
+       i.size,
        i.create_time, 
        i.update_time
 FROM image i
@@ -33,10 +34,12 @@ func (r *imageMysqlRepository) Insert(image model.Image) (int64, error) {
 	result, err := r.db.NamedExec(`
 INSERT INTO image (user_id, 
                    url, 
+                   size,
                    create_time, 
                    update_time)
 VALUES (:user_id,
         :url,
+        :size,
         :create_time,
         :update_time);`, image)
 	if err != nil {
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"nns_back/model"
+)
+
+type TeamRepository interface {
+	SelectTeam(teamId int64) (model.Team, error)
+	SelectTeamsByUserId(userId int64) ([]model.Team, error)
+	Insert(team model.Team) (int64, error) // the owner becomes the first member
+	SelectMembers(teamId int64) ([]model.TeamMember, error)
+	IsMember(teamId, userId int64) (bool, error)
+	InsertMember(teamId, userId int64) error
+	DeleteMember(teamId, userId int64) error
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"nns_back/model"
+)
+
+type teamMysqlRepository struct {
+	db *sqlx.DB
+}
+
+func NewTeamMysqlRepository(db *sqlx.DB) TeamRepository {
+	return &teamMysqlRepository{
+		db: db,
+	}
+}
+
+func (r *teamMysqlRepository) SelectTeam(teamId int64) (model.Team, error) {
+	team := model.Team{}
+	err := r.db.QueryRowx(`
+SELECT t.id,
+       t.owner_id,
+       t.name,
+       t.create_time,
+       t.update_time
+FROM team t
+WHERE t.id = ?;`, teamId).StructScan(&team)
+	return team, err
+}
+
+func (r *teamMysqlRepository) SelectTeamsByUserId(userId int64) ([]model.Team, error) {
+	teams := make([]model.Team, 0)
+	err := r.db.Select(&teams, `
+SELECT t.id,
+       t.owner_id,
+       t.name,
+       t.create_time,
+       t.update_time
+FROM team t
+         JOIN team_member tm ON t.id = tm.team_id
+WHERE tm.user_id = ?
+ORDER BY t.id;`, userId)
+	return teams, err
+}
+
+func (r *teamMysqlRepository) Insert(team model.Team) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.NamedExec(`
+INSERT INTO team (owner_id,
+                  name,
+                  create_time,
+                  update_time)
+VALUES (:owner_id,
+        :name,
+        :create_time,
+        :update_time);`, team)
+	if err != nil {
+		return 0, err
+	}
+
+	team.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO team_member (team_id, user_id) VALUES (?, ?);`, team.Id, team.OwnerId); err != nil {
+		return 0, err
+	}
+
+	return team.Id, tx.Commit()
+}
+
+func (r *teamMysqlRepository) SelectMembers(teamId int64) ([]model.TeamMember, error) {
+	members := make([]model.TeamMember, 0)
+	err := r.db.Select(&members, `
+SELECT tm.team_id,
+       tm.user_id,
+       u.name "user_name",
+       tm.create_time
+FROM team_member tm
+         JOIN user u ON tm.user_id = u.id
+WHERE tm.team_id = ?
+ORDER BY tm.create_time;`, teamId)
+	return members, err
+}
+
+func (r *teamMysqlRepository) IsMember(teamId, userId int64) (bool, error) {
+	var member bool
+	err := r.db.QueryRowx(`
+SELECT EXISTS(SELECT 1 FROM team_member tm WHERE tm.team_id = ? AND tm.user_id = ?);`, teamId, userId).Scan(&member)
+	return member, err
+}
+
+func (r *teamMysqlRepository) InsertMember(teamId, userId int64) error {
+	_, err := r.db.Exec(`INSERT INTO team_member (team_id, user_id) VALUES (?, ?);`, teamId, userId)
+	return err
+}
+
+func (r *teamMysqlRepository) DeleteMember(teamId, userId int64) error {
+	result, err := r.db.Exec(`DELETE FROM team_member WHERE team_id = ? AND user_id = ?;`, teamId, userId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
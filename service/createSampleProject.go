@@ -1016,6 +1016,7 @@ func addSampleDatasetConfig(projectId int64, repo datasetConfig.Repository) (int
 			String: _sampleDatasetConfigNormalizationMethod,
 		},
 		Label:               _sampleDatasetConfigLabel,
+		Valid:               true,
 		Status:              util.StatusEXIST,
 		CreateTime:          time.Now(),
 		UpdateTime:          time.Now(),
@@ -8,10 +8,12 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"io"
 	"net/http"
 	"nns_back/log"
 	"nns_back/model"
+	"nns_back/quota"
 	"nns_back/repository"
 	"nns_back/util"
 	"os"
@@ -23,6 +25,7 @@ const _uploadImageFormFileKey = "image"
 
 type ImageHandler struct {
 	ImageRepository repository.ImageRepository
+	QuotaRepository quota.Repository
 }
 
 func (h *ImageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
@@ -50,17 +53,6 @@ func (h *ImageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		"file size", header.Size,
 		"MIME header", header.Header)
 
-	url, err := uploadImage(file, header.Header.Get("Content-Type"))
-	if err != nil {
-		log.Errorw("failed to upload image to s3",
-			"error code", util.ErrInternalServerError,
-			"error", err)
-		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
-		return
-	}
-
-	log.Debugw(url)
-
 	userId, ok := r.Context().Value("userId").(int64)
 	if !ok {
 		log.Errorw("failed to conversion interface to int64",
@@ -70,9 +62,29 @@ func (h *ImageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	img := model.NewImage(userId, url)
-	if img.Id, err = h.ImageRepository.Insert(img); err != nil {
-		log.Errorw("failed to insert image",
+	var img model.Image
+	err = quota.Reserve(h.QuotaRepository, userId, header.Size, 0, func() error {
+		url, err := uploadImage(file, header.Header.Get("Content-Type"))
+		if err != nil {
+			return errors.Wrap(err, "failed to upload image to s3")
+		}
+
+		log.Debugw(url)
+
+		img = model.NewImage(userId, url, header.Size)
+		img.Id, err = h.ImageRepository.Insert(img)
+		return errors.Wrap(err, "failed to insert image")
+	})
+	if err != nil {
+		if err == quota.ErrQuotaExceeded {
+			log.Warnw("storage quota exceeded",
+				"error code", util.ErrStorageQuotaExceeded,
+				"userId", userId,
+				"file size", header.Size)
+			util.WriteError(w, http.StatusForbidden, util.ErrStorageQuotaExceeded)
+			return
+		}
+		log.Errorw("failed to save image",
 			"error code", util.ErrInternalServerError,
 			"error", err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
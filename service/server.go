@@ -14,11 +14,14 @@ import (
 	"nns_back/dataset"
 	"nns_back/datasetConfig"
 	"nns_back/externalAPI"
+	"nns_back/lineage"
 	"nns_back/log"
+	"nns_back/quota"
 	"nns_back/repository"
 	"nns_back/train"
 	"nns_back/ws"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -36,8 +39,10 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 	projectRepo := repository.NewProjectMysqlRepository(db)
 	userRepo := repository.NewUserMysqlRepository(db)
 	imageRepo := repository.NewImageMysqlRepository(db)
+	teamRepo := repository.NewTeamMysqlRepository(db)
 	datasetConfigRepo := datasetConfig.NewRepository(db)
 	datasetRepo := dataset.NewMysqlRepository(db)
+	quotaRepo := quota.NewMysqlRepository(db, defaultStorageQuota())
 
 	// default router
 	router := mux.NewRouter()
@@ -59,17 +64,31 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 	// image
 	imageHandler := ImageHandler{
 		ImageRepository: imageRepo,
+		QuotaRepository: quotaRepo,
 	}
 	authRouter.HandleFunc("/api/image", imageHandler.UploadImage).Methods(_Post...)
 
 	// user
-	userHandler := NewUserHandler(userRepo, imageRepo, projectRepo, datasetRepo, datasetConfigRepo, sessionService)
+	userHandler := NewUserHandler(userRepo, imageRepo, projectRepo, datasetRepo, datasetConfigRepo, quotaRepo, sessionService)
 	router.HandleFunc("/api/user", userHandler.SignUpHandler).Methods(_Post...)
 	authRouter.HandleFunc("/api/user", userHandler.GetUserHandler).Methods(_Get...)
 	authRouter.HandleFunc("/api/user", userHandler.UpdateUserHandler).Methods(_Put...)
+	authRouter.HandleFunc("/api/user/storage", userHandler.GetUserStorageHandler).Methods(_Get...)
 	authRouter.HandleFunc("/api/user/password", userHandler.UpdateUserPasswordHandler).Methods(_Put...)
 	authRouter.HandleFunc("/api/user", userHandler.DeleteUserHandler).Methods(_Delete...)
 
+	// team
+	teamHandler := TeamHandler{
+		TeamRepository:    teamRepo,
+		UserRepository:    userRepo,
+		DatasetRepository: datasetRepo,
+	}
+	authRouter.HandleFunc("/api/teams", teamHandler.GetTeamListHandler).Methods(_Get...)
+	authRouter.HandleFunc("/api/team", teamHandler.CreateTeamHandler).Methods(_Post...)
+	authRouter.HandleFunc("/api/team/{teamId:[0-9]+}/members", teamHandler.GetTeamMemberListHandler).Methods(_Get...)
+	authRouter.HandleFunc("/api/team/{teamId:[0-9]+}/member", teamHandler.AddTeamMemberHandler).Methods(_Post...)
+	authRouter.HandleFunc("/api/team/{teamId:[0-9]+}/member/{userId:[0-9]+}", teamHandler.DeleteTeamMemberHandler).Methods(_Delete...)
+
 	// project
 	projectHandler := ProjectHandler{
 		ProjectRepository: projectRepo,
@@ -92,12 +111,13 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/share", projectHandler.GenerateShareKeyHandler).Methods(_Get...)
 
 	// dataset config
-	datasetConfigHandler := datasetConfig.NewHandler(projectRepo, datasetConfigRepo)
+	datasetConfigHandler := datasetConfig.NewHandler(projectRepo, datasetConfigRepo, datasetRepo, httpClient)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/dataset-config", datasetConfigHandler.GetDatasetConfigList).Methods(_Get...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/dataset-config/{datasetConfigId:[0-9]+}", datasetConfigHandler.GetDatasetConfig).Methods(_Get...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/dataset-config", datasetConfigHandler.CreateDatasetConfig).Methods(_Post...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/dataset-config/{datasetConfigId:[0-9]+}", datasetConfigHandler.UpdateDatasetConfig).Methods(_Put...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/dataset-config/{datasetConfigId:[0-9]+}", datasetConfigHandler.DeleteDatasetConfig).Methods(_Delete...)
+	authRouter.HandleFunc("/api/dataset-config/preview", datasetConfigHandler.PreviewPipeline).Methods(_Post...)
 
 	// web socket
 	hub := ws.NewHub(db, projectRepo, userRepo)
@@ -113,41 +133,58 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 	)
 
 	// Train monitor.
-	router.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/epoch", bridge.NewEpochHandler).Methods(_Post...)
-	router.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/log", bridge.TrainLogHandler).Methods(_Post...)
-	router.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/reply", bridge.TrainReplyHandler).Methods(_Post...)
+	// callbacks from the trainer are signed with the secret of each train
+	callbackRouter := router.PathPrefix("").Subrouter()
+	callbackRouter.Use(train.NewCallbackAuthenticator(&train.TrainDbRepository{DB: db}, train.CallbackMaxBodySize).Middleware)
+	// trained models are larger than the other callbacks
+	modelCallbackRouter := router.PathPrefix("").Subrouter()
+	modelCallbackRouter.Use(train.NewCallbackAuthenticator(&train.TrainDbRepository{DB: db}, train.CallbackMaxModelSize).Middleware)
+	callbackRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/epoch", bridge.NewEpochHandler).Methods(_Post...)
+	callbackRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/log", bridge.TrainLogHandler).Methods(_Post...)
+	callbackRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/reply", bridge.TrainReplyHandler).Methods(_Post...)
+	callbackRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/heartbeat", bridge.HeartbeatHandler).Methods(_Post...)
+
+	stepRecorder := train.NewStepRecorder(
+		&train.StepDbRepository{DB: db},
+		bridge,
+		train.DefaultStepForwardInterval,
+		stepRetention(),
+	)
+	go stepRecorder.Run()
+	callbackRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/step", stepRecorder.NewStepsHandler).Methods(_Post...)
 	authRouter.HandleFunc("/ws/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}", bridge.MonitorWsHandler)
+	// server-sent events of the same monitors for the clients which can't use websockets
+	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/events", bridge.MonitorEventsHandler).Methods(_Get...)
 
 	///////////////////////////////////////////////////////////////////////
 	///////////////////////////////////////////////////////////////////////
 	///////////////////////////////////////////////////////////////////////
 
-	awsAccessKeyId := os.Getenv("AWS_ACCESS_KEY_ID")
-	awsSecretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	awsSessionToken := os.Getenv("AWS_SESSION_TOKEN")
 	//imageBucketName := os.Getenv("IMAGE_BUCKET_NAME")
 	datasetBucketName := os.Getenv("DATASET_BUCKET_NAME")
 	trainedModelBucketName := os.Getenv("TRAINED_MODEL_BUCKET_NAME")
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(awsAccessKeyId, awsSecretAccessKey, awsSessionToken)),
-		config.WithRegion("ap-northeast-2"),
-	)
+	s3Client, err := newS3Client()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	s3Client := s3.NewFromConfig(cfg)
-
-	datasetHandler := dataset.NewDatasetHandler(userRepo, datasetRepo, &cloud.AwsS3Client{
-		Client:     s3Client,
-		BucketName: datasetBucketName,
+	datasetHandler := dataset.NewDatasetHandler(userRepo, teamRepo, datasetRepo, quotaRepo, &cloud.AwsS3Client{
+		Client:           s3Client,
+		BucketName:       datasetBucketName,
+		ContentAddressed: true,
 	}, httpClient)
 
 	authRouter.HandleFunc("/api/datasets", datasetHandler.GetList).Methods(_Get...)
 	authRouter.HandleFunc("/api/dataset/file", datasetHandler.UploadFile).Methods(_Post...)
 	authRouter.HandleFunc("/api/dataset", datasetHandler.UpdateFileConfig).Methods(_Put...)
 	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}", datasetHandler.DeleteDataset).Methods(_Delete...)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/preview", datasetHandler.GetDatasetPreview).Methods(_Get...)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/version", datasetHandler.UploadNewVersion).Methods(_Post...)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/versions", datasetHandler.GetVersionList).Methods(_Get...)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/acl", datasetHandler.GetACLList).Methods(_Get...)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/acl", datasetHandler.GrantACL).Methods(_Put...)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/acl/{aclId:[0-9]+}", datasetHandler.RevokeACL).Methods(_Delete...)
 
 	authRouter.HandleFunc("/api/dataset/library", datasetHandler.GetLibraryList).Methods(_Get...)
 	authRouter.HandleFunc("/api/dataset/library", datasetHandler.AddNewDatasetToLibrary).Methods(_Post...)
@@ -155,8 +192,41 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 	authRouter.HandleFunc("/api/dataset/library/{datasetId:[0-9]+}", datasetHandler.GetDatasetDetail).Methods(_Get...)
 
 	// Train handler
+	fitter := externalAPI.NewFitter(httpClient, fitterUrl())
+	trainScheduler := train.NewScheduler(
+		&train.TrainDbRepository{DB: db},
+		&train.TrainLogDbRepository{DB: db},
+		fitter,
+		&train.DatasetPreparer{
+			DatasetRepository: datasetRepo,
+			DatasetStorage: &cloud.AwsS3Client{
+				Client:     s3Client,
+				BucketName: datasetBucketName,
+				// splits of the same version and split option are the same
+				ContentAddressed: true,
+			},
+			QuotaRepository: quotaRepo,
+			HttpClient:      httpClient,
+		},
+		trainSlots("TRAIN_USER_SLOTS", train.DefaultUserSlots),
+		trainSlots("TRAIN_GLOBAL_SLOTS", train.DefaultGlobalSlots),
+	)
+	go trainScheduler.Run()
+
+	trainWatchdog := train.NewWatchdog(
+		&train.TrainDbRepository{DB: db},
+		&train.TrainLogDbRepository{DB: db},
+		bridge,
+		heartbeatTimeout(),
+	)
+	if err := trainWatchdog.Reconcile(); err != nil {
+		log.Errorw("failed to reconcile trains",
+			"error", err)
+	}
+	go trainWatchdog.Run()
+
 	trainHandler := train.Handler{
-		Fitter:            externalAPI.NewFitter(httpClient),
+		Fitter:            fitter,
 		ProjectRepository: projectRepo,
 		TrainRepository: &train.TrainDbRepository{
 			DB: db,
@@ -164,25 +234,40 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 		EpochRepository: &train.EpochDbRepository{
 			DB: db,
 		},
+		StepRepository: &train.StepDbRepository{
+			DB: db,
+		},
 		DatasetRepository:       datasetRepo,
 		DatasetConfigRepository: datasetConfigRepo,
 		TrainLogRepository: &train.TrainLogDbRepository{
 			DB: db,
 		},
+		QuotaRepository: quotaRepo,
 		AwsS3Uploader: &cloud.AwsS3Client{
 			Client:     s3Client,
 			BucketName: trainedModelBucketName,
 		},
+		Scheduler: trainScheduler,
+		Bridge:    bridge,
 	}
 
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train", trainHandler.NewTrainHandler).Methods(_Post...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train", trainHandler.GetTrainHistoryListHandler).Methods(_Get...)
+	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/compare", trainHandler.CompareTrainsHandler).Methods(_Get...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}", trainHandler.DeleteTrainHistoryHandler).Methods(_Delete...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}", trainHandler.UpdateTrainHistoryHandler).Methods(_Put...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/epoch", trainHandler.GetTrainHistoryEpochsHandler).Methods(_Get...)
+	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/step", trainHandler.GetTrainHistoryStepsHandler).Methods(_Get...)
 	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/log", trainHandler.GetTrainLogListHandler).Methods(_Get...)
+	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/cancel", trainHandler.CancelTrainHandler).Methods(_Post...)
+	authRouter.HandleFunc("/api/train/queue", trainHandler.GetTrainQueueHandler).Methods(_Get...)
+	authRouter.HandleFunc("/api/train/queue", trainHandler.ReorderTrainQueueHandler).Methods(_Put...)
 
-	router.HandleFunc("/api/train/{trainId:[0-9]+}/model", trainHandler.SaveTrainModelHandler).Methods(_Post...)
+	modelCallbackRouter.HandleFunc("/api/train/{trainId:[0-9]+}/model", trainHandler.SaveTrainModelHandler).Methods(_Post...)
+
+	lineageHandler := lineage.NewHandler(lineage.NewMysqlRepository(db), datasetRepo)
+	authRouter.HandleFunc("/api/dataset/{datasetId:[0-9]+}/lineage", lineageHandler.GetDatasetLineage).Methods(_Get...)
+	authRouter.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/lineage", lineageHandler.GetTrainLineage).Methods(_Get...)
 
 	///////////////////////////////////////////////////////////////////////
 	///////////////////////////////////////////////////////////////////////
@@ -210,6 +295,89 @@ func Start(port string, db *sqlx.DB, sessionStore sessions.Store) {
 	log.Fatal(srv.ListenAndServe())
 }
 
+// defaultStorageQuota is the storage quota of users without their own quota.
+// It is configured in bytes with USER_STORAGE_QUOTA.
+func defaultStorageQuota() int64 {
+	env := os.Getenv("USER_STORAGE_QUOTA")
+	if env == "" {
+		return quota.DefaultQuota
+	}
+
+	defaultQuota, err := strconv.ParseInt(env, 10, 64)
+	if err != nil || defaultQuota < 0 {
+		log.Fatalf("invalid USER_STORAGE_QUOTA: %s", env)
+	}
+	return defaultQuota
+}
+
+// fitterUrl is the base url of the trainer, configured with FITTER_URL.
+func fitterUrl() string {
+	if url := os.Getenv("FITTER_URL"); url != "" {
+		return url
+	}
+	return externalAPI.DefaultFitterUrl
+}
+
+// heartbeatTimeout is the time the trainer can train without heartbeat or epoch,
+// configured with TRAIN_HEARTBEAT_TIMEOUT such as "10m".
+func heartbeatTimeout() time.Duration {
+	env := os.Getenv("TRAIN_HEARTBEAT_TIMEOUT")
+	if env == "" {
+		return train.DefaultHeartbeatTimeout
+	}
+
+	timeout, err := time.ParseDuration(env)
+	if err != nil || timeout < time.Minute {
+		log.Fatalf("invalid TRAIN_HEARTBEAT_TIMEOUT: %s", env)
+	}
+	return timeout
+}
+
+// stepRetention is the time the steps of finished trains are kept,
+// configured with TRAIN_STEP_RETENTION such as "168h".
+func stepRetention() time.Duration {
+	env := os.Getenv("TRAIN_STEP_RETENTION")
+	if env == "" {
+		return train.DefaultStepRetention
+	}
+
+	retention, err := time.ParseDuration(env)
+	if err != nil || retention < time.Hour {
+		log.Fatalf("invalid TRAIN_STEP_RETENTION: %s", env)
+	}
+	return retention
+}
+
+// trainSlots is the number of trains running at once, configured with env.
+func trainSlots(env string, defaultSlots int) int {
+	value := os.Getenv(env)
+	if value == "" {
+		return defaultSlots
+	}
+
+	slots, err := strconv.Atoi(value)
+	if err != nil || slots <= 0 {
+		log.Fatalf("invalid %s: %s", env, value)
+	}
+	return slots
+}
+
+func newS3Client() (*s3.Client, error) {
+	awsAccessKeyId := os.Getenv("AWS_ACCESS_KEY_ID")
+	awsSecretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	awsSessionToken := os.Getenv("AWS_SESSION_TOKEN")
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(awsAccessKeyId, awsSecretAccessKey, awsSessionToken)),
+		config.WithRegion("ap-northeast-2"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg), nil
+}
+
 func generateHttpClient() *http.Client {
 	defaultTransportPointer, ok := http.DefaultTransport.(*http.Transport)
 	if !ok {
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/jmoiron/sqlx"
+	"nns_back/cloud"
+	"nns_back/gc"
+	"nns_back/log"
+	"os"
+	"time"
+)
+
+// StartStorageGC runs the storage garbage collector with command line args,
+// once or on a schedule.
+//
+//	gc [-delete] [-grace 24h] [-every 0]
+func StartStorageGC(db *sqlx.DB, args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	deleteMode := flags.Bool("delete", false, "delete orphan objects older than the grace period, only report them if not set")
+	gracePeriod := flags.Duration("grace", gc.DefaultGracePeriod, "orphan objects younger than this are never deleted")
+	every := flags.Duration("every", 0, "run on a schedule at this interval, run once if 0")
+	_ = flags.Parse(args)
+
+	s3Client, err := newS3Client()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	buckets := make([]gc.Bucket, 0)
+	for _, bucketName := range []string{
+		os.Getenv("DATASET_BUCKET_NAME"),
+		os.Getenv("TRAINED_MODEL_BUCKET_NAME"),
+		os.Getenv("IMAGE_BUCKET_NAME"),
+	} {
+		if bucketName == "" {
+			continue
+		}
+		buckets = append(buckets, &cloud.AwsS3Client{
+			Client:     s3Client,
+			BucketName: bucketName,
+		})
+	}
+
+	collector := &gc.Collector{
+		Repository:  gc.NewMysqlRepository(db),
+		Buckets:     buckets,
+		HttpClient:  generateHttpClient(),
+		GracePeriod: *gracePeriod,
+	}
+
+	if *every <= 0 {
+		if err := runStorageGC(collector, !*deleteMode); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		if err := runStorageGC(collector, !*deleteMode); err != nil {
+			log.Errorw("failed to collect storage garbage",
+				"error", err)
+		}
+		<-ticker.C
+	}
+}
+
+func runStorageGC(collector *gc.Collector, dryRun bool) error {
+	report, err := collector.Run(dryRun)
+	if err != nil {
+		return err
+	}
+
+	log.Infow("storage garbage collected",
+		"dryRun", report.DryRun,
+		"objects", report.Objects,
+		"orphans", len(report.Orphans),
+		"orphanSize", report.OrphanSize,
+		"deleted", report.Deleted,
+		"deletedSize", report.DeletedSize,
+		"failed", report.Failed,
+		"elapsed", report.EndTime.Sub(report.StartTime))
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
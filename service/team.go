@@ -0,0 +1,354 @@
+package service
+
+import (
+	"database/sql"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"net/http"
+	"nns_back/dataset"
+	"nns_back/log"
+	"nns_back/model"
+	"nns_back/repository"
+	"nns_back/util"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type TeamHandler struct {
+	TeamRepository    repository.TeamRepository
+	UserRepository    repository.UserRepository
+	DatasetRepository dataset.Repository
+}
+
+const _maxTeamName = 45
+
+type CreateTeamHandlerRequestBody struct {
+	Name string `json:"name"`
+}
+
+func (c CreateTeamHandlerRequestBody) Validate() error {
+	length := utf8.RuneCountInString(strings.TrimSpace(c.Name))
+	if length == 0 || length > _maxTeamName {
+		return errors.Errorf("team name must be 1 to %d characters", _maxTeamName)
+	}
+	return nil
+}
+
+func (h *TeamHandler) CreateTeamHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	reqBody := CreateTeamHandlerRequestBody{}
+	if err := util.BindJson(r.Body, &reqBody); err != nil {
+		log.Warnw("failed to bind request body to json",
+			"error code", util.ErrInvalidRequestBody,
+			"error", err)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	teamId, err := h.TeamRepository.Insert(model.NewTeam(userId, strings.TrimSpace(reqBody.Name)))
+	if err != nil {
+		log.Errorw("failed to insert team",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	util.WriteJson(w, http.StatusCreated, util.ResponseBody{"id": teamId})
+}
+
+type GetTeamListResponseBody struct {
+	Teams []GetTeamListResponseTeamBody `json:"teams"`
+}
+
+type GetTeamListResponseTeamBody struct {
+	Id         int64     `json:"id"`
+	Name       string    `json:"name"`
+	IsOwner    bool      `json:"isOwner"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// GetTeamListHandler lists teams the user is a member of.
+func (h *TeamHandler) GetTeamListHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	teams, err := h.TeamRepository.SelectTeamsByUserId(userId)
+	if err != nil {
+		log.Errorw("failed to select teams",
+			"error code", util.ErrInternalServerError,
+			"error", err,
+			"userId", userId)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	resp := GetTeamListResponseBody{Teams: make([]GetTeamListResponseTeamBody, 0, len(teams))}
+	for _, team := range teams {
+		resp.Teams = append(resp.Teams, GetTeamListResponseTeamBody{
+			Id:         team.Id,
+			Name:       team.Name,
+			IsOwner:    team.OwnerId == userId,
+			CreateTime: team.CreateTime,
+		})
+	}
+
+	util.WriteJson(w, http.StatusOK, resp)
+}
+
+type GetTeamMemberListResponseBody struct {
+	Members []GetTeamMemberListResponseMemberBody `json:"members"`
+}
+
+type GetTeamMemberListResponseMemberBody struct {
+	UserId     int64     `json:"userId"`
+	Name       string    `json:"name"`
+	JoinedTime time.Time `json:"joinedTime"`
+}
+
+func (h *TeamHandler) GetTeamMemberListHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	teamId, err := util.Atoi64(mux.Vars(r)["teamId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	// only members can see the members
+	member, err := h.TeamRepository.IsMember(teamId, userId)
+	if err != nil {
+		log.Errorw("failed to check team member",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !member {
+		util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+		return
+	}
+
+	members, err := h.TeamRepository.SelectMembers(teamId)
+	if err != nil {
+		log.Errorw("failed to select team members",
+			"error code", util.ErrInternalServerError,
+			"error", err,
+			"teamId", teamId)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	resp := GetTeamMemberListResponseBody{Members: make([]GetTeamMemberListResponseMemberBody, 0, len(members))}
+	for _, m := range members {
+		resp.Members = append(resp.Members, GetTeamMemberListResponseMemberBody{
+			UserId:     m.UserId,
+			Name:       m.UserName,
+			JoinedTime: m.CreateTime,
+		})
+	}
+
+	util.WriteJson(w, http.StatusOK, resp)
+}
+
+type AddTeamMemberHandlerRequestBody struct {
+	UserId int64 `json:"userId"`
+}
+
+func (a AddTeamMemberHandlerRequestBody) Validate() error {
+	if a.UserId <= 0 {
+		return errors.New("invalid userId")
+	}
+	return nil
+}
+
+// AddTeamMemberHandler adds a user to the team. Only the owner can add members.
+func (h *TeamHandler) AddTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	team, ok := h.findOwnTeam(w, r, userId)
+	if !ok {
+		return
+	}
+
+	reqBody := AddTeamMemberHandlerRequestBody{}
+	if err := util.BindJson(r.Body, &reqBody); err != nil {
+		log.Warnw("failed to bind request body to json",
+			"error code", util.ErrInvalidRequestBody,
+			"error", err)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	if _, err := h.UserRepository.SelectUser(repository.ClassifiedById(reqBody.UserId)); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+			return
+		}
+		log.Errorw("failed to select user",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	member, err := h.TeamRepository.IsMember(team.Id, reqBody.UserId)
+	if err != nil {
+		log.Errorw("failed to check team member",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if member {
+		util.WriteError(w, http.StatusUnprocessableEntity, util.ErrDuplicate)
+		return
+	}
+
+	if err := h.TeamRepository.InsertMember(team.Id, reqBody.UserId); err != nil {
+		log.Errorw("failed to insert team member",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	// datasets shared with the team become usable
+	h.refreshDatasetLibraryUsable(reqBody.UserId)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// DeleteTeamMemberHandler removes a member from the team.
+// The owner can remove other members, and members can leave the team.
+func (h *TeamHandler) DeleteTeamMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	teamId, err := util.Atoi64(mux.Vars(r)["teamId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+	memberId, err := util.Atoi64(mux.Vars(r)["userId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	team, err := h.TeamRepository.SelectTeam(teamId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorw("failed to select team",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if team.OwnerId != userId && memberId != userId {
+		util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+		return
+	}
+	if memberId == team.OwnerId {
+		// the owner can't leave the team
+		util.WriteError(w, http.StatusBadRequest, util.ErrBadRequest)
+		return
+	}
+
+	if err := h.TeamRepository.DeleteMember(team.Id, memberId); err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorw("failed to delete team member",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	// access to datasets shared with the team is revoked
+	h.refreshDatasetLibraryUsable(memberId)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// findOwnTeam finds the team in the path owned by the user.
+// It writes an error response and returns false if not found.
+func (h *TeamHandler) findOwnTeam(w http.ResponseWriter, r *http.Request, userId int64) (model.Team, bool) {
+	teamId, err := util.Atoi64(mux.Vars(r)["teamId"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return model.Team{}, false
+	}
+
+	team, err := h.TeamRepository.SelectTeam(teamId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return model.Team{}, false
+		}
+		log.Errorw("failed to select team",
+			"error code", util.ErrInternalServerError,
+			"error", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return model.Team{}, false
+	}
+
+	if team.OwnerId != userId {
+		log.Warnw("inaccessible team",
+			"teamId", teamId,
+			"userId", userId)
+		util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+		return model.Team{}, false
+	}
+
+	return team, true
+}
+
+func (h *TeamHandler) refreshDatasetLibraryUsable(userId int64) {
+	if err := h.DatasetRepository.RefreshDatasetLibraryUsable(userId); err != nil {
+		log.Errorw("failed to refresh dataset library usable",
+			"error", err,
+			"userId", userId)
+	}
+}
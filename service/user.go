@@ -10,6 +10,7 @@ import (
 	"nns_back/datasetConfig"
 	"nns_back/log"
 	"nns_back/model"
+	"nns_back/quota"
 	"nns_back/repository"
 	"nns_back/util"
 	"regexp"
@@ -24,6 +25,7 @@ type userHandler struct {
 	ProjectRepository       repository.ProjectRepository
 	DatasetRepository       dataset.Repository
 	DatasetConfigRepository datasetConfig.Repository
+	QuotaRepository         quota.Repository
 	SessionService          SessionService
 }
 
@@ -33,6 +35,7 @@ func NewUserHandler(
 	projectRepository repository.ProjectRepository,
 	datasetRepository dataset.Repository,
 	datasetConfigRepository datasetConfig.Repository,
+	quotaRepository quota.Repository,
 	sessionService SessionService) *userHandler {
 	return &userHandler{
 		UserRepository:          userRepository,
@@ -40,6 +43,7 @@ func NewUserHandler(
 		ProjectRepository:       projectRepository,
 		DatasetRepository:       datasetRepository,
 		DatasetConfigRepository: datasetConfigRepository,
+		QuotaRepository:         quotaRepository,
 		SessionService:          sessionService,
 	}
 }
@@ -237,6 +241,53 @@ func (h *userHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	util.WriteJson(w, http.StatusOK, resp)
 }
 
+// GetUserStorageHandlerResponseBody is the storage usage of the user in bytes.
+type GetUserStorageHandlerResponseBody struct {
+	Quota     int64 `json:"quota"`
+	Used      int64 `json:"used"`
+	Available int64 `json:"available"`
+	Usage     struct {
+		Datasets int64 `json:"datasets"`
+		Derived  int64 `json:"derived"`
+		Images   int64 `json:"images"`
+		Models   int64 `json:"models"`
+		Reserved int64 `json:"reserved"` // being stored
+	} `json:"usage"`
+}
+
+func (h *userHandler) GetUserStorageHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	usage, err := h.QuotaRepository.FindUsage(userId)
+	if err != nil {
+		log.Errorw("failed to find storage usage",
+			"error code", util.ErrInternalServerError,
+			"error", err,
+			"userId", userId)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	resp := GetUserStorageHandlerResponseBody{
+		Quota:     usage.Quota,
+		Used:      usage.Total(),
+		Available: usage.Available(),
+	}
+	resp.Usage.Datasets = usage.Datasets
+	resp.Usage.Derived = usage.Derived
+	resp.Usage.Images = usage.Images
+	resp.Usage.Models = usage.Models
+	resp.Usage.Reserved = usage.Reserved
+	util.WriteJson(w, http.StatusOK, resp)
+}
+
 type UpdateUserHandlerRequestBody struct {
 	ProfileImage int64  `json:"profileImage"`
 	Name         string `json:"name"`
@@ -4,6 +4,7 @@ create table image
         primary key,
     user_id bigint not null,
     url varchar(1024) not null,
+    size bigint default 0 not null,
     create_time datetime default current_timestamp() not null,
     update_time datetime default current_timestamp() not null on update current_timestamp()
 );
@@ -50,6 +51,7 @@ create table user
     login_id varchar(50) null,
     login_pw binary(60) null,
     status varchar(10) default 'EXIST' not null,
+    storage_quota bigint null comment 'bytes, default quota if null',
     create_time datetime default current_timestamp() not null,
     update_time datetime default current_timestamp() not null on update current_timestamp()
 );
@@ -57,3 +59,41 @@ create table user
 create index user_login_id_index
     on user (login_id);
 
+
+create table team
+(
+    id bigint auto_increment
+        primary key,
+    owner_id bigint not null,
+    name varchar(45) not null,
+    create_time datetime default current_timestamp() not null,
+    update_time datetime default current_timestamp() not null on update current_timestamp()
+);
+
+create table team_member
+(
+    id bigint auto_increment
+        primary key,
+    team_id bigint not null,
+    user_id bigint not null,
+    create_time datetime default current_timestamp() not null,
+    constraint team_member_uk_team_id_user_id
+        unique (team_id, user_id)
+);
+
+create index team_member__index_user_id
+    on team_member (user_id);
+
+-- bytes reserved for the stores in progress, counted in the storage usage of the user until released.
+-- reservations left by interrupted stores are not counted an hour after created.
+create table storage_reservation
+(
+    id bigint auto_increment
+        primary key,
+    user_id bigint not null,
+    size bigint not null,
+    create_time datetime default current_timestamp() not null
+);
+
+create index storage_reservation__index_user_id
+    on storage_reservation (user_id);
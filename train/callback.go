@@ -0,0 +1,165 @@
+package train
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"nns_back/log"
+	"nns_back/util"
+	"strconv"
+	"time"
+)
+
+const (
+	CallbackTimestampHeader = "X-Train-Timestamp" // unix time in seconds
+	CallbackSignatureHeader = "X-Train-Signature" // hex of SignCallback
+
+	// callbacks signed longer ago than this are rejected, so that they can not be replayed later
+	callbackMaxClockSkew = 5 * time.Minute
+
+	callbackSecretSize = 32
+
+	// bodies of the callbacks are read into memory to verify their signatures
+	CallbackMaxBodySize  = 10 << 20
+	CallbackMaxModelSize = 512 << 20 // trained model uploads
+)
+
+// CallbackCredential is used to authenticate the callbacks of a train from the trainer.
+type CallbackCredential struct {
+	UserId    int64  `db:"user_id"`
+	ProjectNo int    `db:"project_no"`
+	Secret    string `db:"callback_secret"` // empty for trains queued before callbacks were signed
+}
+
+// newCallbackSecret generates the secret the trainer signs the callbacks of a train with.
+func newCallbackSecret() (string, error) {
+	secret := make([]byte, callbackSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SignCallback returns the hex encoded HMAC-SHA256 of the callback request with the secret of the train.
+// The signed message is the timestamp, method, path and body separated by new lines.
+func SignCallback(secret string, timestamp string, method string, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CallbackAuthenticator authenticates the callbacks from the trainer,
+// such as epochs, logs, replies and trained models.
+type CallbackAuthenticator struct {
+	trainRepository TrainRepository
+	maxBodySize     int64
+	now             func() time.Time
+}
+
+func NewCallbackAuthenticator(trainRepository TrainRepository, maxBodySize int64) *CallbackAuthenticator {
+	return &CallbackAuthenticator{
+		trainRepository: trainRepository,
+		maxBodySize:     maxBodySize,
+		now:             time.Now,
+	}
+}
+
+// pathTrainId returns the train id in the path of the callback.
+// The reply callback names it trainNo, which the trainers already request.
+func pathTrainId(r *http.Request) string {
+	vars := mux.Vars(r)
+	if trainId, ok := vars["trainId"]; ok {
+		return trainId
+	}
+	return vars["trainNo"]
+}
+
+// Middleware accepts the callback of the train in the path only if it is signed with the secret of the train
+// within callbackMaxClockSkew, and the project in the path is the project of the train.
+// Bodies larger than the max body size are rejected before they are verified.
+func (a *CallbackAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		trainId, err := util.Atoi64(pathTrainId(r))
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+			return
+		}
+
+		credential, err := a.trainRepository.FindCallbackCredential(trainId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+				return
+			}
+			log.Errorf("failed to FindCallbackCredential(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+
+		if projectNo, ok := vars["projectNo"]; ok && projectNo != strconv.Itoa(credential.ProjectNo) {
+			log.Warnw("callback of the train of other project",
+				"trainId", trainId,
+				"projectNo", projectNo)
+			util.WriteError(w, http.StatusForbidden, util.ErrForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, a.maxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				log.Warnw("callback body too large",
+					"trainId", trainId,
+					"path", r.URL.Path)
+				util.WriteError(w, http.StatusRequestEntityTooLarge, util.ErrFileTooLarge)
+				return
+			}
+			util.WriteError(w, http.StatusBadRequest, util.ErrBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !a.verify(credential.Secret, r, body) {
+			log.Warnw("invalid callback signature",
+				"trainId", trainId,
+				"path", r.URL.Path)
+			util.WriteError(w, http.StatusUnauthorized, util.ErrInvalidAuthentication)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *CallbackAuthenticator) verify(secret string, r *http.Request, body []byte) bool {
+	if secret == "" {
+		return false
+	}
+
+	timestamp := r.Header.Get(CallbackTimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := a.now().Sub(time.Unix(unix, 0))
+	if skew > callbackMaxClockSkew || skew < -callbackMaxClockSkew {
+		return false
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(CallbackSignatureHeader))
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(SignCallback(secret, timestamp, r.Method, r.URL.Path, body))
+
+	return hmac.Equal(signature, expected)
+}
@@ -0,0 +1,164 @@
+package train
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nns_back/log"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// callbackTrainRepository is a TrainRepository of a single train, which only supports callback authentication.
+type callbackTrainRepository struct {
+	TrainRepository
+	trainId    int64
+	credential CallbackCredential
+}
+
+func (r *callbackTrainRepository) FindCallbackCredential(trainId int64) (CallbackCredential, error) {
+	if trainId != r.trainId {
+		return CallbackCredential{}, sql.ErrNoRows
+	}
+	return r.credential, nil
+}
+
+func TestCallbackAuthenticator_Middleware(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	const secret = "secret"
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"epoch":1}`)
+
+	sign := func(secret string, timestamp time.Time, path string, body []byte) http.Header {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		header := http.Header{}
+		header.Set(CallbackTimestampHeader, ts)
+		header.Set(CallbackSignatureHeader, SignCallback(secret, ts, http.MethodPost, path, body))
+		return header
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		header   http.Header
+		body     []byte
+		expected int
+	}{
+		{
+			name:     "valid",
+			path:     "/api/project/2/train/3/epoch",
+			header:   sign(secret, now, "/api/project/2/train/3/epoch", body),
+			body:     body,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "valid without project",
+			path:     "/api/train/3/model",
+			header:   sign(secret, now.Add(-time.Minute), "/api/train/3/model", body),
+			body:     body,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "valid reply",
+			path:     "/api/project/2/train/3/reply",
+			header:   sign(secret, now, "/api/project/2/train/3/reply", body),
+			body:     body,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "too large",
+			path:     "/api/project/2/train/3/epoch",
+			header:   sign(secret, now, "/api/project/2/train/3/epoch", bytes.Repeat(body, 10)),
+			body:     bytes.Repeat(body, 10),
+			expected: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "no signature",
+			path:     "/api/project/2/train/3/epoch",
+			header:   http.Header{},
+			body:     body,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong secret",
+			path:     "/api/project/2/train/3/epoch",
+			header:   sign("other", now, "/api/project/2/train/3/epoch", body),
+			body:     body,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "tampered body",
+			path:     "/api/project/2/train/3/epoch",
+			header:   sign(secret, now, "/api/project/2/train/3/epoch", body),
+			body:     []byte(`{"epoch":2}`),
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "signed for other path",
+			path:     "/api/project/2/train/3/reply",
+			header:   sign(secret, now, "/api/project/2/train/3/epoch", body),
+			body:     body,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "expired",
+			path:     "/api/project/2/train/3/epoch",
+			header:   sign(secret, now.Add(-10*time.Minute), "/api/project/2/train/3/epoch", body),
+			body:     body,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "other project",
+			path:     "/api/project/1/train/3/epoch",
+			header:   sign(secret, now, "/api/project/1/train/3/epoch", body),
+			body:     body,
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "unknown train",
+			path:     "/api/project/2/train/4/epoch",
+			header:   sign(secret, now, "/api/project/2/train/4/epoch", body),
+			body:     body,
+			expected: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := NewCallbackAuthenticator(&callbackTrainRepository{
+				trainId:    3,
+				credential: CallbackCredential{UserId: 1, ProjectNo: 2, Secret: secret},
+			}, 64)
+			authenticator.now = func() time.Time { return now }
+
+			var received []byte
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+			})
+
+			router := mux.NewRouter()
+			router.Use(authenticator.Middleware)
+			router.Handle("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/reply", next)
+			router.Handle("/api/project/{projectNo:[0-9]+}/train/{trainId:[0-9]+}/{callback}", next)
+			router.Handle("/api/train/{trainId:[0-9]+}/model", next)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expected, rec.Code)
+			if tt.expected == http.StatusOK {
+				// the body is still readable by the callback handler
+				assert.Equal(t, tt.body, received)
+			}
+		})
+	}
+}
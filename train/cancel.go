@@ -0,0 +1,130 @@
+package train
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"net/http"
+	"nns_back/externalAPI"
+	"nns_back/log"
+	"nns_back/util"
+	"strconv"
+	"time"
+)
+
+const trainCancelledMessage = "Train cancelled by user"
+
+// isCancellable reports whether the train is queued or running.
+func isCancellable(status string) bool {
+	switch status {
+	case TrainStatusQueued, TrainStatusCreated, TrainStatusTrain:
+		return true
+	}
+	return false
+}
+
+// CancelTrainHandler stops the queued or running train.
+// Running trains are cancelled in the trainer first, and then marked as cancelled.
+func (h *Handler) CancelTrainHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectNo, err := strconv.Atoi(vars["projectNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+	trainNo, err := strconv.Atoi(vars["trainNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	train, err := h.TrainRepository.Find(WithTrainUserId(userId), WithProjectProjectNo(projectNo), WithTrainTrainNo(trainNo))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorf("failed to Find(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if !isCancellable(train.Status) {
+		log.Warnw("train is not cancellable",
+			"trainId", train.Id,
+			"status", train.Status)
+		util.WriteError(w, http.StatusConflict, util.ErrTrainNotCancellable, util.KeyValue("status", train.Status))
+		return
+	}
+
+	// queued trains are not requested to the trainer yet
+	if train.Status != TrainStatusQueued {
+		if err := cancelRequest(h.Fitter, train); err != nil {
+			log.Errorw("failed to cancel train in the trainer",
+				"error", err,
+				"trainId", train.Id)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+	}
+
+	cancelled, err := h.TrainRepository.Cancel(train.Id)
+	if err != nil {
+		log.Errorf("failed to Cancel(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !cancelled {
+		log.Warnw("train finished before cancelled",
+			"trainId", train.Id)
+		util.WriteError(w, http.StatusConflict, util.ErrTrainNotCancellable)
+		return
+	}
+
+	trainLog := TrainLog{
+		TrainId:    train.Id,
+		Message:    trainCancelledMessage,
+		StatusCode: http.StatusOK,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}
+	if trainLog.Id, err = h.TrainLogRepository.Insert(trainLog); err != nil {
+		log.Errorw("failed to insert train log",
+			"error", err,
+			"trainId", train.Id)
+	}
+
+	if h.Bridge != nil {
+		h.Bridge.Cancel(train.Id, trainLog)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cancelRequest requests the trainer to stop the train.
+// The train unknown to the trainer is regarded as stopped.
+func cancelRequest(fitter externalAPI.Fitter, train Train) error {
+	resp, err := fitter.Cancel(externalAPI.CancelRequestBody{
+		TrainId: train.Id,
+		UserId:  train.UserId,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Cancel(trainId: %d)", train.Id)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return errors.New(fmt.Sprintf("failed to Cancel: response status code : %d", resp.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package train
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/elixter/Querybuilder"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"nns_back/externalAPI"
+	"nns_back/log"
+	"testing"
+)
+
+// cancelTrainRepository is a TrainRepository of a single train, which only supports cancelling.
+type cancelTrainRepository struct {
+	TrainRepository
+	train Train
+}
+
+func (r *cancelTrainRepository) Find(opts ...query.Option) (Train, error) {
+	if r.train.Id == 0 {
+		return Train{}, sql.ErrNoRows
+	}
+	return r.train, nil
+}
+
+func (r *cancelTrainRepository) Cancel(trainId int64) (bool, error) {
+	if trainId != r.train.Id || !isCancellable(r.train.Status) {
+		return false, nil
+	}
+	r.train.Status = TrainStatusCancelled
+	return true, nil
+}
+
+type cancelTrainLogRepository struct {
+	TrainLogRepository
+	logs []TrainLog
+}
+
+func (r *cancelTrainLogRepository) Insert(log TrainLog) (int, error) {
+	r.logs = append(r.logs, log)
+	return len(r.logs), nil
+}
+
+func TestHandler_CancelTrainHandler(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	tests := []struct {
+		name           string
+		train          Train
+		fitterStatus   int
+		expectedCode   int
+		expectedStatus string
+		propagated     bool
+	}{
+		{
+			name:           "running",
+			train:          Train{Id: 3, UserId: 1, Status: TrainStatusTrain},
+			fitterStatus:   http.StatusOK,
+			expectedCode:   http.StatusNoContent,
+			expectedStatus: TrainStatusCancelled,
+			propagated:     true,
+		},
+		{
+			name:           "unknown to the trainer",
+			train:          Train{Id: 3, UserId: 1, Status: TrainStatusTrain},
+			fitterStatus:   http.StatusNotFound,
+			expectedCode:   http.StatusNoContent,
+			expectedStatus: TrainStatusCancelled,
+			propagated:     true,
+		},
+		{
+			name:           "trainer failure",
+			train:          Train{Id: 3, UserId: 1, Status: TrainStatusTrain},
+			fitterStatus:   http.StatusInternalServerError,
+			expectedCode:   http.StatusInternalServerError,
+			expectedStatus: TrainStatusTrain,
+			propagated:     true,
+		},
+		{
+			name:           "queued",
+			train:          Train{Id: 3, UserId: 1, Status: TrainStatusQueued},
+			expectedCode:   http.StatusNoContent,
+			expectedStatus: TrainStatusCancelled,
+		},
+		{
+			name:           "finished",
+			train:          Train{Id: 3, UserId: 1, Status: TrainStatusFinish},
+			expectedCode:   http.StatusConflict,
+			expectedStatus: TrainStatusFinish,
+		},
+		{
+			name:         "not found",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cancelRequests []externalAPI.CancelRequestBody
+			fitterServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/cancel", r.URL.Path)
+
+				var body externalAPI.CancelRequestBody
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				cancelRequests = append(cancelRequests, body)
+
+				w.WriteHeader(tt.fitterStatus)
+			}))
+			defer fitterServer.Close()
+
+			trainRepository := &cancelTrainRepository{train: tt.train}
+			trainLogRepository := &cancelTrainLogRepository{}
+			h := Handler{
+				Fitter:             externalAPI.NewFitter(fitterServer.Client(), fitterServer.URL),
+				TrainRepository:    trainRepository,
+				TrainLogRepository: trainLogRepository,
+				Bridge:             NewBridge(nil, trainRepository, trainLogRepository),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/project/1/train/2/cancel", nil)
+			req = req.WithContext(context.WithValue(req.Context(), "userId", int64(1)))
+			req = mux.SetURLVars(req, map[string]string{"projectNo": "1", "trainNo": "2"})
+			rec := httptest.NewRecorder()
+
+			h.CancelTrainHandler(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			assert.Equal(t, tt.expectedStatus, trainRepository.train.Status)
+			if tt.propagated {
+				assert.Equal(t, []externalAPI.CancelRequestBody{{TrainId: 3, UserId: 1}}, cancelRequests)
+			} else {
+				assert.Empty(t, cancelRequests)
+			}
+			if tt.expectedCode == http.StatusNoContent {
+				if assert.Len(t, trainLogRepository.logs, 1) {
+					assert.Equal(t, trainCancelledMessage, trainLogRepository.logs[0].Message)
+				}
+			}
+		})
+	}
+}
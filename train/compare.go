@@ -0,0 +1,368 @@
+package train
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/elixter/Querybuilder"
+	"github.com/gorilla/mux"
+	"net/http"
+	"nns_back/log"
+	"nns_back/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	_minComparedTrains = 2
+	_maxComparedTrains = 10
+)
+
+// contentIgnoredKeys are the keys of the model content only for the editor, such as the positions of the nodes,
+// which are not compared.
+var contentIgnoredKeys = []string{"flowState"}
+
+type CompareTrainsResponseBody struct {
+	Trains           []CompareTrainDto `json:"trains"`
+	Epochs           []CompareEpochDto `json:"epochs"`
+	ModelConfigDiff  []JsonDiff        `json:"modelConfigDiff"`
+	ModelContentDiff []JsonDiff        `json:"modelContentDiff"`
+}
+
+type CompareTrainDto struct {
+	TrainNo       int64                    `json:"trainNo"`
+	Name          string                   `json:"name"`
+	Status        string                   `json:"status"`
+	Epochs        int                      `json:"epochs"`
+	MonitorMetric string                   `json:"monitorMetric"`
+	BestEpoch     sql.NullInt64            `json:"bestEpoch"`
+	BestValue     sql.NullFloat64          `json:"bestValue"`
+	Best          map[string]BestMetricDto `json:"best"` // best epoch of every metric by name
+}
+
+type BestMetricDto struct {
+	EpochNo int     `json:"epochNo"`
+	Value   float64 `json:"value"`
+}
+
+// CompareEpochDto is an epoch number with the epoch of every train by train no,
+// which is null if the train doesn't have the epoch.
+type CompareEpochDto struct {
+	EpochNo int                                              `json:"epochNo"`
+	Trains  map[int64]*trainHistoryEpochListResponseBodyBody `json:"trains"`
+}
+
+// JsonDiff is a value differing between the trains by train no, which is null if the train doesn't have it.
+type JsonDiff struct {
+	Path   string                    `json:"path"`
+	Values map[int64]json.RawMessage `json:"values"`
+}
+
+// CompareTrainsHandler compares the trains of the trainNos query, such as "trainNos=1,2,3",
+// by their epochs, model config and model content.
+func (h *Handler) CompareTrainsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	projectNo, err := strconv.Atoi(mux.Vars(r)["projectNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	trainNos, err := parseTrainNos(r.URL.Query().Get("trainNos"))
+	if err != nil {
+		log.Warnw("invalid trainNos",
+			"error", err,
+			"trainNos", r.URL.Query().Get("trainNos"))
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidQueryParm)
+		return
+	}
+
+	var trains []Train
+	epochsByTrainNo := make(map[int64][]Epoch)
+	for _, trainNo := range trainNos {
+		opts := []query.Option{WithTrainUserId(userId), WithProjectProjectNo(projectNo), WithTrainTrainNo(trainNo)}
+
+		train, err := h.TrainRepository.Find(opts...)
+		if err != nil && err != sql.ErrNoRows {
+			log.Errorf("failed to Find(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+		if err == sql.ErrNoRows || train.Status == TrainStatusDelete {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound, util.KeyValue("trainNo", trainNo))
+			return
+		}
+
+		epochs, err := h.EpochRepository.FindAll(opts...)
+		if err != nil {
+			log.Errorf("failed to FindAll(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+		metrics, err := h.EpochRepository.FindAllMetrics(opts...)
+		if err != nil {
+			log.Errorf("failed to FindAllMetrics(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
+
+		trains = append(trains, train)
+		epochsByTrainNo[train.TrainNo] = attachMetrics(epochs, metrics)
+	}
+
+	resp, err := newCompareTrainsResponseBody(trains, epochsByTrainNo)
+	if err != nil {
+		log.Errorf("failed to newCompareTrainsResponseBody(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, resp)
+}
+
+// parseTrainNos parses the comma separated distinct train numbers.
+func parseTrainNos(value string) ([]int, error) {
+	var trainNos []int
+	seen := make(map[int]bool)
+	for _, s := range strings.Split(value, ",") {
+		trainNo, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		if seen[trainNo] {
+			return nil, fmt.Errorf("duplicate trainNo: %d", trainNo)
+		}
+		seen[trainNo] = true
+		trainNos = append(trainNos, trainNo)
+	}
+
+	if len(trainNos) < _minComparedTrains || len(trainNos) > _maxComparedTrains {
+		return nil, fmt.Errorf("trainNos must be %d to %d trains", _minComparedTrains, _maxComparedTrains)
+	}
+
+	return trainNos, nil
+}
+
+func newCompareTrainsResponseBody(trains []Train, epochsByTrainNo map[int64][]Epoch) (CompareTrainsResponseBody, error) {
+	resp := CompareTrainsResponseBody{
+		Trains: make([]CompareTrainDto, 0, len(trains)),
+		Epochs: alignEpochs(epochsByTrainNo),
+	}
+
+	configs := make(map[int64]json.RawMessage)
+	contents := make(map[int64]json.RawMessage)
+	for _, train := range trains {
+		resp.Trains = append(resp.Trains, CompareTrainDto{
+			TrainNo:       train.TrainNo,
+			Name:          train.Name,
+			Status:        train.Status,
+			Epochs:        train.Epochs,
+			MonitorMetric: train.MonitorMetric,
+			BestEpoch:     train.BestEpoch,
+			BestValue:     train.BestValue,
+			Best:          bestMetrics(epochsByTrainNo[train.TrainNo]),
+		})
+		configs[train.TrainNo] = train.TrainConfig.ModelConfig
+		contents[train.TrainNo] = train.TrainConfig.ModelContent
+	}
+
+	var err error
+	resp.ModelConfigDiff, err = diffJson(configs)
+	if err != nil {
+		return resp, err
+	}
+	resp.ModelContentDiff, err = diffJson(contents, contentIgnoredKeys...)
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+// alignEpochs aligns the epochs of the trains by the epoch number.
+func alignEpochs(epochsByTrainNo map[int64][]Epoch) []CompareEpochDto {
+	aligned := make(map[int]map[int64]*trainHistoryEpochListResponseBodyBody)
+	for trainNo, epochs := range epochsByTrainNo {
+		for _, epoch := range epochs {
+			if aligned[epoch.Epoch] == nil {
+				aligned[epoch.Epoch] = make(map[int64]*trainHistoryEpochListResponseBodyBody)
+			}
+			dto := newTrainHistoryEpochDto(epoch)
+			aligned[epoch.Epoch][trainNo] = &dto
+		}
+	}
+
+	resp := make([]CompareEpochDto, 0, len(aligned))
+	for epochNo, byTrainNo := range aligned {
+		for trainNo := range epochsByTrainNo {
+			if _, ok := byTrainNo[trainNo]; !ok {
+				byTrainNo[trainNo] = nil
+			}
+		}
+		resp = append(resp, CompareEpochDto{
+			EpochNo: epochNo,
+			Trains:  byTrainNo,
+		})
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].EpochNo < resp[j].EpochNo
+	})
+
+	return resp
+}
+
+// bestMetrics returns the best epoch of every metric of the epochs. The earlier epoch is the best on a tie.
+func bestMetrics(epochs []Epoch) map[string]BestMetricDto {
+	names := map[string]bool{"accuracy": true, "loss": true, "val_accuracy": true, "val_loss": true}
+	for _, epoch := range epochs {
+		for name := range epoch.Metrics {
+			names[name] = true
+		}
+	}
+
+	best := make(map[string]BestMetricDto)
+	for name := range names {
+		maximize := isMaximized(name)
+		for _, epoch := range epochs {
+			value, ok := epoch.Value(name)
+			if !ok {
+				continue
+			}
+
+			current, exists := best[name]
+			if !exists ||
+				maximize && (value > current.Value || value == current.Value && epoch.Epoch < current.EpochNo) ||
+				!maximize && (value < current.Value || value == current.Value && epoch.Epoch < current.EpochNo) {
+				best[name] = BestMetricDto{EpochNo: epoch.Epoch, Value: value}
+			}
+		}
+	}
+
+	return best
+}
+
+// diffJson returns the values differing between the JSON documents by train no, in the order of the path.
+// The paths are joined by dots, and the elements of an array of objects are keyed by their names if all of them are named,
+// such as "layers[dense_1].param.units", so that inserting a layer doesn't change the paths of the other layers.
+// The ignored keys of the top level are not compared.
+func diffJson(docs map[int64]json.RawMessage, ignored ...string) ([]JsonDiff, error) {
+	flattened := make(map[int64]map[string]json.RawMessage)
+	paths := make(map[string]bool)
+	for trainNo, doc := range docs {
+		var value interface{}
+		if len(doc) > 0 {
+			if err := json.Unmarshal(doc, &value); err != nil {
+				return nil, err
+			}
+		}
+		if object, ok := value.(map[string]interface{}); ok {
+			for _, key := range ignored {
+				delete(object, key)
+			}
+		}
+
+		leaves := make(map[string]json.RawMessage)
+		if err := flattenJson("", value, leaves); err != nil {
+			return nil, err
+		}
+		flattened[trainNo] = leaves
+		for path := range leaves {
+			paths[path] = true
+		}
+	}
+
+	diffs := make([]JsonDiff, 0)
+	for path := range paths {
+		values := make(map[int64]json.RawMessage)
+		differs := false
+		var first json.RawMessage
+		for trainNo := range docs {
+			value := flattened[trainNo][path]
+			if len(values) == 0 {
+				first = value
+			} else if string(value) != string(first) {
+				differs = true
+			}
+			values[trainNo] = value
+		}
+
+		if differs {
+			diffs = append(diffs, JsonDiff{Path: path, Values: values})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+
+	return diffs, nil
+}
+
+// flattenJson flattens the value decoded from JSON into the leaves by path.
+func flattenJson(path string, value interface{}, leaves map[string]json.RawMessage) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			break
+		}
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if err := flattenJson(childPath, child, leaves); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if len(v) == 0 {
+			break
+		}
+		names := elementNames(v)
+		for i, child := range v {
+			key := strconv.Itoa(i)
+			if names != nil {
+				key = names[i]
+			}
+			if err := flattenJson(path+"["+key+"]", child, leaves); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	leaf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	leaves[path] = leaf
+	return nil
+}
+
+// elementNames returns the names of the elements if every element is an object of a distinct name, nil otherwise.
+func elementNames(elements []interface{}) []string {
+	names := make([]string, 0, len(elements))
+	seen := make(map[string]bool)
+	for _, element := range elements {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		name, ok := object["name"].(string)
+		if !ok || name == "" || seen[name] {
+			return nil
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
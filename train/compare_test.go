@@ -0,0 +1,114 @@
+package train
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseTrainNos(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []int
+		wantErr  bool
+	}{
+		{value: "1,3", expected: []int{1, 3}},
+		{value: "3, 1, 2", expected: []int{3, 1, 2}},
+		{value: "1", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "1,a", wantErr: true},
+		{value: "1,1", wantErr: true},
+		{value: "1,2,3,4,5,6,7,8,9,10,11", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			trainNos, err := parseTrainNos(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			assert.Equal(t, tt.expected, trainNos)
+		})
+	}
+}
+
+func Test_alignEpochs(t *testing.T) {
+	aligned := alignEpochs(map[int64][]Epoch{
+		1: {{Epoch: 2, Loss: 0.4}, {Epoch: 1, Loss: 0.5}},
+		2: {{Epoch: 1, Loss: 0.6}},
+	})
+
+	if assert.Len(t, aligned, 2) {
+		assert.Equal(t, 1, aligned[0].EpochNo)
+		assert.Equal(t, 0.5, aligned[0].Trains[1].Loss)
+		assert.Equal(t, 0.6, aligned[0].Trains[2].Loss)
+
+		assert.Equal(t, 2, aligned[1].EpochNo)
+		assert.Equal(t, 0.4, aligned[1].Trains[1].Loss)
+		// the train without the epoch is null
+		trainEpoch, ok := aligned[1].Trains[2]
+		assert.True(t, ok)
+		assert.Nil(t, trainEpoch)
+	}
+}
+
+func Test_bestMetrics(t *testing.T) {
+	best := bestMetrics([]Epoch{
+		{Epoch: 1, Acc: 0.5, Loss: 0.9, Metrics: map[string]float64{"precision": 0.4, "mse": 0.3}},
+		{Epoch: 2, Acc: 0.8, Loss: 0.5, Metrics: map[string]float64{"precision": 0.7, "mse": 0.3}},
+		{Epoch: 3, Acc: 0.7, Loss: 0.6, Metrics: map[string]float64{"precision": 0.6}},
+	})
+
+	assert.Equal(t, BestMetricDto{EpochNo: 2, Value: 0.8}, best["accuracy"])
+	assert.Equal(t, BestMetricDto{EpochNo: 2, Value: 0.5}, best["loss"])
+	assert.Equal(t, BestMetricDto{EpochNo: 2, Value: 0.7}, best["precision"])
+	// the earlier epoch on a tie
+	assert.Equal(t, BestMetricDto{EpochNo: 1, Value: 0.3}, best["mse"])
+	_, ok := best["lr"]
+	assert.False(t, ok)
+
+	assert.Empty(t, bestMetrics(nil))
+}
+
+func Test_diffJson(t *testing.T) {
+	diffs, err := diffJson(map[int64]json.RawMessage{
+		1: json.RawMessage(`{
+			"optimizer_config": {"learning_rate": 0.001, "beta_1": 0.9},
+			"batch_size": 32,
+			"flowState": {"zoom": 1},
+			"layers": [
+				{"name": "input_1", "type": "Input"},
+				{"name": "dense_1", "type": "Dense", "param": {"units": 64}}
+			]
+		}`),
+		2: json.RawMessage(`{
+			"optimizer_config": {"learning_rate": 0.01, "beta_1": 0.9},
+			"batch_size": 32,
+			"flowState": {"zoom": 2},
+			"layers": [
+				{"name": "input_1", "type": "Input"},
+				{"name": "dropout_1", "type": "Dropout"},
+				{"name": "dense_1", "type": "Dense", "param": {"units": 128}}
+			]
+		}`),
+	}, "flowState")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []JsonDiff{
+		{Path: "layers[dense_1].param.units", Values: map[int64]json.RawMessage{1: json.RawMessage(`64`), 2: json.RawMessage(`128`)}},
+		{Path: "layers[dropout_1].name", Values: map[int64]json.RawMessage{1: nil, 2: json.RawMessage(`"dropout_1"`)}},
+		{Path: "layers[dropout_1].type", Values: map[int64]json.RawMessage{1: nil, 2: json.RawMessage(`"Dropout"`)}},
+		{Path: "optimizer_config.learning_rate", Values: map[int64]json.RawMessage{1: json.RawMessage(`0.001`), 2: json.RawMessage(`0.01`)}},
+	}, diffs)
+
+	// unnamed elements are keyed by index
+	diffs, err = diffJson(map[int64]json.RawMessage{
+		1: json.RawMessage(`{"metrics": ["accuracy"]}`),
+		2: json.RawMessage(`{"metrics": ["accuracy", "auc"]}`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []JsonDiff{
+		{Path: "metrics[1]", Values: map[int64]json.RawMessage{1: nil, 2: json.RawMessage(`"auc"`)}},
+	}, diffs)
+
+	_, err = diffJson(map[int64]json.RawMessage{1: json.RawMessage(`{`)})
+	assert.Error(t, err)
+}
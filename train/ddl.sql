@@ -12,7 +12,14 @@ create table train
     name varchar(45) null comment 'name',
     epochs int default 0 null,
     result_url text null,
+    result_size bigint default 0 not null,
     status varchar(10) null,
+    queue_order bigint default 0 not null comment 'dispatch order of queued trains',
+    heartbeat_time datetime null comment 'last heartbeat or epoch from the trainer, dequeue time until the first',
+    callback_secret varchar(64) null comment 'signing key of the callbacks from the trainer',
+    monitor_metric varchar(64) default '' not null comment 'metric deciding the best epoch',
+    best_epoch int null,
+    best_value double null comment 'value of the monitored metric at the best epoch',
     constraint train_uk_user_id_train_no
         unique (user_id, train_no),
     constraint train_ibfk_1
@@ -23,6 +30,9 @@ create table train
 create index train_id
 	on train (project_id);
 
+create index train_status_queue_order
+	on train (status, queue_order);
+
 
 create table train_config
 (
@@ -31,16 +41,29 @@ create table train_config
     train_id bigint not null,
     train_dataset_url varchar(1024) not null,
     valid_dataset_url varchar(1024) null,
+    test_dataset_url varchar(1024) null,
+    dataset_id bigint null,
+    dataset_version_id bigint null,
+    dataset_config_id bigint null,
     dataset_shuffle tinyint(1) not null,
     dataset_label varchar(512) not null,
     dataset_normalization_usage tinyint(1) not null,
     dataset_normalization_method varchar(512) null,
+    dataset_pipeline json null,
+    dataset_kind varchar(10) default '' not null,
+    dataset_preparation json null,
     model_content json not null,
     model_config json not null,
     create_time datetime default CURRENT_TIMESTAMP not null,
     update_time datetime default CURRENT_TIMESTAMP not null on update CURRENT_TIMESTAMP
 );
 
+create index train_config_dataset_id
+	on train_config (dataset_id);
+
+create index train_config__index_dataset_version_id
+	on train_config (dataset_version_id);
+
 
 create table train_log
 (
@@ -73,9 +96,47 @@ create table epoch
     val_loss float null comment 'val_loss',
     learning_rate float null comment 'lr',
     create_time datetime default CURRENT_TIMESTAMP not null,
-    update_time datetime default CURRENT_TIMESTAMP not null on update CURRENT_TIMESTAMP
+    update_time datetime default CURRENT_TIMESTAMP not null on update CURRENT_TIMESTAMP,
+    constraint epoch_uk_train_id_epoch
+        unique (train_id, epoch)
 );
 
-create index train_id
-	on epoch (train_id);
 
+create table epoch_metric
+(
+    id bigint auto_increment
+        primary key,
+    train_id bigint not null,
+    epoch int not null,
+    name varchar(64) not null,
+    value double not null,
+    create_time datetime default CURRENT_TIMESTAMP not null,
+    update_time datetime default CURRENT_TIMESTAMP not null on update CURRENT_TIMESTAMP,
+    constraint epoch_metric_uk_train_id_epoch_name
+        unique (train_id, epoch, name),
+    constraint epoch_metric_fk_train_id
+        foreign key (train_id) references train (id)
+            on delete cascade
+);
+
+
+create table step_metric
+(
+    id bigint auto_increment
+        primary key,
+    train_id bigint not null,
+    epoch int not null,
+    sample int not null comment 'bucket of the steps in the epoch',
+    step int not null comment 'latest step of the bucket',
+    metrics json not null,
+    create_time datetime default CURRENT_TIMESTAMP not null,
+    update_time datetime default CURRENT_TIMESTAMP not null on update CURRENT_TIMESTAMP,
+    constraint step_metric_uk_train_id_epoch_sample
+        unique (train_id, epoch, sample),
+    constraint step_metric_fk_train_id
+        foreign key (train_id) references train (id)
+            on delete cascade
+);
+
+create index step_metric_update_time
+	on step_metric (update_time);
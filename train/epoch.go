@@ -18,6 +18,8 @@ type Epoch struct {
 	LearningRate float64   `db:"learning_rate" json:"lr"`
 	CreateTime   time.Time `db:"create_time" json:"create_time"`
 	UpdateTime   time.Time `db:"update_time" json:"update_time"`
+
+	Metrics map[string]float64 `db:"-" json:"metrics,omitempty"` // metrics other than the above by name
 }
 
 func (e *Epoch) Bind(r *http.Request) error {
@@ -6,11 +6,11 @@ import (
 )
 
 const (
-	defaultSelectEpochQuery = "SELECT e.id, train_id, epoch, acc, loss, val_acc, val_loss, learning_rate, create_time, update_time FROM epoch e "
-	defaultSelectEpochColumns = "e.id, e.train_id, e.epoch, e.acc, e.loss, e.val_acc, e.val_loss, e.learning_rate, e.create_time, e.update_time"
+	defaultSelectEpochQuery         = "SELECT e.id, train_id, epoch, acc, loss, val_acc, val_loss, learning_rate, create_time, update_time FROM epoch e "
+	defaultSelectEpochColumns       = "e.id, e.train_id, e.epoch, e.acc, e.loss, e.val_acc, e.val_loss, e.learning_rate, e.create_time, e.update_time"
+	defaultSelectEpochMetricColumns = "em.train_id, em.epoch, em.name, em.value"
 )
 
-
 func WithEpochTrainId(trainId int64) query.Option {
 	return query.OptionFunc(func(b *query.Builder) {
 		b.AddWhere("e.id = ?", trainId)
@@ -21,25 +21,27 @@ type EpochDbRepository struct {
 	DB *sqlx.DB
 }
 
-func (edr *EpochDbRepository) Insert(epoch Epoch) error {
-	builder := query.Builder{}
-	builder.AddInsert(
-		"epoch",
-		"train_id, epoch, acc, loss, val_acc, val_loss, learning_rate",
-		":train_id, :epoch, :acc, :loss, :val_acc, :val_loss, :learning_rate",
-	)
-
-	err := builder.Build()
+func (edr *EpochDbRepository) Upsert(epoch Epoch) (bool, error) {
+	result, err := edr.DB.NamedExec(`
+INSERT INTO epoch (train_id, epoch, acc, loss, val_acc, val_loss, learning_rate)
+VALUES (:train_id, :epoch, :acc, :loss, :val_acc, :val_loss, :learning_rate)
+ON DUPLICATE KEY UPDATE acc           = VALUES(acc),
+                        loss          = VALUES(loss),
+                        val_acc       = VALUES(val_acc),
+                        val_loss      = VALUES(val_loss),
+                        learning_rate = VALUES(learning_rate);
+`, &epoch)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	_, err = edr.DB.NamedExec(builder.QueryString, &epoch)
+	// 1 if inserted, 2 if updated and 0 if updated with the same values
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return affected == 1, nil
 }
 
 func (edr *EpochDbRepository) Find(opts ...query.Option) (Epoch, error) {
@@ -105,10 +107,59 @@ func (edr *EpochDbRepository) Delete(opts ...query.Option) error {
 		return err
 	}
 
-	_, err = edr.DB.Exec(builder.QueryString,builder.Args)
+	_, err = edr.DB.Exec(builder.QueryString, builder.Args)
 	if err != nil {
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (edr *EpochDbRepository) UpsertMetrics(trainId int64, epoch int, metrics map[string]float64) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var epochMetrics []EpochMetric
+	for name, value := range metrics {
+		epochMetrics = append(epochMetrics, EpochMetric{
+			TrainId: trainId,
+			Epoch:   epoch,
+			Name:    name,
+			Value:   value,
+		})
+	}
+
+	_, err := edr.DB.NamedExec(`
+INSERT INTO epoch_metric (train_id, epoch, name, value)
+VALUES (:train_id, :epoch, :name, :value)
+ON DUPLICATE KEY UPDATE value = VALUES(value);
+`, epochMetrics)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (edr *EpochDbRepository) FindAllMetrics(opts ...query.Option) ([]EpochMetric, error) {
+	builder := query.ApplyQueryOptions(opts...)
+	builder.AddSelect(defaultSelectEpochMetricColumns).
+		AddFrom("epoch_metric em").
+		AddJoin("train t ON em.train_id = t.id").
+		AddJoin("project p ON t.project_id = p.id").
+		AddOrder("em.epoch, em.name")
+
+	err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []EpochMetric
+	err = edr.DB.Select(&metrics, builder.QueryString, builder.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
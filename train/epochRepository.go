@@ -3,8 +3,13 @@ package train
 import "github.com/elixter/Querybuilder"
 
 type EpochRepository interface {
-	Insert(epoch Epoch) error
+	// Upsert inserts the epoch or updates the epoch of the same number of the train.
+	// It returns true if the epoch is inserted.
+	Upsert(epoch Epoch) (bool, error)
 	Find(opts ...query.Option) (Epoch, error)
 	Delete(opts ...query.Option) error
 	FindAll(opts ...query.Option) ([]Epoch, error)
+	// UpsertMetrics inserts the metrics of the epoch or updates the metrics of the same names.
+	UpsertMetrics(trainId int64, epoch int, metrics map[string]float64) error
+	FindAllMetrics(opts ...query.Option) ([]EpochMetric, error)
 }
@@ -1,19 +1,30 @@
 package train
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"net/http"
 	"nns_back/log"
 	"nns_back/util"
+	"reflect"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 )
 
 const (
 	socketReadSize  = 1024
 	socketWriteSize = 1024
+	socketWriteWait = 10 * time.Second
+	socketPongWait  = 60 * time.Second
+	// pings are sent before the pong wait of the previous ping ends
+	socketPingPeriod = socketPongWait * 9 / 10
+
+	// monitors buffered for each subscription, which is closed if the buffer is full
+	subscriptionBufferSize = 256
 
 	epochLogFormat = "Epoch=%d Accuracy=%g Loss=%g Val_accuracy=%g Val_Loss=%g Learning_rate=%g"
 
@@ -26,17 +37,21 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     defaultCheckOrigin,
 }
 
+// Bridge relays the callbacks of the trainer to the subscribers of each train, such as the monitor websockets.
 type Bridge struct {
-	clients map[int64]*Client
+	mu            sync.Mutex
+	subscriptions map[int64]map[*Subscription]struct{} // by train id
 
 	epochRepository    EpochRepository
 	trainRepository    TrainRepository
 	trainLogRepository TrainLogRepository
+
+	steps *StepRecorder // throttled steps are flushed before the epoch
 }
 
 func NewBridge(epochRepository EpochRepository, trainRepository TrainRepository, trainLogRepository TrainLogRepository) *Bridge {
 	bridge := Bridge{
-		clients:            map[int64]*Client{},
+		subscriptions:      map[int64]map[*Subscription]struct{}{},
 		epochRepository:    epochRepository,
 		trainRepository:    trainRepository,
 		trainLogRepository: trainLogRepository,
@@ -49,52 +64,79 @@ func defaultCheckOrigin(r *http.Request) bool {
 	return true
 }
 
+// isPathTrain reports whether the train of the callback body is the train of the path,
+// which is authenticated by the CallbackAuthenticator.
+func isPathTrain(r *http.Request, trainId int64) bool {
+	return pathTrainId(r) == strconv.FormatInt(trainId, 10)
+}
+
 func getTrainId(r *http.Request) int64 {
 	tid, _ := strconv.ParseInt(r.Header.Get("trainId"), 10, 0)
 
 	return tid
 }
 
-type Client struct {
-	conn    *websocket.Conn
-	send    chan *Monitor
-	TrainId int64
-}
-
+// NewEpochHandler saves the epoch posted by the trainer.
+// Epochs are upserted on the epoch number, so that retries of the trainer don't duplicate them,
+// and the train is only advanced by the latest epoch even if epochs are posted out of order.
 func (b *Bridge) NewEpochHandler(w http.ResponseWriter, r *http.Request) {
-	tid, err := strconv.ParseInt(mux.Vars(r)["trainId"], 10, 0)
-
-	log.Debug(tid)
+	tid, err := strconv.ParseInt(mux.Vars(r)["trainId"], 10, 64)
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
 
 	var epoch Epoch
-	epoch.TrainId = tid
 	err = epoch.Bind(r)
-	if err != nil {
-		log.Error(err)
+	if err != nil || epoch.Epoch < 0 {
+		log.Warnw("failed to bind epoch",
+			"error", err,
+			"trainId", tid)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+	epoch.TrainId = tid
+
+	if err := validateMetrics(epoch.Metrics); err != nil {
+		log.Warnw("invalid epoch metrics",
+			"error", err,
+			"trainId", tid)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
 		return
 	}
 
 	log.Debug(epoch)
 
-	err = b.epochRepository.Insert(epoch)
+	inserted, err := b.epochRepository.Upsert(epoch)
 	if err != nil {
-		log.Error(err)
+		log.Errorf("failed to Upsert(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
 
-	train, err := b.trainRepository.Find(WithTrainTrainId(epoch.TrainId))
-	if err != nil {
-		log.Error(err)
+	if err := b.epochRepository.UpsertMetrics(epoch.TrainId, epoch.Epoch, epoch.Metrics); err != nil {
+		log.Errorf("failed to UpsertMetrics(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
-	train.Update(epoch)
 
-	err = b.trainRepository.Update(train)
-	if err != nil {
-		log.Error(err)
+	if _, err := b.trainRepository.AdvanceEpoch(epoch); err != nil {
+		log.Errorf("failed to AdvanceEpoch(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if err := b.updateBest(epoch); err != nil {
+		log.Errorf("failed to updateBest(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
 
+	// an epoch is also a heartbeat of the trainer
+	if _, err := b.trainRepository.Heartbeat(epoch.TrainId); err != nil {
+		log.Error(err)
+	}
+
 	msg := fmt.Sprintf(
 		epochLogFormat,
 		epoch.Epoch,
@@ -113,10 +155,16 @@ func (b *Bridge) NewEpochHandler(w http.ResponseWriter, r *http.Request) {
 		UpdateTime: time.Now(),
 	}
 
-	err = b.trainLogRepository.Insert(trainLog)
-	if err != nil {
-		log.Error(err)
-		return
+	// retried epoch is already logged, but monitored again,
+	// since the request may be retried after it failed before the monitors were sent.
+	// The monitors replace the epoch of the same number.
+	if inserted {
+		trainLog.Id, err = b.trainLogRepository.Insert(trainLog)
+		if err != nil {
+			log.Errorf("failed to Insert(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+			return
+		}
 	}
 
 	monitor := Monitor{
@@ -125,14 +173,66 @@ func (b *Bridge) NewEpochHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debug(monitor)
 
+	if b.steps != nil {
+		b.steps.flush(epoch.TrainId, epoch.Epoch)
+	}
 	b.Send(epoch.TrainId, &monitor)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateBest updates the best epoch of the train if the epoch is better in the monitored metric of the train.
+func (b *Bridge) updateBest(epoch Epoch) error {
+	train, err := b.trainRepository.Find(WithTrainTrainId(epoch.TrainId))
+	if err != nil {
+		return err
+	}
+
+	value, ok := epoch.Value(train.MonitorMetric)
+	if !ok {
+		return nil
+	}
+
+	_, err = b.trainRepository.UpdateBest(epoch.TrainId, epoch.Epoch, value, isMaximized(train.MonitorMetric))
+	return err
+}
+
+// HeartbeatHandler records that the trainer is alive while training.
+// Trains without heartbeat or epoch for the timeout are failed by the Watchdog.
+// It responds 404 to the train not training anymore, so that the trainer can stop it.
+func (b *Bridge) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	tid, err := strconv.ParseInt(mux.Vars(r)["trainId"], 10, 64)
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	training, err := b.trainRepository.Heartbeat(tid)
+	if err != nil {
+		log.Errorf("failed to Heartbeat(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !training {
+		util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (b *Bridge) TrainLogHandler(w http.ResponseWriter, r *http.Request) {
 	var trainLog TrainLog
 	err := trainLog.Bind(r)
 	if err != nil {
-		log.Debug(err)
+		log.Warnw("failed to bind train log",
+			"error", err)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	if !isPathTrain(r, trainLog.TrainId) {
+		util.WriteError(w, http.StatusForbidden, util.ErrForbidden)
 		return
 	}
 
@@ -140,9 +240,11 @@ func (b *Bridge) TrainLogHandler(w http.ResponseWriter, r *http.Request) {
 
 	trainLog.CreateTime = time.Now()
 	trainLog.UpdateTime = time.Now()
-	err = b.trainLogRepository.Insert(trainLog)
+	trainLog.Id, err = b.trainLogRepository.Insert(trainLog)
 	if err != nil {
-		log.Debug(err)
+		log.Errorf("failed to Insert(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
 	}
 
 	monitor := Monitor{
@@ -151,26 +253,46 @@ func (b *Bridge) TrainLogHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug(monitor)
 
 	b.Send(trainLog.TrainId, &monitor)
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (b *Bridge) TrainReplyHandler(w http.ResponseWriter, r *http.Request) {
 	var trainLog TrainLog
 	err := trainLog.Bind(r)
 	if err != nil {
-		log.Error(err)
+		log.Warnw("failed to bind train reply",
+			"error", err)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	if !isPathTrain(r, trainLog.TrainId) {
+		util.WriteError(w, http.StatusForbidden, util.ErrForbidden)
 		return
 	}
 
 	log.Debug(trainLog)
 
-	err = b.trainLogRepository.Insert(trainLog)
+	trainLog.Id, err = b.trainLogRepository.Insert(trainLog)
 	if err != nil {
-		log.Error(err)
+		log.Errorf("failed to Insert(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
 	}
 
 	train, err := b.trainRepository.Find(WithTrainTrainId(trainLog.TrainId))
 	if err != nil {
-		log.Error(err)
+		log.Errorf("failed to Find(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if train.Status == TrainStatusCancelled {
+		// the trainer replies to the cancel request, which is not a failure of the train
+		log.Debug("Train cancelled")
+		b.Close(trainLog.TrainId)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
@@ -178,14 +300,16 @@ func (b *Bridge) TrainReplyHandler(w http.ResponseWriter, r *http.Request) {
 		train.Status = TrainStatusFinish
 		err = b.trainRepository.Update(train)
 		if err != nil {
-			log.Error(err)
+			log.Errorf("failed to Update(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 			return
 		}
 	} else if trainLog.StatusCode >= 400 {
 		train.Status = TrainStatusError
 		err = b.trainRepository.Update(train)
 		if err != nil {
-			log.Error(err)
+			log.Errorf("failed to Update(): %v", err)
+			util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 			return
 		}
 	}
@@ -193,15 +317,13 @@ func (b *Bridge) TrainReplyHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("Train finished")
 
 	b.Close(trainLog.TrainId)
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// MonitorWsHandler subscribes the websocket to the monitors of the train.
+// Every epoch of the train so far is sent on join, then the monitors as they are sent to the bridge.
 func (b *Bridge) MonitorWsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
 	userId, ok := r.Context().Value("userId").(int64)
 	if !ok {
 		log.Errorw("failed to conversion interface to int64",
@@ -215,60 +337,292 @@ func (b *Bridge) MonitorWsHandler(w http.ResponseWriter, r *http.Request) {
 	projectNo, _ := strconv.Atoi(vars["projectNo"])
 	trainNo, _ := strconv.Atoi(vars["trainNo"])
 
-	log.Debug(userId, projectNo, trainNo)
-
 	train, err := b.trainRepository.Find(WithTrainUserId(userId), WithProjectProjectNo(projectNo), WithTrainTrainNo(trainNo))
 	if err != nil {
-		log.Error(err)
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorf("failed to Find(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
 	}
 
-	log.Debug(train)
+	subscription, history, err := b.join(train.Id)
+	if err != nil {
+		log.Errorf("failed to join(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
 
-	log.Debugf("Train id: %d", train.Id)
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error(err)
+		b.Unsubscribe(subscription)
+		return
+	}
 
 	client := &Client{
-		conn:    conn,
-		send:    make(chan *Monitor),
-		TrainId: train.Id,
+		conn:         conn,
+		subscription: subscription,
+		history:      history,
+		bridge:       b,
 	}
 
-	b.clients[train.Id] = client
-
 	go client.writePump()
+	go client.readPump()
+}
+
+// join subscribes to the train and returns the epochs of the train so far.
+// The train is subscribed before the epochs are found so that no epoch is missed in between,
+// and the subscription is closed at once if the train is already over.
+func (b *Bridge) join(tid int64) (*Subscription, []Epoch, error) {
+	subscription := b.Subscribe(tid)
+
+	history, err := b.epochRepository.FindAll(WithTrainTrainId(tid))
+	if err != nil {
+		b.Unsubscribe(subscription)
+		return nil, nil, err
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Epoch < history[j].Epoch
+	})
+
+	train, err := b.trainRepository.Find(WithTrainTrainId(tid))
+	if err != nil {
+		b.Unsubscribe(subscription)
+		return nil, nil, err
+	}
+	if isTrainOver(train.Status) {
+		b.closeSubscription(subscription, websocket.CloseNormalClosure, "train over")
+	}
+
+	return subscription, history, nil
+}
+
+// isTrainOver reports whether no more monitor is sent for the train of the status.
+func isTrainOver(status string) bool {
+	switch status {
+	case TrainStatusFinish, TrainStatusError, TrainStatusCancelled, TrainStatusDelete:
+		return true
+	}
+	return false
+}
+
+// Subscription receives the monitors of a train until it is closed by the bridge.
+type Subscription struct {
+	TrainId int64
+
+	send chan *Monitor
+
+	// why the subscription is closed, which is read after send is closed
+	closeCode   int
+	closeReason string
+}
+
+// Monitors returns the channel of the monitors, which is closed when the subscription is closed.
+func (s *Subscription) Monitors() <-chan *Monitor {
+	return s.send
+}
+
+// CloseReason returns why the subscription is closed. It must be called after Monitors is closed.
+func (s *Subscription) CloseReason() (int, string) {
+	return s.closeCode, s.closeReason
+}
+
+// Subscribe subscribes to the monitors of the train. It must be unsubscribed when the subscriber leaves.
+func (b *Bridge) Subscribe(tid int64) *Subscription {
+	subscription := &Subscription{
+		TrainId: tid,
+		send:    make(chan *Monitor, subscriptionBufferSize),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscriptions[tid] == nil {
+		b.subscriptions[tid] = make(map[*Subscription]struct{})
+	}
+	b.subscriptions[tid][subscription] = struct{}{}
+
+	return subscription
+}
+
+// Unsubscribe closes the subscription unless it is already closed.
+func (b *Bridge) Unsubscribe(subscription *Subscription) {
+	b.closeSubscription(subscription, websocket.CloseGoingAway, "unsubscribed")
+}
+
+func (b *Bridge) closeSubscription(subscription *Subscription, code int, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscriptions[subscription.TrainId][subscription]; ok {
+		b.remove(subscription, code, reason)
+	}
+}
+
+// remove closes the subscription. b.mu must be held.
+func (b *Bridge) remove(subscription *Subscription, code int, reason string) {
+	subscription.closeCode = code
+	subscription.closeReason = reason
+	close(subscription.send)
+
+	subscriptions := b.subscriptions[subscription.TrainId]
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(b.subscriptions, subscription.TrainId)
+	}
+}
+
+// Subscribers returns the number of the subscriptions of the train.
+func (b *Bridge) Subscribers(tid int64) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscriptions[tid])
 }
 
 func (b *Bridge) Close(tid int64) {
-	if client, ok := b.clients[tid]; ok {
-		client.conn.Close()
-		close(client.send)
-		delete(b.clients, tid)
+	b.close(tid, "train finished")
+}
+
+// Cancel sends the log of the cancelled train to the monitor and closes it.
+func (b *Bridge) Cancel(tid int64, trainLog TrainLog) {
+	b.Send(tid, &Monitor{TrainLog: trainLog})
+	b.close(tid, "train cancelled")
+}
+
+// Fail sends the log of the failed train to the monitor and closes it.
+func (b *Bridge) Fail(tid int64, trainLog TrainLog) {
+	b.Send(tid, &Monitor{TrainLog: trainLog})
+	b.close(tid, "train failed")
+}
+
+func (b *Bridge) close(tid int64, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscription := range b.subscriptions[tid] {
+		b.remove(subscription, websocket.CloseNormalClosure, reason)
 	}
 }
 
+// Send sends the monitor to every subscription of the train without blocking.
+// Subscriptions too slow to receive are closed, so that a subscriber can't hold up the trainer.
 func (b *Bridge) Send(tid int64, monitor *Monitor) {
-	if client, ok := b.clients[tid]; ok {
-		client.send <- monitor
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscription := range b.subscriptions[tid] {
+		select {
+		case subscription.send <- monitor:
+		default:
+			log.Warnw("monitor subscription too slow",
+				"trainId", tid)
+			b.remove(subscription, websocket.CloseTryAgainLater, "too slow")
+		}
+	}
+}
+
+// Client is a websocket subscribing to the monitors of a train.
+type Client struct {
+	conn         *websocket.Conn
+	subscription *Subscription
+	history      []Epoch // sent before the subscription
+	bridge       *Bridge
+}
+
+// readPump reads the websocket to process pongs and the close of the client,
+// and unsubscribes when the client leaves or stops answering pings.
+func (c *Client) readPump() {
+	defer c.bridge.Unsubscribe(c.subscription)
+
+	c.conn.SetReadLimit(socketReadSize)
+	c.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
 	}
 }
 
+// writePump writes the history and then the monitors of the subscription with pings,
+// and closes the websocket when the subscription is closed.
 func (c *Client) writePump() {
+	ticker := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	sent := make(map[int]Epoch, len(c.history))
+	for _, epoch := range c.history {
+		if err := c.write(&Monitor{Epoch: epoch}); err != nil {
+			c.bridge.Unsubscribe(c.subscription)
+			return
+		}
+		sent[epoch.Epoch] = epoch
+	}
+
 	for {
 		select {
-		case msg, ok := <-c.send:
+		case monitor, ok := <-c.subscription.Monitors():
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				code, reason := c.subscription.CloseReason()
+				c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteWait))
 				return
 			}
 
-			err := c.write(msg)
-			if err != nil {
-				log.Error(err)
+			// epochs sent between the subscription and the history are already sent,
+			// but the retried epochs of other values replace the sent ones
+			if monitor.Epoch.TrainId != 0 && isEpochSent(sent, monitor.Epoch) {
+				continue
+			}
+
+			if err := c.write(monitor); err != nil {
+				log.Debug(err)
+				c.bridge.Unsubscribe(c.subscription)
+				return
+			}
+			if monitor.Epoch.TrainId != 0 {
+				sent[monitor.Epoch.Epoch] = monitor.Epoch
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				c.bridge.Unsubscribe(c.subscription)
 				return
 			}
 		}
 	}
 }
 
+// isEpochSent reports whether the same values of the epoch are already sent.
+// The epochs of the history have no metrics, so the metrics are compared only if both epochs have them.
+func isEpochSent(sent map[int]Epoch, epoch Epoch) bool {
+	previous, ok := sent[epoch.Epoch]
+	if !ok {
+		return false
+	}
+
+	if previous.Acc != epoch.Acc ||
+		previous.Loss != epoch.Loss ||
+		previous.ValAcc != epoch.ValAcc ||
+		previous.ValLoss != epoch.ValLoss ||
+		previous.LearningRate != epoch.LearningRate {
+		return false
+	}
+	if previous.Metrics != nil && epoch.Metrics != nil {
+		return reflect.DeepEqual(previous.Metrics, epoch.Metrics)
+	}
+	return true
+}
+
 func (c *Client) write(monitor *Monitor) error {
+	c.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
 	return c.conn.WriteJSON(monitor)
 }
@@ -0,0 +1,325 @@
+package train
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/elixter/Querybuilder"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"nns_back/log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// epochMemoryRepository keeps the epochs by train id and epoch number like the unique key of the epoch table.
+type epochMemoryRepository struct {
+	EpochRepository
+	epochs  map[[2]int64]Epoch
+	metrics map[[2]int64]map[string]float64
+	err     error
+}
+
+func (r *epochMemoryRepository) Upsert(epoch Epoch) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	key := [2]int64{epoch.TrainId, int64(epoch.Epoch)}
+	_, exists := r.epochs[key]
+	r.epochs[key] = epoch
+	return !exists, nil
+}
+
+func (r *epochMemoryRepository) UpsertMetrics(trainId int64, epoch int, metrics map[string]float64) error {
+	key := [2]int64{trainId, int64(epoch)}
+	for name, value := range metrics {
+		if r.metrics[key] == nil {
+			r.metrics[key] = make(map[string]float64)
+		}
+		r.metrics[key][name] = value
+	}
+	return nil
+}
+
+// epochTrainRepository advances the train like AdvanceEpoch of TrainDbRepository.
+type epochTrainRepository struct {
+	TrainRepository
+	train  Train
+	epochs *epochMemoryRepository
+}
+
+func (r *epochTrainRepository) AdvanceEpoch(epoch Epoch) (bool, error) {
+	for key := range r.epochs.epochs {
+		if key[0] == epoch.TrainId && key[1] > int64(epoch.Epoch) {
+			return false, nil
+		}
+	}
+	r.train.Acc = epoch.Acc
+	r.train.Loss = epoch.Loss
+	r.train.Epochs = epoch.Epoch
+	return true, nil
+}
+
+func (r *epochTrainRepository) Find(opts ...query.Option) (Train, error) {
+	return r.train, nil
+}
+
+func (r *epochTrainRepository) UpdateBest(trainId int64, epoch int, value float64, maximize bool) (bool, error) {
+	if r.train.BestValue.Valid && (maximize && r.train.BestValue.Float64 >= value || !maximize && r.train.BestValue.Float64 <= value) {
+		return false, nil
+	}
+	r.train.BestEpoch = sql.NullInt64{Int64: int64(epoch), Valid: true}
+	r.train.BestValue = sql.NullFloat64{Float64: value, Valid: true}
+	return true, nil
+}
+
+func (r *epochTrainRepository) Heartbeat(trainId int64) (bool, error) {
+	return true, nil
+}
+
+func TestBridge_NewEpochHandler(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	epochRepository := &epochMemoryRepository{epochs: map[[2]int64]Epoch{}, metrics: map[[2]int64]map[string]float64{}}
+	trainRepository := &epochTrainRepository{train: Train{Id: 3, MonitorMetric: "val_precision"}, epochs: epochRepository}
+	trainLogRepository := &cancelTrainLogRepository{}
+	bridge := NewBridge(epochRepository, trainRepository, trainLogRepository)
+	subscription := bridge.Subscribe(3)
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/project/1/train/3/epoch", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"projectNo": "1", "trainId": "3"})
+		rec := httptest.NewRecorder()
+		bridge.NewEpochHandler(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, post(`{"epoch": 1, "accuracy": 0.5, "loss": 0.9, "metrics": {"val_precision": 0.6}}`))
+	assert.Equal(t, http.StatusNoContent, post(`{"epoch": 2, "accuracy": 0.7, "loss": 0.5, "metrics": {"val_precision": 0.8, "mse": 0.1}}`))
+	// retried by the trainer
+	assert.Equal(t, http.StatusNoContent, post(`{"epoch": 2, "accuracy": 0.7, "loss": 0.5}`))
+	// posted out of order
+	assert.Equal(t, http.StatusNoContent, post(`{"epoch": 1, "accuracy": 0.5, "loss": 0.9}`))
+	// train_id of the body is ignored
+	assert.Equal(t, http.StatusNoContent, post(`{"epoch": 3, "train_id": 4, "accuracy": 0.8, "loss": 0.4, "metrics": {"val_precision": 0.7}}`))
+
+	assert.Len(t, epochRepository.epochs, 3)
+	assert.Equal(t, 3, trainRepository.train.Epochs)
+	assert.Equal(t, 0.8, trainRepository.train.Acc)
+	assert.Equal(t, 0.4, trainRepository.train.Loss)
+	// only new epochs are logged
+	assert.Len(t, trainLogRepository.logs, 3)
+	// but every epoch is monitored, even if retried
+	assert.Len(t, subscription.Monitors(), 5)
+
+	assert.Equal(t, map[string]float64{"val_precision": 0.8, "mse": 0.1}, epochRepository.metrics[[2]int64{3, 2}])
+	// the best epoch by the monitored metric
+	assert.Equal(t, sql.NullInt64{Int64: 2, Valid: true}, trainRepository.train.BestEpoch)
+	assert.Equal(t, sql.NullFloat64{Float64: 0.8, Valid: true}, trainRepository.train.BestValue)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"epoch": "1"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"epoch": -1}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"epoch": 4, "metrics": {"f1 score": 0.5}}`))
+
+	epochRepository.err = errors.New("db error")
+	assert.Equal(t, http.StatusInternalServerError, post(`{"epoch": 4}`))
+}
+
+func receive(t *testing.T, subscription *Subscription) (*Monitor, bool) {
+	select {
+	case monitor, ok := <-subscription.Monitors():
+		return monitor, ok
+	case <-time.After(time.Second):
+		t.Fatal("no monitor received")
+		return nil, false
+	}
+}
+
+func TestBridge_Subscribe(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	bridge := NewBridge(nil, nil, nil)
+	first := bridge.Subscribe(3)
+	second := bridge.Subscribe(3)
+	other := bridge.Subscribe(4)
+	assert.Equal(t, 2, bridge.Subscribers(3))
+
+	// every subscriber of the train receives the monitor
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 1}})
+	for _, subscription := range []*Subscription{first, second} {
+		monitor, ok := receive(t, subscription)
+		assert.True(t, ok)
+		assert.Equal(t, 1, monitor.Epoch.Epoch)
+	}
+	assert.Len(t, other.Monitors(), 0)
+
+	// the unsubscribed doesn't affect the others
+	bridge.Unsubscribe(first)
+	bridge.Unsubscribe(first)
+	_, ok := receive(t, first)
+	assert.False(t, ok)
+	assert.Equal(t, 1, bridge.Subscribers(3))
+
+	bridge.Cancel(3, TrainLog{TrainId: 3, Message: trainCancelledMessage})
+	monitor, ok := receive(t, second)
+	assert.True(t, ok)
+	assert.Equal(t, trainCancelledMessage, monitor.TrainLog.Message)
+	_, ok = receive(t, second)
+	assert.False(t, ok)
+	code, reason := second.CloseReason()
+	assert.Equal(t, websocket.CloseNormalClosure, code)
+	assert.Equal(t, "train cancelled", reason)
+	assert.Equal(t, 0, bridge.Subscribers(3))
+
+	// unsubscribing the closed subscription is no-op
+	bridge.Unsubscribe(second)
+	assert.Equal(t, 1, bridge.Subscribers(4))
+}
+
+func TestBridge_Send_slowSubscription(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	bridge := NewBridge(nil, nil, nil)
+	slow := bridge.Subscribe(3)
+	fast := bridge.Subscribe(3)
+
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: i}})
+		receive(t, fast)
+	}
+
+	assert.Equal(t, 1, bridge.Subscribers(3))
+	for range slow.Monitors() {
+	}
+	code, _ := slow.CloseReason()
+	assert.Equal(t, websocket.CloseTryAgainLater, code)
+}
+
+// TestBridge_concurrent is meant to be run with the race detector.
+func TestBridge_concurrent(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	bridge := NewBridge(nil, nil, nil)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			subscription := bridge.Subscribe(int64(i % 2))
+			for j := 0; j < 10; j++ {
+				select {
+				case <-subscription.Monitors():
+				case <-time.After(time.Millisecond):
+				}
+			}
+			bridge.Unsubscribe(subscription)
+		}(i)
+	}
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(tid int64) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				bridge.Send(tid, &Monitor{Epoch: Epoch{TrainId: tid, Epoch: j}})
+				bridge.Subscribers(tid)
+			}
+			bridge.Close(tid)
+		}(int64(i))
+	}
+
+	wg.Wait()
+}
+
+// monitorTrainRepository is a TrainRepository of a single train, which only supports finding the train.
+type monitorTrainRepository struct {
+	TrainRepository
+	train Train
+}
+
+func (r *monitorTrainRepository) Find(opts ...query.Option) (Train, error) {
+	return r.train, nil
+}
+
+// historyEpochRepository finds the epochs of a single train.
+type historyEpochRepository struct {
+	EpochRepository
+	epochs []Epoch
+}
+
+func (r *historyEpochRepository) FindAll(opts ...query.Option) ([]Epoch, error) {
+	return r.epochs, nil
+}
+
+func TestBridge_MonitorWsHandler(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	bridge := NewBridge(
+		&historyEpochRepository{epochs: []Epoch{{TrainId: 3, Epoch: 2}, {TrainId: 3, Epoch: 1}}},
+		&monitorTrainRepository{train: Train{Id: 3, Status: TrainStatusTrain}},
+		nil,
+	)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		bridge.MonitorWsHandler(w, r.WithContext(context.WithValue(r.Context(), "userId", int64(1))))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/project/1/train/1"
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	read := func(conn *websocket.Conn) (Monitor, error) {
+		var monitor Monitor
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		err := conn.ReadJSON(&monitor)
+		return monitor, err
+	}
+
+	// the epochs so far are sent on join in order
+	for _, conn := range conns {
+		for _, expected := range []int{1, 2} {
+			monitor, err := read(conn)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, monitor.Epoch.Epoch)
+		}
+	}
+
+	assert.Equal(t, 2, bridge.Subscribers(3))
+	// the retried epoch of the same values is already sent, but the corrected epoch is sent again
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 2}})
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 1, Acc: 0.9}})
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 3}})
+	bridge.Close(3)
+
+	for _, conn := range conns {
+		monitor, err := read(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, monitor.Epoch.Epoch)
+		assert.Equal(t, 0.9, monitor.Epoch.Acc)
+
+		monitor, err = read(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, monitor.Epoch.Epoch)
+
+		_, err = read(conn)
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+	}
+}
@@ -0,0 +1,271 @@
+package train
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"nns_back/log"
+	"nns_back/util"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// comments are sent while no monitor is sent, so that proxies don't close the idle stream
+	eventKeepAlivePeriod = 30 * time.Second
+	eventRetry           = 3 * time.Second
+
+	eventClose = "close"
+)
+
+// MonitorEventsHandler streams the monitors of the train as server-sent events,
+// for the clients which can't use MonitorWsHandler behind proxies breaking websockets.
+// Monitors are sent as messages of the JSON of the monitor, the same payload as the websocket.
+// Epochs and train logs are sent with the event id of the last epoch number and the last train log id sent,
+// such as "3:42", and every epoch and train log after the Last-Event-ID is sent on join,
+// so that a reconnecting client resumes without missing them.
+// An epoch corrected by a retry is sent again without an event id, even if it is before the Last-Event-ID.
+// A close event is sent when the train is over, after which the client should stop reconnecting.
+func (b *Bridge) MonitorEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectNo, err := strconv.Atoi(vars["projectNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+	trainNo, err := strconv.Atoi(vars["trainNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	cursor := eventCursor{epoch: -1, logId: -1}
+	if lastEventId := r.Header.Get("Last-Event-ID"); lastEventId != "" {
+		cursor, err = parseEventCursor(lastEventId)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, util.ErrBadRequest)
+			return
+		}
+	}
+	lastEpoch, lastLogId := cursor.epoch, cursor.logId
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("streaming is not supported by the response writer")
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	train, err := b.trainRepository.Find(WithTrainUserId(userId), WithProjectProjectNo(projectNo), WithTrainTrainNo(trainNo))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			util.WriteError(w, http.StatusNotFound, util.ErrNotFound)
+			return
+		}
+		log.Errorf("failed to Find(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	subscription, history, err := b.join(train.Id)
+	if err != nil {
+		log.Errorf("failed to join(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	defer b.Unsubscribe(subscription)
+
+	logs, err := b.trainLogRepository.FindAll(WithTrainTrainId(train.Id))
+	if err != nil {
+		log.Errorf("failed to FindAll(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Id < logs[j].Id
+	})
+
+	// the epochs before the cursor are sent before the reconnect
+	sent := make(map[int]Epoch, len(history))
+	for _, epoch := range history {
+		sent[epoch.Epoch] = epoch
+	}
+	history = epochsAfter(history, lastEpoch)
+	if lastLogId < 0 {
+		// the logs so far are not sent to the new client, like the websocket
+		if len(logs) > 0 {
+			cursor.logId = logs[len(logs)-1].Id
+		}
+		logs = nil
+	}
+	logs = logsAfter(logs, lastLogId)
+	if isTrainOver(train.Status) && len(history) == 0 && len(logs) == 0 {
+		// 204 stops the client from reconnecting to the train already sent
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry.Milliseconds())
+
+	for _, epoch := range history {
+		cursor.advance(&Monitor{Epoch: epoch})
+		if err := writeMonitorEvent(w, &Monitor{Epoch: epoch}, cursor.String()); err != nil {
+			return
+		}
+	}
+	sentLogs := make(map[int]bool, len(logs))
+	for _, trainLog := range logs {
+		cursor.advance(&Monitor{TrainLog: trainLog})
+		if err := writeMonitorEvent(w, &Monitor{TrainLog: trainLog}, cursor.String()); err != nil {
+			return
+		}
+		sentLogs[trainLog.Id] = true
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventKeepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case monitor, ok := <-subscription.Monitors():
+			if !ok {
+				code, reason := subscription.CloseReason()
+				data, _ := json.Marshal(map[string]interface{}{"code": code, "reason": reason})
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventClose, data)
+				flusher.Flush()
+				return
+			}
+
+			// epochs and logs sent between the subscription and the history are already sent,
+			// but the retried epochs of other values replace the sent ones
+			if monitor.Epoch.TrainId != 0 && isEpochSent(sent, monitor.Epoch) {
+				continue
+			}
+			if monitor.Epoch.TrainId == 0 && monitor.TrainLog.Id != 0 && (sentLogs[monitor.TrainLog.Id] || monitor.TrainLog.Id <= lastLogId) {
+				continue
+			}
+
+			id := ""
+			if cursor.advance(monitor) {
+				id = cursor.String()
+			}
+			if err := writeMonitorEvent(w, monitor, id); err != nil {
+				log.Debug(err)
+				return
+			}
+			if monitor.Epoch.TrainId != 0 {
+				sent[monitor.Epoch.Epoch] = monitor.Epoch
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// epochsAfter returns the epochs after the epoch number.
+func epochsAfter(epochs []Epoch, after int) []Epoch {
+	var newer []Epoch
+	for _, epoch := range epochs {
+		if epoch.Epoch > after {
+			newer = append(newer, epoch)
+		}
+	}
+	return newer
+}
+
+// logsAfter returns the train logs after the train log id.
+func logsAfter(logs []TrainLog, after int) []TrainLog {
+	var newer []TrainLog
+	for _, trainLog := range logs {
+		if trainLog.Id > after {
+			newer = append(newer, trainLog)
+		}
+	}
+	return newer
+}
+
+// eventCursor is the last epoch number and the last train log id sent in the event stream.
+// Negative is none.
+type eventCursor struct {
+	epoch int
+	logId int
+}
+
+// parseEventCursor parses the event id of "epoch:logId".
+// The event id of only the epoch number doesn't resume the train logs.
+func parseEventCursor(id string) (eventCursor, error) {
+	parts := strings.SplitN(id, ":", 2)
+
+	epoch, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return eventCursor{}, err
+	}
+	if len(parts) == 1 {
+		return eventCursor{epoch: epoch, logId: -1}, nil
+	}
+
+	logId, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return eventCursor{}, err
+	}
+	return eventCursor{epoch: epoch, logId: logId}, nil
+}
+
+func (c eventCursor) String() string {
+	return fmt.Sprintf("%d:%d", c.epoch, c.logId)
+}
+
+// advance moves the cursor past the epoch and the train log of the monitor, and reports whether it moved.
+func (c *eventCursor) advance(monitor *Monitor) bool {
+	advanced := false
+	if monitor.Epoch.TrainId != 0 && monitor.Epoch.Epoch > c.epoch {
+		c.epoch = monitor.Epoch.Epoch
+		advanced = true
+	}
+	if monitor.TrainLog.Id > c.logId {
+		c.logId = monitor.TrainLog.Id
+		advanced = true
+	}
+	return advanced
+}
+
+// writeMonitorEvent writes the monitor as a message event, with the id unless it is empty.
+func writeMonitorEvent(w http.ResponseWriter, monitor *Monitor, id string) error {
+	data, err := json.Marshal(monitor)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,163 @@
+package train
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/elixter/Querybuilder"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"nns_back/log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyTrainLogRepository finds the logs of a single train.
+type historyTrainLogRepository struct {
+	TrainLogRepository
+	logs []TrainLog
+}
+
+func (r *historyTrainLogRepository) FindAll(opts ...query.Option) ([]TrainLog, error) {
+	return r.logs, nil
+}
+
+type event struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event of the stream, skipping comments and the retry field.
+func readEvent(t *testing.T, reader *bufio.Reader) event {
+	var e event
+	for {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return e
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if e.data != "" {
+				return e
+			}
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestBridge_MonitorEventsHandler(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	trainRepository := &monitorTrainRepository{train: Train{Id: 3, Status: TrainStatusTrain}}
+	bridge := NewBridge(
+		&historyEpochRepository{epochs: []Epoch{{TrainId: 3, Epoch: 1}, {TrainId: 3, Epoch: 2}, {TrainId: 3, Epoch: 3}}},
+		trainRepository,
+		&historyTrainLogRepository{logs: []TrainLog{{Id: 5, TrainId: 3, Message: "log 5"}, {Id: 1, TrainId: 3}, {Id: 2, TrainId: 3}}},
+	)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/project/{projectNo:[0-9]+}/train/{trainNo:[0-9]+}/events", func(w http.ResponseWriter, r *http.Request) {
+		bridge.MonitorEventsHandler(w, r.WithContext(context.WithValue(r.Context(), "userId", int64(1))))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	get := func(lastEventId string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/project/1/train/1/events", nil)
+		if lastEventId != "" {
+			req.Header.Set("Last-Event-ID", lastEventId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return resp
+	}
+
+	// resumed after the second epoch and the second log
+	resp := get("2:2")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	e := readEvent(t, reader)
+	assert.Equal(t, "3:2", e.id)
+
+	var monitor Monitor
+	e = readEvent(t, reader)
+	assert.Equal(t, "3:5", e.id)
+	assert.NoError(t, json.Unmarshal([]byte(e.data), &monitor))
+	assert.Equal(t, "log 5", monitor.TrainLog.Message)
+
+	for bridge.Subscribers(3) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// already sent in the history
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 3}})
+	bridge.Send(3, &Monitor{TrainLog: TrainLog{Id: 5, TrainId: 3, Message: "log 5"}})
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 1}})
+	// the epoch before the cursor corrected by a retry is sent again
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 2, Acc: 0.5}})
+	bridge.Send(3, &Monitor{Epoch: Epoch{TrainId: 3, Epoch: 4}, TrainLog: TrainLog{Id: 6, TrainId: 3, Message: "epoch 4"}})
+	bridge.Send(3, &Monitor{TrainLog: TrainLog{TrainId: 3, Message: "log"}})
+	bridge.Close(3)
+
+	e = readEvent(t, reader)
+	assert.Equal(t, "", e.id)
+	monitor = Monitor{}
+	assert.NoError(t, json.Unmarshal([]byte(e.data), &monitor))
+	assert.Equal(t, 2, monitor.Epoch.Epoch)
+	assert.Equal(t, 0.5, monitor.Epoch.Acc)
+
+	e = readEvent(t, reader)
+	assert.Equal(t, "4:6", e.id)
+	monitor = Monitor{}
+	assert.NoError(t, json.Unmarshal([]byte(e.data), &monitor))
+	assert.Equal(t, 4, monitor.Epoch.Epoch)
+	assert.Equal(t, "epoch 4", monitor.TrainLog.Message)
+
+	e = readEvent(t, reader)
+	assert.Equal(t, "", e.id)
+	monitor = Monitor{}
+	assert.NoError(t, json.Unmarshal([]byte(e.data), &monitor))
+	assert.Equal(t, "log", monitor.TrainLog.Message)
+
+	e = readEvent(t, reader)
+	assert.Equal(t, eventClose, e.event)
+	assert.Contains(t, e.data, "train finished")
+
+	// nothing to resume of the finished train
+	trainRepository.train.Status = TrainStatusFinish
+	finished := get("3:5")
+	defer finished.Body.Close()
+	assert.Equal(t, http.StatusNoContent, finished.StatusCode)
+
+	// logs are not resumed by the event id of only the epoch
+	epochOnly := get("3")
+	defer epochOnly.Body.Close()
+	assert.Equal(t, http.StatusNoContent, epochOnly.StatusCode)
+
+	// the log not sent yet is resumed
+	unsent := get("3:4")
+	defer unsent.Body.Close()
+	assert.Equal(t, http.StatusOK, unsent.StatusCode)
+
+	for _, id := range []string{"x", "3:x"} {
+		invalid := get(id)
+		defer invalid.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, invalid.StatusCode)
+	}
+}
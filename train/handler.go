@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"github.com/davecgh/go-spew/spew"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/tidwall/gjson"
@@ -16,6 +15,7 @@ import (
 	"nns_back/externalAPI"
 	"nns_back/log"
 	"nns_back/model"
+	"nns_back/quota"
 	"nns_back/repository"
 	"nns_back/util"
 	"strconv"
@@ -32,10 +32,14 @@ type Handler struct {
 	ProjectRepository       repository.ProjectRepository
 	TrainRepository         TrainRepository
 	EpochRepository         EpochRepository
+	StepRepository          StepRepository
 	DatasetRepository       dataset.Repository
 	DatasetConfigRepository datasetConfig.Repository
 	TrainLogRepository      TrainLogRepository
+	QuotaRepository         quota.Repository
 	AwsS3Uploader           cloud.AwsS3Uploader
+	Scheduler               *Scheduler // notified when a train is queued
+	Bridge                  *Bridge    // monitors of cancelled trains are closed
 }
 
 type GetTrainHistoryListResponseBody struct {
@@ -51,13 +55,21 @@ type GetTrainHistoryListResponseHistoryBody struct {
 	ValAcc                     float64         `json:"valAcc"`
 	ValLoss                    float64         `json:"valLoss"`
 	Epochs                     int             `json:"epochs"`
+	MonitorMetric              string          `json:"monitorMetric"`
+	BestEpoch                  sql.NullInt64   `json:"bestEpoch"`
+	BestValue                  sql.NullFloat64 `json:"bestValue"` // value of the monitored metric at the best epoch
 	ResultUrl                  string          `json:"resultUrl"` // saved model url
 	TrainDatasetUrl            string          `json:"trainDatasetUrl"`
 	ValidDatasetUrl            sql.NullString  `json:"validDatasetUrl"`
+	TestDatasetUrl             sql.NullString  `json:"testDatasetUrl"`
+	DatasetId                  sql.NullInt64   `json:"datasetId"`
+	DatasetVersionId           sql.NullInt64   `json:"datasetVersionId"`
+	DatasetConfigId            sql.NullInt64   `json:"datasetConfigId"`
 	DatasetShuffle             bool            `json:"datasetShuffle"`
 	DatasetLabel               string          `json:"datasetLabel"`
 	DatasetNormalizationUsage  bool            `json:"datasetNormalizationUsage"`
 	DatasetNormalizationMethod sql.NullString  `json:"datasetNormalizationMethod"`
+	DatasetPipeline            json.RawMessage `json:"datasetPipeline"`
 	ModelContent               json.RawMessage `json:"modelContent"`
 	ModelConfig                json.RawMessage `json:"modelConfig"`
 	CreateTime                 time.Time       `json:"createTime"`
@@ -114,13 +126,21 @@ func (h *Handler) GetTrainHistoryListHandler(w http.ResponseWriter, r *http.Requ
 				ValAcc:                     history.ValAcc,
 				ValLoss:                    history.ValLoss,
 				Epochs:                     history.Epochs,
+				MonitorMetric:              history.MonitorMetric,
+				BestEpoch:                  history.BestEpoch,
+				BestValue:                  history.BestValue,
 				ResultUrl:                  history.ResultUrl, // saved model url
 				TrainDatasetUrl:            history.TrainConfig.TrainDatasetUrl,
 				ValidDatasetUrl:            history.TrainConfig.ValidDatasetUrl,
+				TestDatasetUrl:             history.TrainConfig.TestDatasetUrl,
+				DatasetId:                  history.TrainConfig.DatasetId,
+				DatasetVersionId:           history.TrainConfig.DatasetVersionId,
+				DatasetConfigId:            history.TrainConfig.DatasetConfigId,
 				DatasetShuffle:             history.TrainConfig.DatasetShuffle,
 				DatasetLabel:               history.TrainConfig.DatasetLabel,
 				DatasetNormalizationUsage:  history.TrainConfig.DatasetNormalizationUsage,
 				DatasetNormalizationMethod: history.TrainConfig.DatasetNormalizationMethod,
+				DatasetPipeline:            history.TrainConfig.DatasetPipeline.Json,
 				ModelContent:               history.TrainConfig.ModelContent,
 				ModelConfig:                history.TrainConfig.ModelConfig,
 				CreateTime:                 history.TrainConfig.CreateTime,
@@ -139,6 +159,8 @@ type trainHistoryEpochListResponseBodyBody struct {
 	ValAcc       float64 `json:"valAcc"`
 	ValLoss      float64 `json:"valLoss"`
 	LearningRate float64 `json:"learningRate"`
+
+	Metrics map[string]float64 `json:"metrics"` // metrics other than the above by name
 }
 
 type trainHistoryEpochListResponseBody struct {
@@ -193,19 +215,35 @@ func (h *Handler) GetTrainHistoryEpochsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	metrics, err := h.EpochRepository.FindAllMetrics(WithTrainUserId(userId), WithProjectProjectNo(projectNo), WithTrainTrainNo(trainNo))
+	if err != nil {
+		log.Errorf("failed to FindAllMetrics(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, newTrainHistoryEpochListResponseBody(epochs, metrics))
+}
+
+func newTrainHistoryEpochListResponseBody(epochs []Epoch, metrics []EpochMetric) trainHistoryEpochListResponseBody {
 	var resp trainHistoryEpochListResponseBody
-	for _, epoch := range epochs {
-		resp.Epochs = append(resp.Epochs, trainHistoryEpochListResponseBodyBody{
-			EpochNo:      epoch.Epoch,
-			Acc:          epoch.Acc,
-			Loss:         epoch.Loss,
-			ValAcc:       epoch.ValAcc,
-			ValLoss:      epoch.ValLoss,
-			LearningRate: epoch.LearningRate,
-		})
+	for _, epoch := range attachMetrics(epochs, metrics) {
+		resp.Epochs = append(resp.Epochs, newTrainHistoryEpochDto(epoch))
 	}
 
-	util.WriteJson(w, http.StatusOK, resp)
+	return resp
+}
+
+func newTrainHistoryEpochDto(epoch Epoch) trainHistoryEpochListResponseBodyBody {
+	return trainHistoryEpochListResponseBodyBody{
+		EpochNo:      epoch.Epoch,
+		Acc:          epoch.Acc,
+		Loss:         epoch.Loss,
+		ValAcc:       epoch.ValAcc,
+		ValLoss:      epoch.ValLoss,
+		LearningRate: epoch.LearningRate,
+		Metrics:      epoch.Metrics,
+	}
 }
 
 func (h *Handler) DeleteTrainHistoryHandler(w http.ResponseWriter, r *http.Request) {
@@ -339,7 +377,13 @@ func (h *Handler) UpdateTrainHistoryHandler(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusNoContent)
 }
 
-const _numberOfTrainingLimit = 1
+// _maxQueuedTrains is the number of trains a user can queue at once.
+const _maxQueuedTrains = 10
+
+type NewTrainResponseBody struct {
+	TrainNo int64  `json:"trainNo"`
+	Status  string `json:"status"`
+}
 
 func (h *Handler) NewTrainHandler(w http.ResponseWriter, r *http.Request) {
 	userId, ok := r.Context().Value("userId").(int64)
@@ -355,15 +399,15 @@ func (h *Handler) NewTrainHandler(w http.ResponseWriter, r *http.Request) {
 
 	projectNo, _ := strconv.Atoi(mux.Vars(r)["projectNo"])
 
-	// 지금은 각 유저는 한번에 하나의 학습만 가능
-	// 이 유저가 현재 학습중인지 확인
-	if trainable, err := isTrainable(h.TrainRepository, userId); err != nil {
-		log.Errorf("failed to CountCurrentTraining(): %v", err)
+	// new trains are queued and started by the scheduler when a training slot is free
+	if queueable, err := isQueueable(h.TrainRepository, userId); err != nil {
+		log.Errorf("failed to CountQueued(): %v", err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
-	} else if !trainable {
-		log.Warnw("current training count is maximum")
-		util.WriteError(w, http.StatusBadRequest, util.ErrAlreadyTrainingToTheMax)
+	} else if !queueable {
+		log.Warnw("queued train count is maximum",
+			"userId", userId)
+		util.WriteError(w, http.StatusBadRequest, util.ErrTrainQueueFull)
 		return
 	}
 
@@ -389,27 +433,53 @@ func (h *Handler) NewTrainHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := startNewTrain(h.DatasetRepository, h.TrainRepository, h.Fitter, project, datasetConfig, userId); err != nil {
+	// the dataset of the config may be deleted after the config is set
+	if !datasetConfig.Valid {
+		log.Warnw("invalid dataset config",
+			"datasetConfigId", datasetConfig.Id,
+			"invalidReason", datasetConfig.InvalidReason.String)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidDatasetConfig,
+			util.KeyValue("invalidReason", datasetConfig.InvalidReason.String))
+		return
+	}
+
+	// access to the dataset may be revoked after the config is set
+	usable, err := h.DatasetRepository.IsUsableBy(userId, datasetConfig.DatasetId)
+	if err != nil {
+		log.Errorf("failed to IsUsableBy(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+	if !usable {
+		log.Warnw("dataset is not usable",
+			"userId", userId,
+			"datasetId", datasetConfig.DatasetId)
+		util.WriteError(w, http.StatusForbidden, util.ErrDatasetNotUsable)
+		return
+	}
+
+	newTrain, err := queueNewTrain(h.DatasetRepository, h.TrainRepository, project, datasetConfig, userId)
+	if err != nil {
 		log.Error(err)
 		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	h.Scheduler.Notify()
+
+	util.WriteJson(w, http.StatusAccepted, NewTrainResponseBody{
+		TrainNo: newTrain.TrainNo,
+		Status:  newTrain.Status,
+	})
 }
 
-func isTrainable(trainRepository TrainRepository, userId int64) (bool, error) {
-	trainingCount, err := trainRepository.CountCurrentTraining(userId)
+func isQueueable(trainRepository TrainRepository, userId int64) (bool, error) {
+	queuedCount, err := trainRepository.CountQueued(userId)
 	if err != nil {
 		return false, err
 	}
 
-	result := false
-	if trainingCount < _numberOfTrainingLimit {
-		result = true
-	}
-
-	return result, nil
+	return queuedCount < _maxQueuedTrains, nil
 }
 
 func getDatasetConfigId(project model.Project) (int64, error) {
@@ -420,52 +490,63 @@ func getDatasetConfigId(project model.Project) (int64, error) {
 	return gjson.GetBytes(project.Config.Json, "dataset_config").Get("id").Int(), nil
 }
 
-func startNewTrain(datasetRepository dataset.Repository, trainRepository TrainRepository, fitter externalAPI.Fitter, project model.Project, config datasetConfig.DatasetConfig, userId int64) error {
+// queueNewTrain saves the new train as queued.
+// The train is requested to the fitter later by the Scheduler, which prepares the dataset of the train.
+func queueNewTrain(datasetRepository dataset.Repository, trainRepository TrainRepository, project model.Project, config datasetConfig.DatasetConfig, userId int64) (Train, error) {
 	nextTrainNo, err := trainRepository.FindNextTrainNo(userId)
 	if err != nil {
-		return errors.Wrapf(err, "FindNextTrainNo(userId: %d)", userId)
+		return Train{}, errors.Wrapf(err, "FindNextTrainNo(userId: %d)", userId)
 	}
 
-	dataset, err := datasetRepository.FindByID(config.DatasetId)
+	dataset, datasetVersionId, err := dataset.FindSnapshot(datasetRepository, config.DatasetId, config.DatasetVersionId)
 	if err != nil {
-		return errors.Wrapf(err, "FindByID(id: %d)", config.DatasetId)
+		return Train{}, errors.Wrapf(err, "FindSnapshot(id: %d, versionId: %v)", config.DatasetId, config.DatasetVersionId)
 	}
 
 	newTrain := createNewTrain(userId, nextTrainNo, project, dataset, config)
+	newTrain.TrainConfig.DatasetVersionId = datasetVersionId
+	newTrain.TrainConfig.DatasetPreparation, err = newDatasetPreparation(dataset, config)
+	if err != nil {
+		return Train{}, errors.Wrapf(err, "newDatasetPreparation(dataset.id: %d, config.id: %d)", dataset.ID, config.Id)
+	}
+
+	newTrain.Status = TrainStatusQueued
+	newTrain.QueueOrder = time.Now().UnixNano()
+	newTrain.CallbackSecret, err = newCallbackSecret()
+	if err != nil {
+		return Train{}, errors.Wrap(err, "newCallbackSecret()")
+	}
 	newTrain.Id, err = saveTrain(trainRepository, newTrain)
 	if err != nil {
-		return errors.Wrapf(err, "saveTrain(trainRepository: %v, newTrain: %v", trainRepository, newTrain)
+		return Train{}, errors.Wrapf(err, "saveTrain(userId: %d, trainNo: %d)", userId, newTrain.TrainNo)
 	}
 
-	payload := externalAPI.FitRequestBody{
-		TrainId: newTrain.Id,
-		UserId:  userId,
-		Config:  project.Config.Json,
-		Content: project.Content.Json,
+	return newTrain, nil
+}
+
+// newFitRequestBody makes the fit request of the train from the snapshot of its config.
+func newFitRequestBody(train Train, credential CallbackCredential) externalAPI.FitRequestBody {
+	return externalAPI.FitRequestBody{
+		TrainId: train.Id,
+		UserId:  train.UserId,
+		Config:  train.TrainConfig.ModelConfig,
+		Content: train.TrainConfig.ModelContent,
 		DataSet: externalAPI.FitRequestBodyDataSet{
-			TrainUri:      newTrain.TrainConfig.TrainDatasetUrl,
-			ValidationUri: newTrain.TrainConfig.ValidDatasetUrl.String,
-			Shuffle:       newTrain.TrainConfig.DatasetShuffle,
-			Label:         newTrain.TrainConfig.DatasetLabel,
+			TrainUri:      train.TrainConfig.TrainDatasetUrl,
+			ValidationUri: train.TrainConfig.ValidDatasetUrl.String,
+			TestUri:       train.TrainConfig.TestDatasetUrl.String,
+			Shuffle:       train.TrainConfig.DatasetShuffle,
+			Label:         train.TrainConfig.DatasetLabel,
 			Normalization: externalAPI.FitRequestBodyDataSetNormalization{
-				Usage:  newTrain.TrainConfig.DatasetNormalizationUsage,
-				Method: newTrain.TrainConfig.DatasetNormalizationMethod.String,
+				Usage:  train.TrainConfig.DatasetNormalizationUsage,
+				Method: train.TrainConfig.DatasetNormalizationMethod.String,
 			},
-			Kind: string(dataset.Kind),
+			Pipeline: train.TrainConfig.DatasetPipeline.Json,
+			Kind:     train.TrainConfig.DatasetKind,
 		},
-		ProjectNo: project.ProjectNo,
-	}
-
-	if err := fitRequest(fitter, payload); err != nil {
-		return errors.Wrapf(err, "fitRequest(fitter: %v, payload: %v", fitter, spew.Sdump(payload))
-	}
-
-	newTrain.Status = TrainStatusTrain
-	if err := trainRepository.Update(newTrain); err != nil {
-		return errors.Wrapf(err, "Update(train: %v)", newTrain)
+		ProjectNo:      credential.ProjectNo,
+		CallbackSecret: credential.Secret,
 	}
-
-	return nil
 }
 
 func createNewTrain(userId int64, nextTrainNo int64, project model.Project, dataset dataset.Dataset, config datasetConfig.DatasetConfig) Train {
@@ -475,6 +556,8 @@ func createNewTrain(userId int64, nextTrainNo int64, project model.Project, data
 		TrainNo:   nextTrainNo,
 		ProjectId: project.Id,
 		Status:    TrainStatusCreated,
+		// the best epoch is decided by the metric monitored while training
+		MonitorMetric: monitoredMetric(project.Config.Json),
 		//Acc:       0,
 		//Loss:      0,
 		//ValAcc:    0,
@@ -487,6 +570,8 @@ func createNewTrain(userId int64, nextTrainNo int64, project model.Project, data
 			//TrainId:         0,
 			TrainDatasetUrl:           dataset.OriginURL.String,
 			ValidDatasetUrl:           sql.NullString{},
+			DatasetId:                 sql.NullInt64{Int64: dataset.ID, Valid: true},
+			DatasetConfigId:           sql.NullInt64{Int64: config.Id, Valid: true},
 			DatasetShuffle:            config.Shuffle,
 			DatasetLabel:              config.Label,
 			DatasetNormalizationUsage: config.NormalizationMethod.Valid,
@@ -494,8 +579,10 @@ func createNewTrain(userId int64, nextTrainNo int64, project model.Project, data
 				String: config.NormalizationMethod.String,
 				Valid:  config.NormalizationMethod.Valid,
 			},
-			ModelContent: project.Content.Json,
-			ModelConfig:  project.Config.Json,
+			DatasetPipeline: config.Pipeline,
+			DatasetKind:     string(dataset.Kind),
+			ModelContent:    project.Content.Json,
+			ModelConfig:     project.Config.Json,
 		},
 	}
 
@@ -509,7 +596,7 @@ func saveTrain(trainRepository TrainRepository, train Train) (int64, error) {
 func fitRequest(fitter externalAPI.Fitter, payload externalAPI.FitRequestBody) error {
 	resp, err := fitter.Fit(payload)
 	if err != nil {
-		return errors.Wrapf(err, "Fit(payload: %v)", payload)
+		return errors.Wrapf(err, "Fit(trainId: %d)", payload.TrainId)
 	}
 	defer resp.Body.Close()
 
@@ -555,17 +642,6 @@ func (h *Handler) SaveTrainModelHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	url, err := h.AwsS3Uploader.UploadBytes(fBytes, cloud.WithContentType(trainModelContentType), cloud.WithExtension("zip"))
-	if err != nil {
-		log.Warnw(
-			"Failed to save model on S3 bucket",
-			"error code", util.ErrInternalServerError,
-			"error", err,
-		)
-		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
-		return
-	}
-
 	train, err := h.TrainRepository.Find(WithTrainTrainId(trainId))
 	if err != nil {
 		log.Warnw(
@@ -578,11 +654,30 @@ func (h *Handler) SaveTrainModelHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	train.ResultUrl = url
-	err = h.TrainRepository.Update(train)
+	// a saved model is replaced
+	err = quota.Reserve(h.QuotaRepository, train.UserId, int64(len(fBytes)), train.ResultSize, func() error {
+		url, err := h.AwsS3Uploader.UploadBytes(fBytes, cloud.WithContentType(trainModelContentType), cloud.WithExtension("zip"))
+		if err != nil {
+			return errors.Wrap(err, "failed to save model on S3 bucket")
+		}
+
+		train.ResultUrl = url
+		train.ResultSize = int64(len(fBytes))
+		return errors.Wrap(h.TrainRepository.Update(train), "failed to update train")
+	})
 	if err != nil {
-		log.Warnw(
-			"Can't update this record",
+		if err == quota.ErrQuotaExceeded {
+			log.Warnw(
+				"storage quota exceeded",
+				"error code", util.ErrStorageQuotaExceeded,
+				"userId", train.UserId,
+				"file size", len(fBytes),
+			)
+			util.WriteError(w, http.StatusForbidden, util.ErrStorageQuotaExceeded)
+			return
+		}
+		log.Errorw(
+			"failed to save model",
 			"error code", util.ErrInternalServerError,
 			"error", err,
 		)
@@ -642,7 +737,7 @@ func (h *Handler) GetTrainLogListHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	type trainLogListResponseBody struct {
-		TrainLogs	[]TrainLog `json:"trainLogs"`
+		TrainLogs []TrainLog `json:"trainLogs"`
 	}
 
 	var resp trainLogListResponseBody
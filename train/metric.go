@@ -0,0 +1,108 @@
+package train
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const (
+	_maxEpochMetrics = 100
+
+	// defaultMonitorMetric is monitored if neither early stop nor learning rate reduction monitors a metric.
+	defaultMonitorMetric = "loss"
+)
+
+var metricNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+// EpochMetric is a metric of an epoch other than the fixed metrics of Epoch,
+// such as precision, recall or mse.
+type EpochMetric struct {
+	TrainId int64   `db:"train_id"`
+	Epoch   int     `db:"epoch"`
+	Name    string  `db:"name"`
+	Value   float64 `db:"value"`
+}
+
+// validateMetrics validates the names and values of the metrics posted by the trainer.
+func validateMetrics(metrics map[string]float64) error {
+	if len(metrics) > _maxEpochMetrics {
+		return fmt.Errorf("too many metrics: %d, must be at most %d", len(metrics), _maxEpochMetrics)
+	}
+
+	for name, value := range metrics {
+		if !metricNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid metric name: %q", name)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("metric %q is not finite", name)
+		}
+	}
+
+	return nil
+}
+
+// attachMetrics sets the metrics of each epoch, an empty map if the epoch has no metrics.
+func attachMetrics(epochs []Epoch, metrics []EpochMetric) []Epoch {
+	metricsByEpoch := make(map[int]map[string]float64)
+	for _, metric := range metrics {
+		if metricsByEpoch[metric.Epoch] == nil {
+			metricsByEpoch[metric.Epoch] = make(map[string]float64)
+		}
+		metricsByEpoch[metric.Epoch][metric.Name] = metric.Value
+	}
+
+	for i, epoch := range epochs {
+		epochMetrics, ok := metricsByEpoch[epoch.Epoch]
+		if !ok {
+			epochMetrics = map[string]float64{}
+		}
+		epochs[i].Metrics = epochMetrics
+	}
+
+	return epochs
+}
+
+// Value returns the value of the metric of the epoch by the name reported by the trainer.
+func (e Epoch) Value(name string) (float64, bool) {
+	switch name {
+	case "accuracy":
+		return e.Acc, true
+	case "loss":
+		return e.Loss, true
+	case "val_accuracy":
+		return e.ValAcc, true
+	case "val_loss":
+		return e.ValLoss, true
+	case "lr":
+		return e.LearningRate, true
+	}
+
+	value, ok := e.Metrics[name]
+	return value, ok
+}
+
+// isMaximized reports whether the greater value of the metric is the better, like keras does in auto mode.
+func isMaximized(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range []string{"acc", "accuracy", "auc", "precision", "recall"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// monitoredMetric returns the metric the project config monitors to stop early or reduce learning rate,
+// which decides the best epoch of the train.
+func monitoredMetric(config []byte) string {
+	for _, path := range []string{"early_stop", "learning_rate_reduction"} {
+		option := gjson.GetBytes(config, path)
+		if option.Get("usage").Bool() && option.Get("monitor").String() != "" {
+			return option.Get("monitor").String()
+		}
+	}
+	return defaultMonitorMetric
+}
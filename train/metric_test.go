@@ -0,0 +1,122 @@
+package train
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"strings"
+	"testing"
+)
+
+func Test_validateMetrics(t *testing.T) {
+	tooMany := make(map[string]float64)
+	for i := 0; i <= _maxEpochMetrics; i++ {
+		tooMany["m"+strings.Repeat("_", i)] = 0
+	}
+
+	tests := []struct {
+		name    string
+		metrics map[string]float64
+		wantErr bool
+	}{
+		{name: "none", metrics: nil, wantErr: false},
+		{name: "valid", metrics: map[string]float64{"precision": 0.5, "val_top-5.acc": 0.9}, wantErr: false},
+		{name: "empty name", metrics: map[string]float64{"": 0.5}, wantErr: true},
+		{name: "invalid name", metrics: map[string]float64{"f1 score": 0.5}, wantErr: true},
+		{name: "too long name", metrics: map[string]float64{strings.Repeat("a", 65): 0.5}, wantErr: true},
+		{name: "nan", metrics: map[string]float64{"mse": math.NaN()}, wantErr: true},
+		{name: "inf", metrics: map[string]float64{"mse": math.Inf(1)}, wantErr: true},
+		{name: "too many", metrics: tooMany, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetrics(tt.metrics)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestEpoch_Value(t *testing.T) {
+	epoch := Epoch{Acc: 0.8, ValLoss: 0.3, Metrics: map[string]float64{"precision": 0.7}}
+
+	value, ok := epoch.Value("accuracy")
+	assert.True(t, ok)
+	assert.Equal(t, 0.8, value)
+
+	value, ok = epoch.Value("val_loss")
+	assert.True(t, ok)
+	assert.Equal(t, 0.3, value)
+
+	value, ok = epoch.Value("precision")
+	assert.True(t, ok)
+	assert.Equal(t, 0.7, value)
+
+	_, ok = epoch.Value("recall")
+	assert.False(t, ok)
+}
+
+func Test_isMaximized(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"loss":       false,
+		"val_loss":   false,
+		"mse":        false,
+		"accuracy":   true,
+		"val_acc":    true,
+		"val_AUC":    true,
+		"precision":  true,
+		"val_recall": true,
+		"lr":         false,
+	} {
+		assert.Equal(t, expected, isMaximized(name), name)
+	}
+}
+
+func Test_monitoredMetric(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			name:     "early stop",
+			config:   `{"early_stop": {"usage": true, "monitor": "val_accuracy"}, "learning_rate_reduction": {"usage": true, "monitor": "loss"}}`,
+			expected: "val_accuracy",
+		},
+		{
+			name:     "learning rate reduction",
+			config:   `{"early_stop": {"usage": false, "monitor": "val_accuracy"}, "learning_rate_reduction": {"usage": true, "monitor": "val_loss"}}`,
+			expected: "val_loss",
+		},
+		{
+			name:     "not monitored",
+			config:   `{"early_stop": {"usage": false}}`,
+			expected: defaultMonitorMetric,
+		},
+		{
+			name:     "no config",
+			config:   ``,
+			expected: defaultMonitorMetric,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, monitoredMetric([]byte(tt.config)))
+		})
+	}
+}
+
+func Test_newTrainHistoryEpochListResponseBody(t *testing.T) {
+	resp := newTrainHistoryEpochListResponseBody(
+		[]Epoch{{Epoch: 1, Loss: 0.5}, {Epoch: 2, Loss: 0.4}},
+		[]EpochMetric{
+			{Epoch: 1, Name: "precision", Value: 0.6},
+			{Epoch: 1, Name: "recall", Value: 0.7},
+		},
+	)
+
+	if assert.Len(t, resp.Epochs, 2) {
+		assert.Equal(t, map[string]float64{"precision": 0.6, "recall": 0.7}, resp.Epochs[0].Metrics)
+		assert.Equal(t, map[string]float64{}, resp.Epochs[1].Metrics)
+	}
+}
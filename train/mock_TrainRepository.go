@@ -2,13 +2,59 @@
 
 package train
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
 
 // MockTrainRepository is an autogenerated mock type for the TrainRepository type
 type MockTrainRepository struct {
 	mock.Mock
 }
 
+// AdvanceEpoch provides a mock function with given fields: epoch
+func (_m *MockTrainRepository) AdvanceEpoch(epoch Epoch) (bool, error) {
+	ret := _m.Called(epoch)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(Epoch) bool); ok {
+		r0 = rf(epoch)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(Epoch) error); ok {
+		r1 = rf(epoch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Cancel provides a mock function with given fields: trainId
+func (_m *MockTrainRepository) Cancel(trainId int64) (bool, error) {
+	ret := _m.Called(trainId)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(int64) bool); ok {
+		r0 = rf(trainId)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(trainId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CountCurrentTraining provides a mock function with given fields: userId
 func (_m *MockTrainRepository) CountCurrentTraining(userId int64) (int, error) {
 	ret := _m.Called(userId)
@@ -30,6 +76,50 @@ func (_m *MockTrainRepository) CountCurrentTraining(userId int64) (int, error) {
 	return r0, r1
 }
 
+// CountQueued provides a mock function with given fields: userId
+func (_m *MockTrainRepository) CountQueued(userId int64) (int, error) {
+	ret := _m.Called(userId)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(int64) int); ok {
+		r0 = rf(userId)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountTrainingByUser provides a mock function with given fields:
+func (_m *MockTrainRepository) CountTrainingByUser() (map[int64]int, error) {
+	ret := _m.Called()
+
+	var r0 map[int64]int
+	if rf, ok := ret.Get(0).(func() map[int64]int); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[int64]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: opts
 func (_m *MockTrainRepository) Delete(opts ...Option) error {
 	_va := make([]interface{}, len(opts))
@@ -50,6 +140,27 @@ func (_m *MockTrainRepository) Delete(opts ...Option) error {
 	return r0
 }
 
+// Dequeue provides a mock function with given fields: trainId
+func (_m *MockTrainRepository) Dequeue(trainId int64) (bool, error) {
+	ret := _m.Called(trainId)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(int64) bool); ok {
+		r0 = rf(trainId)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(trainId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Find provides a mock function with given fields: opts
 func (_m *MockTrainRepository) Find(opts ...Option) (Train, error) {
 	_va := make([]interface{}, len(opts))
@@ -106,6 +217,27 @@ func (_m *MockTrainRepository) FindAll(opts ...Option) ([]Train, error) {
 	return r0, r1
 }
 
+// FindCallbackCredential provides a mock function with given fields: trainId
+func (_m *MockTrainRepository) FindCallbackCredential(trainId int64) (CallbackCredential, error) {
+	ret := _m.Called(trainId)
+
+	var r0 CallbackCredential
+	if rf, ok := ret.Get(0).(func(int64) CallbackCredential); ok {
+		r0 = rf(trainId)
+	} else {
+		r0 = ret.Get(0).(CallbackCredential)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(trainId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindNextTrainNo provides a mock function with given fields: userId
 func (_m *MockTrainRepository) FindNextTrainNo(userId int64) (int64, error) {
 	ret := _m.Called(userId)
@@ -127,6 +259,73 @@ func (_m *MockTrainRepository) FindNextTrainNo(userId int64) (int64, error) {
 	return r0, r1
 }
 
+// FindQueue provides a mock function with given fields:
+func (_m *MockTrainRepository) FindQueue() ([]QueueEntry, error) {
+	ret := _m.Called()
+
+	var r0 []QueueEntry
+	if rf, ok := ret.Get(0).(func() []QueueEntry); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]QueueEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindStale provides a mock function with given fields: timeout
+func (_m *MockTrainRepository) FindStale(timeout time.Duration) ([]int64, error) {
+	ret := _m.Called(timeout)
+
+	var r0 []int64
+	if rf, ok := ret.Get(0).(func(time.Duration) []int64); ok {
+		r0 = rf(timeout)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Duration) error); ok {
+		r1 = rf(timeout)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Heartbeat provides a mock function with given fields: trainId
+func (_m *MockTrainRepository) Heartbeat(trainId int64) (bool, error) {
+	ret := _m.Called(trainId)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(int64) bool); ok {
+		r0 = rf(trainId)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(trainId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Insert provides a mock function with given fields: train
 func (_m *MockTrainRepository) Insert(train Train) (int64, error) {
 	ret := _m.Called(train)
@@ -148,6 +347,62 @@ func (_m *MockTrainRepository) Insert(train Train) (int64, error) {
 	return r0, r1
 }
 
+// MarkError provides a mock function with given fields: trainId, status
+func (_m *MockTrainRepository) MarkError(trainId int64, status string) (bool, error) {
+	ret := _m.Called(trainId, status)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(int64, string) bool); ok {
+		r0 = rf(trainId, status)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64, string) error); ok {
+		r1 = rf(trainId, status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReorderQueue provides a mock function with given fields: userId, trainNos
+func (_m *MockTrainRepository) ReorderQueue(userId int64, trainNos []int64) error {
+	ret := _m.Called(userId, trainNos)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int64, []int64) error); ok {
+		r0 = rf(userId, trainNos)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ResetHeartbeats provides a mock function with given fields:
+func (_m *MockTrainRepository) ResetHeartbeats() (int64, error) {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Update provides a mock function with given fields: train, opts
 func (_m *MockTrainRepository) Update(train Train, opts ...Option) error {
 	_va := make([]interface{}, len(opts))
@@ -168,3 +423,38 @@ func (_m *MockTrainRepository) Update(train Train, opts ...Option) error {
 
 	return r0
 }
+
+// UpdateBest provides a mock function with given fields: trainId, epoch, value, maximize
+func (_m *MockTrainRepository) UpdateBest(trainId int64, epoch int, value float64, maximize bool) (bool, error) {
+	ret := _m.Called(trainId, epoch, value, maximize)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(int64, int, float64, bool) bool); ok {
+		r0 = rf(trainId, epoch, value, maximize)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int64, int, float64, bool) error); ok {
+		r1 = rf(trainId, epoch, value, maximize)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateDatasetUrls provides a mock function with given fields: trainConfig
+func (_m *MockTrainRepository) UpdateDatasetUrls(trainConfig TrainConfig) error {
+	ret := _m.Called(trainConfig)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(TrainConfig) error); ok {
+		r0 = rf(trainConfig)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
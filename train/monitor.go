@@ -3,5 +3,6 @@ package train
 type Monitor struct {
 	Epoch    Epoch
 	TrainLog TrainLog
+	Step     *Step `json:",omitempty"` // throttled latest step of the epoch in progress
 }
 
@@ -0,0 +1,164 @@
+package train
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"nns_back/cloud"
+	"nns_back/dataset"
+	"nns_back/datasetConfig"
+	"nns_back/quota"
+	"nns_back/util"
+)
+
+// DatasetPreparation is the snapshot of the dataset config to derive the dataset files of the train,
+// such as the normalized images and the splits.
+// The files are derived when the train is dequeued, so the trains cancelled in the queue derive no files.
+type DatasetPreparation struct {
+	Url   string               `json:"url"` // parsed dataset the files are derived from
+	Image *dataset.ImageOption `json:"image,omitempty"`
+	Split *dataset.SplitOption `json:"split,omitempty"`
+}
+
+// newDatasetPreparation makes the preparation of the parsed dataset by the dataset config.
+// It returns a null json if there is nothing to prepare.
+func newDatasetPreparation(ds dataset.Dataset, config datasetConfig.DatasetConfig) (util.NullJson, error) {
+	preparation := DatasetPreparation{Url: ds.URL.String}
+
+	if config.ImageUsage && ds.Kind == dataset.KindImages {
+		option := config.ImageOption()
+		preparation.Image = &option
+	}
+
+	if config.SplitUsage {
+		label := config.Label
+		if ds.Kind == dataset.KindImages {
+			// parsed image dataset is "url,label" csv
+			label = "label"
+		}
+		preparation.Split = &dataset.SplitOption{
+			TrainRatio: config.SplitTrainRatio,
+			ValidRatio: config.SplitValidRatio,
+			TestRatio:  config.SplitTestRatio,
+			Stratify:   config.SplitStratify,
+			Label:      label,
+			Seed:       config.SplitSeed,
+		}
+	}
+
+	if preparation.Image == nil && preparation.Split == nil {
+		return util.NullJson{}, nil
+	}
+
+	data, err := json.Marshal(preparation)
+	if err != nil {
+		return util.NullJson{}, err
+	}
+	return util.NullJson{Json: data, Valid: true}, nil
+}
+
+// datasetSplitter splits the parsed dataset at url of the dataset version and returns urls of each split.
+type datasetSplitter func(versionId sql.NullInt64, url string, option dataset.SplitOption) (dataset.SplitResult, error)
+
+// imageNormalizer normalizes every image of the parsed image dataset at url of the dataset version
+// and returns url of the normalized dataset.
+type imageNormalizer func(versionId sql.NullInt64, url string, option dataset.ImageOption) (string, error)
+
+// prepareTrainDataset derives the dataset files of the train config by its preparation,
+// and returns the train config pointing to them.
+// The images are normalized before the split, so the splits are of the normalized dataset.
+func prepareTrainDataset(splitter datasetSplitter, normalizer imageNormalizer, trainConfig TrainConfig) (TrainConfig, error) {
+	if !trainConfig.DatasetPreparation.Valid {
+		return trainConfig, nil
+	}
+
+	var preparation DatasetPreparation
+	if err := json.Unmarshal(trainConfig.DatasetPreparation.Json, &preparation); err != nil {
+		return trainConfig, errors.Wrap(err, "failed to unmarshal dataset preparation")
+	}
+
+	url := preparation.Url
+	if preparation.Image != nil {
+		normalized, err := normalizer(trainConfig.DatasetVersionId, url, *preparation.Image)
+		if err != nil {
+			return trainConfig, errors.Wrap(err, "failed to normalize images")
+		}
+		url = normalized
+		trainConfig.TrainDatasetUrl = url
+	}
+
+	if preparation.Split != nil {
+		result, err := splitter(trainConfig.DatasetVersionId, url, *preparation.Split)
+		if err != nil {
+			return trainConfig, errors.Wrap(err, "failed to split dataset")
+		}
+		trainConfig.TrainDatasetUrl = result.TrainUrl
+		trainConfig.ValidDatasetUrl = sql.NullString{String: result.ValidUrl, Valid: result.ValidUrl != ""}
+		trainConfig.TestDatasetUrl = sql.NullString{String: result.TestUrl, Valid: result.TestUrl != ""}
+	}
+
+	return trainConfig, nil
+}
+
+// DatasetPreparer derives the dataset files of the dequeued trains.
+type DatasetPreparer struct {
+	DatasetRepository dataset.Repository
+	DatasetStorage    cloud.AwsS3Uploader // storage for derived dataset files
+	QuotaRepository   quota.Repository
+	HttpClient        *http.Client
+}
+
+// Prepare derives the dataset files of the train and returns the train config pointing to them.
+// The files are objects of the dataset version derived for the user of the train, deleted with the version,
+// and each of them is stored within the storage quota of the user.
+func (p *DatasetPreparer) Prepare(train Train) (TrainConfig, error) {
+	storage := quotaUploader{
+		AwsS3Uploader:   p.DatasetStorage,
+		quotaRepository: p.QuotaRepository,
+		userId:          train.UserId,
+	}
+	splitter := func(versionId sql.NullInt64, url string, option dataset.SplitOption) (dataset.SplitResult, error) {
+		return dataset.SplitToStorage(p.HttpClient, dataset.NewVersionUploader(storage, p.DatasetRepository, versionId, train.UserId), url, option)
+	}
+	normalizer := func(versionId sql.NullInt64, url string, option dataset.ImageOption) (string, error) {
+		return dataset.NormalizeVersionToStorage(p.DatasetRepository, p.HttpClient, storage, versionId, train.UserId, url, option)
+	}
+
+	return prepareTrainDataset(splitter, normalizer, train.TrainConfig)
+}
+
+// quotaUploader stores each file within the storage quota of the user.
+// The version object referencing the file is inserted while the file is stored,
+// so the file is counted in the usage of the user when the reservation is released.
+type quotaUploader struct {
+	cloud.AwsS3Uploader
+	quotaRepository quota.Repository
+	userId          int64
+}
+
+func (u quotaUploader) UploadFile(file multipart.File, options ...cloud.Option) (url string, err error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	err = quota.Reserve(u.quotaRepository, u.userId, size, 0, func() error {
+		url, err = u.AwsS3Uploader.UploadFile(file, options...)
+		return err
+	})
+	return url, err
+}
+
+func (u quotaUploader) UploadBytes(file []byte, options ...cloud.Option) (url string, err error) {
+	err = quota.Reserve(u.quotaRepository, u.userId, int64(len(file)), 0, func() error {
+		url, err = u.AwsS3Uploader.UploadBytes(file, options...)
+		return err
+	})
+	return url, err
+}
@@ -0,0 +1,136 @@
+package train
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"nns_back/cloud"
+	"nns_back/dataset"
+	"nns_back/datasetConfig"
+	"nns_back/quota"
+	"testing"
+)
+
+func Test_newDatasetPreparation(t *testing.T) {
+	assert := assert.New(t)
+
+	ds := dataset.Dataset{
+		URL:  sql.NullString{String: "parsed.csv", Valid: true},
+		Kind: dataset.KindImages,
+	}
+	config := datasetConfig.DatasetConfig{
+		Label:           "digit",
+		SplitUsage:      true,
+		SplitTrainRatio: 0.8,
+		SplitValidRatio: 0.2,
+		SplitStratify:   true,
+		SplitSeed:       3,
+		ImageUsage:      true,
+		ImageWidth:      28,
+		ImageHeight:     28,
+		ImageColorMode:  string(dataset.ColorModeGrayscale),
+	}
+
+	preparation, err := newDatasetPreparation(ds, config)
+	assert.NoError(err)
+	assert.JSONEq(`{
+	"url": "parsed.csv",
+	"image": {"Width": 28, "Height": 28, "ColorMode": "GRAYSCALE", "Format": ""},
+	"split": {"TrainRatio": 0.8, "ValidRatio": 0.2, "TestRatio": 0, "Stratify": true, "Label": "label", "Seed": 3}
+}`, string(preparation.Json))
+
+	// images of other kinds of datasets are not normalized
+	ds.Kind = dataset.KindText
+	config.SplitUsage = false
+	preparation, err = newDatasetPreparation(ds, config)
+	assert.NoError(err)
+	assert.False(preparation.Valid)
+}
+
+func Test_prepareTrainDataset(t *testing.T) {
+	assert := assert.New(t)
+
+	versionId := sql.NullInt64{Int64: 2, Valid: true}
+	normalizer := func(id sql.NullInt64, url string, option dataset.ImageOption) (string, error) {
+		assert.Equal(versionId, id)
+		assert.Equal("parsed.csv", url)
+		assert.Equal(dataset.ImageOption{Width: 28, Height: 28, ColorMode: dataset.ColorModeGrayscale}, option)
+		return "normalized.csv", nil
+	}
+	splitter := func(id sql.NullInt64, url string, option dataset.SplitOption) (dataset.SplitResult, error) {
+		assert.Equal(versionId, id)
+		assert.Equal("normalized.csv", url)
+		assert.Equal("label", option.Label)
+		return dataset.SplitResult{TrainUrl: "train.csv", ValidUrl: "valid.csv"}, nil
+	}
+
+	ds := dataset.Dataset{
+		URL:  sql.NullString{String: "parsed.csv", Valid: true},
+		Kind: dataset.KindImages,
+	}
+	config := datasetConfig.DatasetConfig{
+		SplitUsage:      true,
+		SplitTrainRatio: 0.8,
+		SplitValidRatio: 0.2,
+		ImageUsage:      true,
+		ImageWidth:      28,
+		ImageHeight:     28,
+		ImageColorMode:  string(dataset.ColorModeGrayscale),
+	}
+	preparation, err := newDatasetPreparation(ds, config)
+	assert.NoError(err)
+
+	trainConfig, err := prepareTrainDataset(splitter, normalizer, TrainConfig{
+		TrainDatasetUrl:    "origin.zip",
+		DatasetVersionId:   versionId,
+		DatasetPreparation: preparation,
+	})
+	assert.NoError(err)
+	assert.Equal("train.csv", trainConfig.TrainDatasetUrl)
+	assert.Equal(sql.NullString{String: "valid.csv", Valid: true}, trainConfig.ValidDatasetUrl)
+	assert.False(trainConfig.TestDatasetUrl.Valid)
+
+	// nothing to prepare
+	trainConfig, err = prepareTrainDataset(splitter, normalizer, TrainConfig{TrainDatasetUrl: "origin.csv"})
+	assert.NoError(err)
+	assert.Equal("origin.csv", trainConfig.TrainDatasetUrl)
+}
+
+type preparerQuotaRepository struct {
+	quota.Repository
+	usage quota.Usage
+}
+
+func (r *preparerQuotaRepository) ReserveUsage(userId int64, size int64, fn func(usage quota.Usage) error) (int64, error) {
+	if err := fn(r.usage); err != nil {
+		return 0, err
+	}
+	r.usage.Reserved += size
+	return size, nil
+}
+
+func (r *preparerQuotaRepository) ReleaseUsage(reservationId int64) error {
+	r.usage.Reserved -= reservationId
+	// the stored file is counted as derived
+	r.usage.Derived += reservationId
+	return nil
+}
+
+func Test_quotaUploader(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := &cloud.MockAwsS3Uploader{}
+	storage.On("UploadBytes", mock.Anything, mock.Anything).Return("split.csv", nil)
+	repo := &preparerQuotaRepository{usage: quota.Usage{Datasets: 90, Quota: 100}}
+	uploader := quotaUploader{AwsS3Uploader: storage, quotaRepository: repo, userId: 1}
+
+	url, err := uploader.UploadBytes(make([]byte, 6), cloud.WithExtension("csv"))
+	assert.NoError(err)
+	assert.Equal("split.csv", url)
+	assert.Equal(int64(6), repo.usage.Derived)
+
+	// the derived files exceeding the quota are not stored
+	_, err = uploader.UploadBytes(make([]byte, 5), cloud.WithExtension("csv"))
+	assert.Equal(quota.ErrQuotaExceeded, err)
+	storage.AssertNumberOfCalls(t, "UploadBytes", 1)
+}
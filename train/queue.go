@@ -0,0 +1,116 @@
+package train
+
+import (
+	"errors"
+	"net/http"
+	"nns_back/log"
+	"nns_back/util"
+)
+
+type GetTrainQueueResponseBody struct {
+	Queue []TrainQueueDto `json:"queue"`
+}
+
+type TrainQueueDto struct {
+	TrainNo   int64  `json:"trainNo"`
+	ProjectNo int    `json:"projectNo"`
+	Name      string `json:"name"`
+	Position  int    `json:"position"` // 1-based position in the queue of every user
+}
+
+// GetTrainQueueHandler lists the queued trains of the user in dispatch order.
+func (h *Handler) GetTrainQueueHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	h.writeTrainQueue(w, userId)
+}
+
+func (h *Handler) writeTrainQueue(w http.ResponseWriter, userId int64) {
+	queue, err := h.TrainRepository.FindQueue()
+	if err != nil {
+		log.Errorf("failed to FindQueue(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, newGetTrainQueueResponseBody(queue, userId))
+}
+
+// newGetTrainQueueResponseBody lists the trains of the user with their positions in the whole queue.
+// Trains of other users are not exposed.
+func newGetTrainQueueResponseBody(queue []QueueEntry, userId int64) GetTrainQueueResponseBody {
+	resp := GetTrainQueueResponseBody{
+		Queue: make([]TrainQueueDto, 0),
+	}
+
+	for i, entry := range queue {
+		if entry.UserId != userId {
+			continue
+		}
+
+		resp.Queue = append(resp.Queue, TrainQueueDto{
+			TrainNo:   entry.TrainNo,
+			ProjectNo: entry.ProjectNo,
+			Name:      entry.Name,
+			Position:  i + 1,
+		})
+	}
+
+	return resp
+}
+
+type ReorderTrainQueueRequestBody struct {
+	TrainNos []int64 `json:"trainNos"` // every queued train of the user in the new order
+}
+
+func (r ReorderTrainQueueRequestBody) Validate() error {
+	if len(r.TrainNos) == 0 {
+		return errors.New("trainNos is required")
+	}
+	return nil
+}
+
+// ReorderTrainQueueHandler changes the order of the queued trains of the user.
+// Only the trains of the user are reordered among themselves,
+// so the positions of trains of other users don't change.
+func (h *Handler) ReorderTrainQueueHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	var reqBody ReorderTrainQueueRequestBody
+	if err := util.BindJson(r.Body, &reqBody); err != nil {
+		log.Warnw("failed to bind json",
+			"error code", util.ErrInvalidRequestBody,
+			"error", err)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	if err := h.TrainRepository.ReorderQueue(userId, reqBody.TrainNos); err != nil {
+		if err == ErrQueueChanged {
+			log.Warnw("trainNos are not the queued trains",
+				"userId", userId,
+				"trainNos", reqBody.TrainNos)
+			util.WriteError(w, http.StatusConflict, util.ErrTrainQueueChanged)
+			return
+		}
+		log.Errorf("failed to ReorderQueue(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	h.writeTrainQueue(w, userId)
+}
@@ -0,0 +1,276 @@
+package train
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"nns_back/externalAPI"
+	"nns_back/log"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultUserSlots        = 1
+	DefaultGlobalSlots      = 4
+	DefaultScheduleInterval = 10 * time.Second
+)
+
+// ErrQueueChanged is returned when the queued trains to reorder are not the queued trains of the user,
+// such as one of them is dispatched or cancelled meanwhile.
+var ErrQueueChanged = errors.New("queued trains changed")
+
+// QueueEntry is a queued train.
+type QueueEntry struct {
+	TrainId    int64  `db:"id"`
+	UserId     int64  `db:"user_id"`
+	TrainNo    int64  `db:"train_no"`
+	ProjectNo  int    `db:"project_no"`
+	Name       string `db:"name"`
+	QueueOrder int64  `db:"queue_order"`
+}
+
+// Scheduler dispatches queued trains to the fitter in queue order,
+// while the number of running trains of the user and of every user are less than the slots.
+//
+// Running trains are counted from the database, so only one scheduler should run at once.
+type Scheduler struct {
+	trainRepository    TrainRepository
+	trainLogRepository TrainLogRepository
+	fitter             externalAPI.Fitter
+	preparer           *DatasetPreparer
+
+	userSlots   int
+	globalSlots int
+	interval    time.Duration
+
+	wake chan struct{}
+}
+
+func NewScheduler(trainRepository TrainRepository, trainLogRepository TrainLogRepository, fitter externalAPI.Fitter, preparer *DatasetPreparer, userSlots, globalSlots int) *Scheduler {
+	return &Scheduler{
+		trainRepository:    trainRepository,
+		trainLogRepository: trainLogRepository,
+		fitter:             fitter,
+		preparer:           preparer,
+		userSlots:          userSlots,
+		globalSlots:        globalSlots,
+		interval:           DefaultScheduleInterval,
+		wake:               make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes up the scheduler to dispatch without waiting for the next interval,
+// such as a train is queued.
+func (s *Scheduler) Notify() {
+	if s == nil {
+		return
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// already notified
+	}
+}
+
+// Run dispatches queued trains every interval and whenever notified. It never returns.
+// Finished trains free their slots without notifying, so they are picked up by the interval.
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.dispatch(); err != nil {
+			log.Errorw("failed to dispatch queued trains",
+				"error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Scheduler) dispatch() error {
+	queue, err := s.trainRepository.FindQueue()
+	if err != nil {
+		return errors.Wrap(err, "FindQueue()")
+	}
+	if len(queue) == 0 {
+		return nil
+	}
+
+	running, err := s.trainRepository.CountTrainingByUser()
+	if err != nil {
+		return errors.Wrap(err, "CountTrainingByUser()")
+	}
+
+	for _, entry := range selectDispatchable(queue, running, s.userSlots, s.globalSlots) {
+		dequeued, err := s.trainRepository.Dequeue(entry.TrainId)
+		if err != nil {
+			log.Errorw("failed to dequeue train",
+				"error", err,
+				"trainId", entry.TrainId)
+			continue
+		}
+		if !dequeued {
+			// cancelled meanwhile
+			continue
+		}
+
+		// the dataset of a train may take long to prepare, which must not delay the trains of other users
+		go func(entry QueueEntry) {
+			if err := s.start(entry); err != nil {
+				log.Errorw("failed to start queued train",
+					"error", err,
+					"trainId", entry.TrainId)
+			}
+		}(entry)
+	}
+
+	return nil
+}
+
+// selectDispatchable returns the queued trains to dispatch in queue order.
+// running is the number of running trains of each user, which is not modified.
+func selectDispatchable(queue []QueueEntry, running map[int64]int, userSlots, globalSlots int) []QueueEntry {
+	counts := make(map[int64]int, len(running))
+	total := 0
+	for userId, count := range running {
+		counts[userId] = count
+		total += count
+	}
+
+	dispatchable := make([]QueueEntry, 0)
+	for _, entry := range queue {
+		if total >= globalSlots {
+			break
+		}
+		// trains of other users are not blocked by the user without free slots
+		if counts[entry.UserId] >= userSlots {
+			continue
+		}
+
+		dispatchable = append(dispatchable, entry)
+		counts[entry.UserId]++
+		total++
+	}
+
+	return dispatchable
+}
+
+// start prepares the dataset of the dequeued train and requests the fitter to train it.
+// The train is marked as TRAIN before so that cancelling it from the queue can not race with the request.
+// If anything fails before the train is requested the train is marked as ERR, so that it does not hold the slot.
+func (s *Scheduler) start(entry QueueEntry) error {
+	train, err := s.trainRepository.Find(WithTrainTrainId(entry.TrainId))
+	if err != nil {
+		// the dequeued train must not hold the training slot
+		s.fail(Train{Id: entry.TrainId}, fmt.Sprintf("failed to start training: %v", err))
+		return errors.Wrapf(err, "Find(trainId: %d)", entry.TrainId)
+	}
+
+	if s.preparer != nil {
+		train.TrainConfig, err = s.preparer.Prepare(train)
+		if err != nil {
+			s.fail(train, fmt.Sprintf("failed to prepare dataset: %v", err))
+			return err
+		}
+		if err := s.trainRepository.UpdateDatasetUrls(train.TrainConfig); err != nil {
+			s.fail(train, fmt.Sprintf("failed to prepare dataset: %v", err))
+			return errors.Wrapf(err, "UpdateDatasetUrls(trainId: %d)", train.Id)
+		}
+	}
+
+	// preparing is not the silence of the trainer, so the trainer has a full timeout from the request,
+	// and the train cancelled or timed out while preparing is not requested
+	training, err := s.trainRepository.Heartbeat(train.Id)
+	if err != nil {
+		s.fail(train, fmt.Sprintf("failed to start training: %v", err))
+		return errors.Wrapf(err, "Heartbeat(trainId: %d)", train.Id)
+	}
+	if !training {
+		return nil
+	}
+
+	credential, err := s.trainRepository.FindCallbackCredential(entry.TrainId)
+	if err != nil {
+		s.fail(train, fmt.Sprintf("failed to start training: %v", err))
+		return errors.Wrapf(err, "FindCallbackCredential(trainId: %d)", entry.TrainId)
+	}
+
+	if err := fitRequest(s.fitter, newFitRequestBody(train, credential)); err != nil {
+		s.fail(train, fmt.Sprintf("failed to request training: %v", err))
+		return err
+	}
+
+	// the train cancelled while requesting is not known to the trainer at the time of cancel
+	if current, err := s.trainRepository.Find(WithTrainTrainId(train.Id)); err == nil && current.Status == TrainStatusCancelled {
+		if err := cancelRequest(s.fitter, current); err != nil {
+			return errors.Wrapf(err, "cancelRequest(trainId: %d)", train.Id)
+		}
+		return nil
+	}
+
+	log.Infow("queued train started",
+		"trainId", train.Id,
+		"userId", train.UserId)
+
+	return nil
+}
+
+// fail marks the starting train as ERR with the message, unless it is cancelled meanwhile.
+func (s *Scheduler) fail(train Train, message string) {
+	marked, err := s.trainRepository.MarkError(train.Id, TrainStatusTrain)
+	if err != nil {
+		log.Errorw("failed to update train status",
+			"error", err,
+			"trainId", train.Id)
+	} else if !marked {
+		return
+	}
+
+	_, err = s.trainLogRepository.Insert(TrainLog{
+		TrainId:    train.Id,
+		Message:    message,
+		StatusCode: 500,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	})
+	if err != nil {
+		log.Errorw("failed to insert train log",
+			"error", err,
+			"trainId", train.Id)
+	}
+}
+
+// reorderQueue reassigns the queue orders of the queued trains of a user to the order of trainNos,
+// and returns the new queue order of each train no.
+// The set of orders is kept, so that trains of other users keep their positions.
+func reorderQueue(queue []QueueEntry, trainNos []int64) (map[int64]int64, error) {
+	if len(queue) != len(trainNos) {
+		return nil, ErrQueueChanged
+	}
+
+	queued := make(map[int64]bool, len(queue))
+	orders := make([]int64, 0, len(queue))
+	for _, entry := range queue {
+		queued[entry.TrainNo] = true
+		orders = append(orders, entry.QueueOrder)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i] < orders[j] })
+
+	reordered := make(map[int64]int64, len(trainNos))
+	for i, trainNo := range trainNos {
+		if !queued[trainNo] {
+			return nil, ErrQueueChanged
+		}
+		if _, ok := reordered[trainNo]; ok {
+			return nil, ErrQueueChanged
+		}
+		reordered[trainNo] = orders[i]
+	}
+
+	return reordered, nil
+}
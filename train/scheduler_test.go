@@ -0,0 +1,122 @@
+package train
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_selectDispatchable(t *testing.T) {
+	queue := []QueueEntry{
+		{TrainId: 1, UserId: 1},
+		{TrainId: 2, UserId: 1},
+		{TrainId: 3, UserId: 2},
+		{TrainId: 4, UserId: 3},
+		{TrainId: 5, UserId: 2},
+	}
+
+	tests := []struct {
+		name        string
+		running     map[int64]int
+		userSlots   int
+		globalSlots int
+		expected    []int64
+	}{
+		{
+			name:        "one slot per user",
+			running:     map[int64]int{},
+			userSlots:   1,
+			globalSlots: 10,
+			expected:    []int64{1, 3, 4},
+		},
+		{
+			name:        "user without free slot is skipped",
+			running:     map[int64]int{1: 1},
+			userSlots:   1,
+			globalSlots: 10,
+			expected:    []int64{3, 4},
+		},
+		{
+			name:        "global slots",
+			running:     map[int64]int{3: 1},
+			userSlots:   2,
+			globalSlots: 3,
+			expected:    []int64{1, 2},
+		},
+		{
+			name:        "no free slot",
+			running:     map[int64]int{4: 2},
+			userSlots:   1,
+			globalSlots: 2,
+			expected:    []int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trainIds := make([]int64, 0)
+			for _, entry := range selectDispatchable(queue, tt.running, tt.userSlots, tt.globalSlots) {
+				trainIds = append(trainIds, entry.TrainId)
+			}
+			assert.Equal(t, tt.expected, trainIds)
+		})
+	}
+}
+
+func Test_reorderQueue(t *testing.T) {
+	queue := []QueueEntry{
+		{TrainNo: 1, QueueOrder: 10},
+		{TrainNo: 2, QueueOrder: 30},
+		{TrainNo: 3, QueueOrder: 50},
+	}
+
+	tests := []struct {
+		name     string
+		trainNos []int64
+		expected map[int64]int64
+		err      error
+	}{
+		{
+			name:     "reversed",
+			trainNos: []int64{3, 2, 1},
+			expected: map[int64]int64{3: 10, 2: 30, 1: 50},
+		},
+		{
+			name:     "missing train",
+			trainNos: []int64{3, 1},
+			err:      ErrQueueChanged,
+		},
+		{
+			name:     "not queued train",
+			trainNos: []int64{3, 2, 4},
+			err:      ErrQueueChanged,
+		},
+		{
+			name:     "duplicated train",
+			trainNos: []int64{3, 3, 1},
+			err:      ErrQueueChanged,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders, err := reorderQueue(queue, tt.trainNos)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.expected, orders)
+		})
+	}
+}
+
+func Test_newGetTrainQueueResponseBody(t *testing.T) {
+	queue := []QueueEntry{
+		{TrainId: 1, UserId: 2, TrainNo: 5},
+		{TrainId: 2, UserId: 1, TrainNo: 7, ProjectNo: 3},
+		{TrainId: 3, UserId: 2, TrainNo: 6},
+		{TrainId: 4, UserId: 1, TrainNo: 8, ProjectNo: 3},
+	}
+
+	resp := newGetTrainQueueResponseBody(queue, 1)
+	assert.Equal(t, []TrainQueueDto{
+		{TrainNo: 7, ProjectNo: 3, Position: 2},
+		{TrainNo: 8, ProjectNo: 3, Position: 4},
+	}, resp.Queue)
+}
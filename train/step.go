@@ -0,0 +1,330 @@
+package train
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elixter/Querybuilder"
+	"github.com/gorilla/mux"
+	"net/http"
+	"nns_back/log"
+	"nns_back/util"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultStepForwardInterval = time.Second
+	DefaultStepRetention       = 7 * 24 * time.Hour
+
+	stepPurgeInterval = time.Hour
+
+	// steps of an epoch are downsampled into at most this number of samples,
+	// so that the stored steps of an epoch don't grow with the dataset
+	_maxStepSamplesPerEpoch = 100
+	_maxStepsPerRequest     = 1000
+)
+
+// Step is the metrics of a batch posted by the trainer.
+type Step struct {
+	Epoch   int                `json:"epoch"`
+	Step    int                `json:"step"` // batch number in the epoch from 0
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// StepSample is the latest step of a bucket of steps in an epoch.
+type StepSample struct {
+	TrainId int64           `db:"train_id"`
+	Epoch   int             `db:"epoch"`
+	Sample  int             `db:"sample"` // bucket of the steps
+	Step    int             `db:"step"`
+	Metrics json.RawMessage `db:"metrics"`
+}
+
+type NewStepsRequestBody struct {
+	Epoch         int    `json:"epoch"`
+	StepsPerEpoch int    `json:"steps_per_epoch"`
+	Steps         []Step `json:"steps"`
+}
+
+func (b NewStepsRequestBody) Validate() error {
+	if b.Epoch < 0 {
+		return errors.New("epoch must not be negative")
+	}
+	if b.StepsPerEpoch <= 0 {
+		return errors.New("steps_per_epoch is required")
+	}
+	if len(b.Steps) == 0 || len(b.Steps) > _maxStepsPerRequest {
+		return fmt.Errorf("steps must be 1 to %d", _maxStepsPerRequest)
+	}
+
+	for _, step := range b.Steps {
+		if step.Step < 0 || step.Step >= b.StepsPerEpoch {
+			return fmt.Errorf("step %d is out of the epoch", step.Step)
+		}
+		if len(step.Metrics) == 0 {
+			return fmt.Errorf("step %d has no metrics", step.Step)
+		}
+		if err := validateMetrics(step.Metrics); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downsampleSteps buckets the steps of the epoch into _maxStepSamplesPerEpoch buckets
+// and keeps the latest step of each bucket.
+func downsampleSteps(trainId int64, body NewStepsRequestBody) ([]StepSample, error) {
+	stride := (body.StepsPerEpoch + _maxStepSamplesPerEpoch - 1) / _maxStepSamplesPerEpoch
+
+	latest := make(map[int]Step)
+	for _, step := range body.Steps {
+		sample := step.Step / stride
+		if last, ok := latest[sample]; !ok || step.Step >= last.Step {
+			latest[sample] = step
+		}
+	}
+
+	samples := make([]StepSample, 0, len(latest))
+	for sample, step := range latest {
+		metrics, err := json.Marshal(step.Metrics)
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, StepSample{
+			TrainId: trainId,
+			Epoch:   body.Epoch,
+			Sample:  sample,
+			Step:    step.Step,
+			Metrics: metrics,
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Sample < samples[j].Sample
+	})
+
+	return samples, nil
+}
+
+// StepRecorder saves the downsampled steps posted by the trainer
+// and forwards them to the monitors at most once in the forward interval for each train.
+// The latest throttled step of a train is forwarded when its epoch arrives or the next epoch starts,
+// so that the monitors see the last step of every epoch.
+type StepRecorder struct {
+	stepRepository StepRepository
+	bridge         *Bridge
+
+	forwardInterval time.Duration
+	retention       time.Duration
+	now             func() time.Time
+
+	mu        sync.Mutex
+	forwarded map[int64]time.Time // last forwarded time by train id
+	pending   map[int64]Step      // latest throttled step by train id
+}
+
+// NewStepRecorder returns the StepRecorder forwarding to the bridge,
+// which flushes the throttled step of the train to the monitors when an epoch arrives.
+func NewStepRecorder(stepRepository StepRepository, bridge *Bridge, forwardInterval time.Duration, retention time.Duration) *StepRecorder {
+	recorder := &StepRecorder{
+		stepRepository:  stepRepository,
+		bridge:          bridge,
+		forwardInterval: forwardInterval,
+		retention:       retention,
+		now:             time.Now,
+		forwarded:       make(map[int64]time.Time),
+		pending:         make(map[int64]Step),
+	}
+	bridge.steps = recorder
+
+	return recorder
+}
+
+// NewStepsHandler saves the steps posted by the trainer, which may be batched in a request.
+func (s *StepRecorder) NewStepsHandler(w http.ResponseWriter, r *http.Request) {
+	tid, err := strconv.ParseInt(mux.Vars(r)["trainId"], 10, 64)
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	var body NewStepsRequestBody
+	if err := util.BindJson(r.Body, &body); err != nil {
+		log.Warnw("failed to bind steps",
+			"error", err,
+			"trainId", tid)
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidRequestBody)
+		return
+	}
+
+	samples, err := downsampleSteps(tid, body)
+	if err != nil {
+		log.Errorf("failed to downsampleSteps(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	if err := s.stepRepository.Upsert(samples); err != nil {
+		log.Errorf("failed to Upsert(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	latest := body.Steps[0]
+	for _, step := range body.Steps {
+		if step.Step > latest.Step {
+			latest = step
+		}
+	}
+	latest.Epoch = body.Epoch
+	s.forward(tid, latest)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forward sends the step to the monitors unless a step of the train is forwarded within the forward interval,
+// in which case the step is kept to be flushed later.
+// The throttled step of the previous epoch is sent first regardless of the interval, since it is the last step of the epoch.
+func (s *StepRecorder) forward(tid int64, step Step) bool {
+	s.mu.Lock()
+	trailing, ok := s.pending[tid]
+	hasTrailing := ok && trailing.Epoch < step.Epoch
+
+	now := s.now()
+	if last, ok := s.forwarded[tid]; ok && now.Sub(last) < s.forwardInterval {
+		s.pending[tid] = step
+		s.mu.Unlock()
+
+		if hasTrailing {
+			s.bridge.Send(tid, &Monitor{Step: &trailing})
+		}
+		return false
+	}
+	s.forwarded[tid] = now
+	delete(s.pending, tid)
+	s.mu.Unlock()
+
+	if hasTrailing {
+		s.bridge.Send(tid, &Monitor{Step: &trailing})
+	}
+	s.bridge.Send(tid, &Monitor{Step: &step})
+	return true
+}
+
+// flush sends the throttled step of the train to the monitors if it is of the epoch or before,
+// so that the last step of the epoch is sent before the epoch.
+func (s *StepRecorder) flush(tid int64, epoch int) bool {
+	s.mu.Lock()
+	step, ok := s.pending[tid]
+	if !ok || step.Epoch > epoch {
+		s.mu.Unlock()
+		return false
+	}
+	delete(s.pending, tid)
+	s.mu.Unlock()
+
+	s.bridge.Send(tid, &Monitor{Step: &step})
+	return true
+}
+
+// Run deletes the expired steps at every purge interval. It never returns.
+func (s *StepRecorder) Run() {
+	ticker := time.NewTicker(stepPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.purge(); err != nil {
+			log.Errorw("failed to purge steps",
+				"error", err)
+		}
+	}
+}
+
+func (s *StepRecorder) purge() error {
+	deleted, err := s.stepRepository.DeleteExpired(s.retention)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for tid, last := range s.forwarded {
+		if s.now().Sub(last) > stepPurgeInterval {
+			delete(s.forwarded, tid)
+			delete(s.pending, tid)
+		}
+	}
+	s.mu.Unlock()
+
+	log.Infow("steps purged",
+		"deleted", deleted)
+
+	return nil
+}
+
+type trainHistoryStepListResponseBody struct {
+	Steps []trainHistoryStepListResponseBodyBody `json:"steps"`
+}
+
+type trainHistoryStepListResponseBodyBody struct {
+	EpochNo int             `json:"epochNo"`
+	Step    int             `json:"step"`
+	Metrics json.RawMessage `json:"metrics"`
+}
+
+// GetTrainHistoryStepsHandler lists the downsampled steps of the train, of an epoch if the epoch is queried.
+func (h *Handler) GetTrainHistoryStepsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int64)
+	if !ok {
+		log.Errorw("failed to conversion interface to int64",
+			"error code", util.ErrInternalServerError,
+			"context value", r.Context().Value("userId"))
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectNo, err := strconv.Atoi(vars["projectNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+	trainNo, err := strconv.Atoi(vars["trainNo"])
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, util.ErrInvalidPathParm)
+		return
+	}
+
+	opts := []query.Option{WithTrainUserId(userId), WithProjectProjectNo(projectNo), WithTrainTrainNo(trainNo)}
+	if value := r.URL.Query().Get("epoch"); value != "" {
+		epoch, err := strconv.Atoi(value)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, util.ErrInvalidQueryParm)
+			return
+		}
+		opts = append(opts, WithStepEpoch(epoch))
+	}
+
+	samples, err := h.StepRepository.FindAll(opts...)
+	if err != nil {
+		log.Errorf("failed to FindAll(): %v", err)
+		util.WriteError(w, http.StatusInternalServerError, util.ErrInternalServerError)
+		return
+	}
+
+	resp := trainHistoryStepListResponseBody{
+		Steps: make([]trainHistoryStepListResponseBodyBody, 0, len(samples)),
+	}
+	for _, sample := range samples {
+		resp.Steps = append(resp.Steps, trainHistoryStepListResponseBodyBody{
+			EpochNo: sample.Epoch,
+			Step:    sample.Step,
+			Metrics: sample.Metrics,
+		})
+	}
+
+	util.WriteJson(w, http.StatusOK, resp)
+}
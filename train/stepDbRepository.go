@@ -0,0 +1,75 @@
+package train
+
+import (
+	"github.com/elixter/Querybuilder"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const defaultSelectStepSampleColumns = "sm.train_id, sm.epoch, sm.sample, sm.step, sm.metrics"
+
+func WithStepEpoch(epoch int) query.Option {
+	return query.OptionFunc(func(b *query.Builder) {
+		b.AddWhere("sm.epoch = ?", epoch)
+	})
+}
+
+type StepDbRepository struct {
+	DB *sqlx.DB
+}
+
+func (sdr *StepDbRepository) Upsert(samples []StepSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	// metrics must be updated before step, which is compared with the updated step otherwise
+	_, err := sdr.DB.NamedExec(`
+INSERT INTO step_metric (train_id, epoch, sample, step, metrics)
+VALUES (:train_id, :epoch, :sample, :step, :metrics)
+ON DUPLICATE KEY UPDATE metrics = IF(VALUES(step) >= step, VALUES(metrics), metrics),
+                        step    = GREATEST(step, VALUES(step));
+`, samples)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sdr *StepDbRepository) FindAll(opts ...query.Option) ([]StepSample, error) {
+	builder := query.ApplyQueryOptions(opts...)
+	builder.AddSelect(defaultSelectStepSampleColumns).
+		AddFrom("step_metric sm").
+		AddJoin("train t ON sm.train_id = t.id").
+		AddJoin("project p ON t.project_id = p.id").
+		AddOrder("sm.epoch, sm.sample")
+
+	err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []StepSample
+	err = sdr.DB.Select(&samples, builder.QueryString, builder.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+func (sdr *StepDbRepository) DeleteExpired(retention time.Duration) (int64, error) {
+	result, err := sdr.DB.Exec(`
+DELETE sm
+FROM step_metric sm
+         JOIN train t ON sm.train_id = t.id
+WHERE t.status <> ?
+  AND sm.update_time < NOW() - INTERVAL ? SECOND;
+`, TrainStatusTrain, int64(retention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
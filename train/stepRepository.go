@@ -0,0 +1,14 @@
+package train
+
+import (
+	"github.com/elixter/Querybuilder"
+	"time"
+)
+
+type StepRepository interface {
+	// Upsert inserts the samples or replaces the samples of the same bucket by the later steps.
+	Upsert(samples []StepSample) error
+	FindAll(opts ...query.Option) ([]StepSample, error)
+	// DeleteExpired deletes the samples of the trains not training, which are not updated for the retention.
+	DeleteExpired(retention time.Duration) (int64, error)
+}
@@ -0,0 +1,129 @@
+package train
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewStepsRequestBody_Validate(t *testing.T) {
+	metrics := map[string]float64{"loss": 0.5}
+
+	tests := []struct {
+		name    string
+		body    NewStepsRequestBody
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			body:    NewStepsRequestBody{Epoch: 1, StepsPerEpoch: 10, Steps: []Step{{Step: 0, Metrics: metrics}, {Step: 9, Metrics: metrics}}},
+			wantErr: false,
+		},
+		{
+			name:    "negative epoch",
+			body:    NewStepsRequestBody{Epoch: -1, StepsPerEpoch: 10, Steps: []Step{{Step: 1, Metrics: metrics}}},
+			wantErr: true,
+		},
+		{
+			name:    "no steps per epoch",
+			body:    NewStepsRequestBody{Epoch: 1, Steps: []Step{{Step: 1, Metrics: metrics}}},
+			wantErr: true,
+		},
+		{
+			name:    "no steps",
+			body:    NewStepsRequestBody{Epoch: 1, StepsPerEpoch: 10},
+			wantErr: true,
+		},
+		{
+			name:    "step out of epoch",
+			body:    NewStepsRequestBody{Epoch: 1, StepsPerEpoch: 10, Steps: []Step{{Step: 10, Metrics: metrics}}},
+			wantErr: true,
+		},
+		{
+			name:    "negative step",
+			body:    NewStepsRequestBody{Epoch: 1, StepsPerEpoch: 10, Steps: []Step{{Step: -1, Metrics: metrics}}},
+			wantErr: true,
+		},
+		{
+			name:    "no metrics",
+			body:    NewStepsRequestBody{Epoch: 1, StepsPerEpoch: 10, Steps: []Step{{Step: 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid metric",
+			body:    NewStepsRequestBody{Epoch: 1, StepsPerEpoch: 10, Steps: []Step{{Step: 1, Metrics: map[string]float64{"f1 score": 0.5}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.body.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func Test_downsampleSteps(t *testing.T) {
+	// 1000 steps are bucketed by 10 steps
+	var steps []Step
+	for step := 0; step < 25; step++ {
+		steps = append(steps, Step{Step: step, Metrics: map[string]float64{"loss": float64(step)}})
+	}
+
+	samples, err := downsampleSteps(3, NewStepsRequestBody{Epoch: 2, StepsPerEpoch: 1000, Steps: steps})
+	assert.NoError(t, err)
+
+	if assert.Len(t, samples, 3) {
+		for i, expected := range []int{9, 19, 24} {
+			assert.Equal(t, int64(3), samples[i].TrainId)
+			assert.Equal(t, 2, samples[i].Epoch)
+			assert.Equal(t, i, samples[i].Sample)
+			assert.Equal(t, expected, samples[i].Step)
+
+			var metrics map[string]float64
+			assert.NoError(t, json.Unmarshal(samples[i].Metrics, &metrics))
+			assert.Equal(t, float64(expected), metrics["loss"])
+		}
+	}
+
+	// every step is kept if the epoch has fewer steps than samples
+	samples, err = downsampleSteps(3, NewStepsRequestBody{Epoch: 2, StepsPerEpoch: 5, Steps: steps[:5]})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 5)
+}
+
+func TestStepRecorder_forward(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	bridge := NewBridge(nil, nil, nil)
+	subscription := bridge.Subscribe(1)
+	recorder := NewStepRecorder(nil, bridge, time.Second, DefaultStepRetention)
+	recorder.now = func() time.Time { return now }
+
+	assert.True(t, recorder.forward(1, Step{Step: 1}))
+	assert.False(t, recorder.forward(1, Step{Step: 2}))
+	// throttled for each train
+	assert.True(t, recorder.forward(2, Step{Step: 1}))
+
+	now = now.Add(time.Second)
+	assert.True(t, recorder.forward(1, Step{Step: 3}))
+
+	// the throttled step is flushed when its epoch arrives
+	assert.False(t, recorder.forward(1, Step{Step: 4}))
+	assert.True(t, recorder.flush(1, 0))
+	assert.False(t, recorder.flush(1, 0))
+
+	// the throttled step of the previous epoch is forwarded when the next epoch starts
+	assert.False(t, recorder.forward(1, Step{Step: 5}))
+	assert.False(t, recorder.forward(1, Step{Epoch: 1, Step: 0}))
+	// the step of the next epoch is not flushed by the previous epoch
+	assert.False(t, recorder.flush(1, 0))
+
+	var forwarded []int
+	for len(subscription.Monitors()) > 0 {
+		monitor := <-subscription.Monitors()
+		forwarded = append(forwarded, monitor.Step.Step)
+	}
+	assert.Equal(t, []int{1, 3, 4, 5}, forwarded)
+}
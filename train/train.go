@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"nns_back/util"
 	"time"
 )
 
@@ -14,18 +15,26 @@ type History struct {
 }
 
 type Train struct {
-	Id        int64   `db:"id" json:"id"`
-	UserId    int64   `db:"user_id" json:"user_id"`
-	TrainNo   int64   `db:"train_no" json:"train_no"`
-	ProjectId int64   `db:"project_id" json:"project_id"`
-	Status    string  `db:"status" json:"status"`
-	Acc       float64 `db:"acc" json:"acc"`
-	Loss      float64 `db:"loss" json:"loss"`
-	ValAcc    float64 `db:"val_acc" json:"val_acc"`
-	ValLoss   float64 `db:"val_loss" json:"val_loss"`
-	Epochs    int     `db:"epochs" json:"epochs"`
-	Name      string  `db:"name" json:"name"`
-	ResultUrl string  `db:"result_url" json:"result_url"` // saved model url
+	Id         int64   `db:"id" json:"id"`
+	UserId     int64   `db:"user_id" json:"user_id"`
+	TrainNo    int64   `db:"train_no" json:"train_no"`
+	ProjectId  int64   `db:"project_id" json:"project_id"`
+	Status     string  `db:"status" json:"status"`
+	Acc        float64 `db:"acc" json:"acc"`
+	Loss       float64 `db:"loss" json:"loss"`
+	ValAcc     float64 `db:"val_acc" json:"val_acc"`
+	ValLoss    float64 `db:"val_loss" json:"val_loss"`
+	Epochs     int     `db:"epochs" json:"epochs"`
+	Name       string  `db:"name" json:"name"`
+	ResultUrl  string  `db:"result_url" json:"result_url"`   // saved model url
+	ResultSize int64   `db:"result_size" json:"result_size"` // saved model size in bytes
+	QueueOrder int64   `db:"queue_order" json:"queue_order"` // queued trains are dispatched in ascending order
+
+	MonitorMetric string          `db:"monitor_metric" json:"monitor_metric"` // metric deciding the best epoch
+	BestEpoch     sql.NullInt64   `db:"best_epoch" json:"best_epoch"`
+	BestValue     sql.NullFloat64 `db:"best_value" json:"best_value"` // value of the monitored metric at the best epoch
+
+	CallbackSecret string `db:"callback_secret" json:"-"` // signing key of the callbacks from the trainer, only set to insert
 
 	TrainConfig TrainConfig
 }
@@ -35,10 +44,17 @@ type TrainConfig struct {
 	TrainId                    int64           `db:"train_id" json:"train_id"`
 	TrainDatasetUrl            string          `db:"train_dataset_url" json:"train_dataset_url"`
 	ValidDatasetUrl            sql.NullString  `db:"valid_dataset_url" json:"valid_dataset_url"`
+	TestDatasetUrl             sql.NullString  `db:"test_dataset_url" json:"test_dataset_url"`
+	DatasetId                  sql.NullInt64   `db:"dataset_id" json:"dataset_id"`                 // null for trains before lineage was recorded
+	DatasetVersionId           sql.NullInt64   `db:"dataset_version_id" json:"dataset_version_id"` // exact dataset version used
+	DatasetConfigId            sql.NullInt64   `db:"dataset_config_id" json:"dataset_config_id"`   // dataset config the train started with
 	DatasetShuffle             bool            `db:"dataset_shuffle" json:"dataset_shuffle"`
 	DatasetLabel               string          `db:"dataset_label" json:"dataset_label"`
 	DatasetNormalizationUsage  bool            `db:"dataset_normalization_usage" json:"dataset_normalization_usage"`
 	DatasetNormalizationMethod sql.NullString  `db:"dataset_normalization_method" json:"dataset_normalization_method"`
+	DatasetPipeline            util.NullJson   `db:"dataset_pipeline" json:"dataset_pipeline"` // preprocessing pipeline of the dataset config
+	DatasetKind                string          `db:"dataset_kind" json:"dataset_kind"`
+	DatasetPreparation         util.NullJson   `db:"dataset_preparation" json:"dataset_preparation"` // derived when the train is dequeued
 	ModelContent               json.RawMessage `db:"model_content" json:"model_content"`
 	ModelConfig                json.RawMessage `db:"model_config" json:"model_config"`
 	CreateTime                 time.Time       `db:"create_time" json:"create_time"`
@@ -46,11 +62,13 @@ type TrainConfig struct {
 }
 
 const (
-	TrainStatusFinish  = "FIN"
-	TrainStatusTrain   = "TRAIN"
-	TrainStatusError   = "ERR"
-	TrainStatusDelete  = "DEL"
-	TrainStatusCreated = "CREATED"
+	TrainStatusFinish    = "FIN"
+	TrainStatusTrain     = "TRAIN"
+	TrainStatusError     = "ERR"
+	TrainStatusDelete    = "DEL"
+	TrainStatusCreated   = "CREATED"
+	TrainStatusQueued    = "QUEUED" // waiting for a training slot
+	TrainStatusCancelled = "CANCELLED"
 )
 
 func (t *Train) Bind(r *http.Request) error {
@@ -66,11 +84,3 @@ func (t *Train) Bind(r *http.Request) error {
 
 	return nil
 }
-
-func (t *Train) Update(e Epoch) {
-	t.Acc = e.Acc
-	t.Loss = e.Loss
-	t.ValAcc = e.ValAcc
-	t.ValLoss = e.ValLoss
-	t.Epochs = e.Epoch
-}
@@ -5,6 +5,7 @@ import (
 	"github.com/elixter/Querybuilder"
 	"github.com/jmoiron/sqlx"
 	"nns_back/log"
+	"time"
 )
 
 const (
@@ -19,15 +20,27 @@ const (
 								   t.name,
 								   t.epochs,
 								   t.result_url,
+								   t.result_size,
+								   t.queue_order,
+								   t.monitor_metric,
+								   t.best_epoch,
+								   t.best_value,
 								   t.status,
 								   tc.id,
 								   tc.train_id,
 								   tc.train_dataset_url,
 								   tc.valid_dataset_url,
+								   tc.test_dataset_url,
+								   tc.dataset_id,
+								   tc.dataset_version_id,
+								   tc.dataset_config_id,
 								   tc.dataset_shuffle,
 								   tc.dataset_label,
 								   tc.dataset_normalization_usage,
 								   tc.dataset_normalization_method,
+								   tc.dataset_pipeline,
+								   tc.dataset_kind,
+								   tc.dataset_preparation,
 								   tc.model_content,
 								   tc.model_config,
 								   tc.create_time,
@@ -70,6 +83,12 @@ func WithTrainTrainNo(trainNo int) query.Option {
 	})
 }
 
+func WithTrainStatus(status string) query.Option {
+	return query.OptionFunc(func(b *query.Builder) {
+		b.AddWhere("t.status = ?", status)
+	})
+}
+
 func WithTrainUserId(userId int64) query.Option {
 	return query.OptionFunc(func(b *query.Builder) {
 		b.AddWhere("t.user_id = ?", userId)
@@ -136,7 +155,11 @@ INSERT INTO train (user_id,
                    name,
                    epochs,
                    result_url,
-                   status)
+                   result_size,
+                   status,
+                   queue_order,
+                   callback_secret,
+                   monitor_metric)
 VALUES (:user_id,
         :train_no,
         :project_id,
@@ -147,7 +170,11 @@ VALUES (:user_id,
         :name,
         :epochs,
         :result_url,
-        :status);
+        :result_size,
+        :status,
+        :queue_order,
+        :callback_secret,
+        :monitor_metric);
 `, train)
 	if err != nil {
 		return 0, err
@@ -164,19 +191,33 @@ VALUES (:user_id,
 INSERT INTO train_config (train_id,
                           train_dataset_url,
                           valid_dataset_url,
+                          test_dataset_url,
+                          dataset_id,
+                          dataset_version_id,
+                          dataset_config_id,
                           dataset_shuffle,
                           dataset_label,
                           dataset_normalization_usage,
                           dataset_normalization_method,
+                          dataset_pipeline,
+                          dataset_kind,
+                          dataset_preparation,
                           model_content,
                           model_config)
 VALUES (:train_id,
         :train_dataset_url,
         :valid_dataset_url,
+        :test_dataset_url,
+        :dataset_id,
+        :dataset_version_id,
+        :dataset_config_id,
         :dataset_shuffle,
         :dataset_label,
         :dataset_normalization_usage,
         :dataset_normalization_method,
+        :dataset_pipeline,
+        :dataset_kind,
+        :dataset_preparation,
         :model_content,
         :model_config);
 `, train.TrainConfig)
@@ -213,7 +254,7 @@ func (tdb *TrainDbRepository) Update(train Train, opts ...query.Option) error {
 	builder := query.ApplyQueryOptions(opts...)
 	builder.AddUpdate(
 		"train",
-		"status = ?, acc = ?, loss = ?, val_acc = ?, val_loss = ?, epochs = ?, name = ?, result_url = ?",
+		"status = ?, acc = ?, loss = ?, val_acc = ?, val_loss = ?, epochs = ?, name = ?, result_url = ?, result_size = ?",
 		train.Status,
 		train.Acc,
 		train.Loss,
@@ -222,6 +263,7 @@ func (tdb *TrainDbRepository) Update(train Train, opts ...query.Option) error {
 		train.Epochs,
 		train.Name,
 		train.ResultUrl,
+		train.ResultSize,
 	).AddWhere("id = ?", train.Id)
 
 	err := builder.Build()
@@ -265,15 +307,27 @@ func (tdb *TrainDbRepository) Find(opts ...query.Option) (Train, error) {
 		&train.Name,
 		&train.Epochs,
 		&train.ResultUrl,
+		&train.ResultSize,
+		&train.QueueOrder,
+		&train.MonitorMetric,
+		&train.BestEpoch,
+		&train.BestValue,
 		&train.Status,
 		&train.TrainConfig.Id,
 		&train.TrainConfig.TrainId,
 		&train.TrainConfig.TrainDatasetUrl,
 		&train.TrainConfig.ValidDatasetUrl,
+		&train.TrainConfig.TestDatasetUrl,
+		&train.TrainConfig.DatasetId,
+		&train.TrainConfig.DatasetVersionId,
+		&train.TrainConfig.DatasetConfigId,
 		&train.TrainConfig.DatasetShuffle,
 		&train.TrainConfig.DatasetLabel,
 		&train.TrainConfig.DatasetNormalizationUsage,
 		&train.TrainConfig.DatasetNormalizationMethod,
+		&train.TrainConfig.DatasetPipeline,
+		&train.TrainConfig.DatasetKind,
+		&train.TrainConfig.DatasetPreparation,
 		&train.TrainConfig.ModelContent,
 		&train.TrainConfig.ModelConfig,
 		&train.TrainConfig.CreateTime,
@@ -320,15 +374,27 @@ func (tdb *TrainDbRepository) FindAll(opts ...query.Option) ([]Train, error) {
 			&train.Name,
 			&train.Epochs,
 			&train.ResultUrl,
+			&train.ResultSize,
+			&train.QueueOrder,
+			&train.MonitorMetric,
+			&train.BestEpoch,
+			&train.BestValue,
 			&train.Status,
 			&train.TrainConfig.Id,
 			&train.TrainConfig.TrainId,
 			&train.TrainConfig.TrainDatasetUrl,
 			&train.TrainConfig.ValidDatasetUrl,
+			&train.TrainConfig.TestDatasetUrl,
+			&train.TrainConfig.DatasetId,
+			&train.TrainConfig.DatasetVersionId,
+			&train.TrainConfig.DatasetConfigId,
 			&train.TrainConfig.DatasetShuffle,
 			&train.TrainConfig.DatasetLabel,
 			&train.TrainConfig.DatasetNormalizationUsage,
 			&train.TrainConfig.DatasetNormalizationMethod,
+			&train.TrainConfig.DatasetPipeline,
+			&train.TrainConfig.DatasetKind,
+			&train.TrainConfig.DatasetPreparation,
 			&train.TrainConfig.ModelContent,
 			&train.TrainConfig.ModelConfig,
 			&train.TrainConfig.CreateTime,
@@ -353,3 +419,307 @@ WHERE t.user_id = ? AND t.status = 'TRAIN';
 
 	return count, err
 }
+
+func (tdb *TrainDbRepository) CountQueued(userId int64) (int, error) {
+	var count int
+	err := tdb.DB.QueryRowx(`
+SELECT COUNT(*)
+FROM train t
+WHERE t.user_id = ?
+  AND t.status = 'QUEUED';
+`, userId).Scan(&count)
+
+	return count, err
+}
+
+func (tdb *TrainDbRepository) CountTrainingByUser() (map[int64]int, error) {
+	rows, err := tdb.DB.Queryx(`
+SELECT t.user_id, COUNT(*)
+FROM train t
+WHERE t.status = 'TRAIN'
+GROUP BY t.user_id;
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var userId int64
+		var count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return nil, err
+		}
+		counts[userId] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (tdb *TrainDbRepository) FindQueue() ([]QueueEntry, error) {
+	queue := make([]QueueEntry, 0)
+	err := tdb.DB.Select(&queue, `
+SELECT t.id,
+       t.user_id,
+       t.train_no,
+       p.project_no,
+       COALESCE(t.name, '') AS name,
+       t.queue_order
+FROM train t
+         JOIN project p ON t.project_id = p.id
+WHERE t.status = 'QUEUED'
+ORDER BY t.queue_order, t.id;
+`)
+
+	return queue, err
+}
+
+// Dequeue changes the status of the queued train to TRAIN.
+// It returns false if the train is not queued anymore, such as cancelled by the user.
+func (tdb *TrainDbRepository) Dequeue(trainId int64) (bool, error) {
+	result, err := tdb.DB.Exec(`
+UPDATE train
+SET status         = 'TRAIN',
+    heartbeat_time = NOW()
+WHERE id = ?
+  AND status = 'QUEUED';
+`, trainId)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (tdb *TrainDbRepository) ReorderQueue(userId int64, trainNos []int64) error {
+	tx, err := tdb.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queue := make([]QueueEntry, 0)
+	err = tx.Select(&queue, `
+SELECT t.id,
+       t.user_id,
+       t.train_no,
+       t.queue_order
+FROM train t
+WHERE t.user_id = ?
+  AND t.status = 'QUEUED'
+ORDER BY t.queue_order, t.id
+FOR UPDATE;
+`, userId)
+	if err != nil {
+		return err
+	}
+
+	orders, err := reorderQueue(queue, trainNos)
+	if err != nil {
+		return err
+	}
+
+	for trainNo, order := range orders {
+		_, err := tx.Exec(`
+UPDATE train
+SET queue_order = ?
+WHERE user_id = ?
+  AND train_no = ?;
+`, order, userId, trainNo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateDatasetUrls updates the dataset urls of the train config to the prepared dataset files.
+func (tdb *TrainDbRepository) UpdateDatasetUrls(trainConfig TrainConfig) error {
+	_, err := tdb.DB.NamedExec(`
+UPDATE train_config
+SET train_dataset_url = :train_dataset_url,
+    valid_dataset_url = :valid_dataset_url,
+    test_dataset_url  = :test_dataset_url
+WHERE train_id = :train_id;
+`, trainConfig)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Cancel changes the status of the queued or running train to CANCELLED.
+// It returns false if the train is not queued or running anymore, such as finished meanwhile.
+func (tdb *TrainDbRepository) Cancel(trainId int64) (bool, error) {
+	result, err := tdb.DB.Exec(`
+UPDATE train
+SET status = 'CANCELLED'
+WHERE id = ?
+  AND status IN ('QUEUED', 'CREATED', 'TRAIN');
+`, trainId)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// Heartbeat records that the trainer is alive while training the train.
+// It returns false if the train is not training, such as cancelled or timed out.
+func (tdb *TrainDbRepository) Heartbeat(trainId int64) (bool, error) {
+	// affected rows can't tell whether the train is training,
+	// since heartbeats within the same second don't change the heartbeat time
+	_, err := tdb.DB.Exec(`
+UPDATE train
+SET heartbeat_time = NOW()
+WHERE id = ?
+  AND status = 'TRAIN';
+`, trainId)
+	if err != nil {
+		return false, err
+	}
+
+	var training bool
+	err = tdb.DB.Get(&training, `
+SELECT COUNT(*) > 0
+FROM train
+WHERE id = ?
+  AND status = 'TRAIN';
+`, trainId)
+	if err != nil {
+		return false, err
+	}
+
+	return training, nil
+}
+
+// FindStale finds the ids of training trains without heartbeat or epoch for the timeout.
+// The heartbeat is set when the train is dequeued, so the trainer which never reports is also timed out.
+func (tdb *TrainDbRepository) FindStale(timeout time.Duration) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := tdb.DB.Select(&ids, `
+SELECT t.id
+FROM train t
+WHERE t.status = 'TRAIN'
+  AND (t.heartbeat_time IS NULL
+    OR t.heartbeat_time < NOW() - INTERVAL ? SECOND);
+`, int64(timeout.Seconds()))
+
+	return ids, err
+}
+
+// ResetHeartbeats sets the heartbeat of every training train to now, including the trains never heartbeated,
+// so that the heartbeats missed while the server was down don't time them out immediately.
+func (tdb *TrainDbRepository) ResetHeartbeats() (int64, error) {
+	result, err := tdb.DB.Exec(`
+UPDATE train
+SET heartbeat_time = NOW()
+WHERE status = 'TRAIN';
+`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// MarkError changes the status of the train to ERR if its status is still the status.
+// It returns false if the status is changed meanwhile, such as finished.
+func (tdb *TrainDbRepository) MarkError(trainId int64, status string) (bool, error) {
+	result, err := tdb.DB.Exec(`
+UPDATE train
+SET status = 'ERR'
+WHERE id = ?
+  AND status = ?;
+`, trainId, status)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (tdb *TrainDbRepository) FindCallbackCredential(trainId int64) (CallbackCredential, error) {
+	var credential CallbackCredential
+	err := tdb.DB.Get(&credential, `
+SELECT t.user_id,
+       p.project_no,
+       COALESCE(t.callback_secret, '') AS callback_secret
+FROM train t
+         JOIN project p ON t.project_id = p.id
+WHERE t.id = ?;
+`, trainId)
+
+	return credential, err
+}
+
+// AdvanceEpoch updates the metrics of the train to the epoch,
+// only if the epoch is the latest saved epoch of the train.
+// It returns false if a later epoch is already saved.
+func (tdb *TrainDbRepository) AdvanceEpoch(epoch Epoch) (bool, error) {
+	result, err := tdb.DB.Exec(`
+UPDATE train t
+SET t.acc      = ?,
+    t.loss     = ?,
+    t.val_acc  = ?,
+    t.val_loss = ?,
+    t.epochs   = ?
+WHERE t.id = ?
+  AND ? >= (SELECT MAX(e.epoch) FROM epoch e WHERE e.train_id = t.id);
+`, epoch.Acc, epoch.Loss, epoch.ValAcc, epoch.ValLoss, epoch.Epoch, epoch.TrainId, epoch.Epoch)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// UpdateBest updates the best epoch of the train to the epoch,
+// only if the value of the monitored metric is better than the best value.
+func (tdb *TrainDbRepository) UpdateBest(trainId int64, epoch int, value float64, maximize bool) (bool, error) {
+	better := "best_value > ?"
+	if maximize {
+		better = "best_value < ?"
+	}
+
+	result, err := tdb.DB.Exec(`
+UPDATE train
+SET best_epoch = ?,
+    best_value = ?
+WHERE id = ?
+  AND (best_value IS NULL OR `+better+`);
+`, epoch, value, trainId, value)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
@@ -22,7 +22,7 @@ func insertLog() Option {
 	})
 }
 
-func (ldr *TrainLogDbRepository) Insert(trainLog TrainLog) error {
+func (ldr *TrainLogDbRepository) Insert(trainLog TrainLog) (int, error) {
 	builder := query.Builder{}
 	builder.AddInsert(
 			"train_log",
@@ -32,15 +32,20 @@ func (ldr *TrainLogDbRepository) Insert(trainLog TrainLog) error {
 
 	err := builder.Build()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = ldr.DB.NamedExec(builder.QueryString, &trainLog)
+	result, err := ldr.DB.NamedExec(builder.QueryString, &trainLog)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
 }
 
 func (ldr *TrainLogDbRepository) Delete(opts ...query.Option) error {
@@ -3,7 +3,8 @@ package train
 import "github.com/elixter/Querybuilder"
 
 type TrainLogRepository interface {
-	Insert(log TrainLog) error
+	// Insert inserts the log and returns its id, which increases in the order of insertion.
+	Insert(log TrainLog) (int, error)
 	Delete(opts ...query.Option) error
 	Find(opts ...query.Option) (TrainLog, error)
 	FindAll(opts ...query.Option) ([]TrainLog, error)
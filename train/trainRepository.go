@@ -1,6 +1,9 @@
 package train
 
-import "github.com/elixter/Querybuilder"
+import (
+	"github.com/elixter/Querybuilder"
+	"time"
+)
 
 //go:generate mockery --name TrainRepository --inpackage
 type TrainRepository interface {
@@ -12,4 +15,21 @@ type TrainRepository interface {
 	Find(opts ...query.Option) (Train, error)
 	FindAll(opts ...query.Option) ([]Train, error)
 	Update(train Train, opts ...query.Option) error
-}
\ No newline at end of file
+	UpdateDatasetUrls(trainConfig TrainConfig) error
+	AdvanceEpoch(epoch Epoch) (bool, error)
+	UpdateBest(trainId int64, epoch int, value float64, maximize bool) (bool, error)
+
+	CountQueued(userId int64) (int, error)
+	CountTrainingByUser() (map[int64]int, error)
+	FindQueue() ([]QueueEntry, error)
+	Dequeue(trainId int64) (bool, error)
+	ReorderQueue(userId int64, trainNos []int64) error
+	Cancel(trainId int64) (bool, error)
+
+	Heartbeat(trainId int64) (bool, error)
+	FindStale(timeout time.Duration) ([]int64, error)
+	ResetHeartbeats() (int64, error)
+	MarkError(trainId int64, status string) (bool, error)
+
+	FindCallbackCredential(trainId int64) (CallbackCredential, error)
+}
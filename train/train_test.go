@@ -53,15 +53,26 @@ func TestTrainDbRepository_FindAll(t *testing.T) {
 			&history.Train.Name,
 			&history.Train.Epochs,
 			&history.Train.ResultUrl,
+			&history.Train.ResultSize,
+			&history.Train.QueueOrder,
+			&history.Train.MonitorMetric,
+			&history.Train.BestEpoch,
+			&history.Train.BestValue,
 			&history.Train.Status,
 			&history.TrainConfig.Id,
 			&history.TrainConfig.TrainId,
 			&history.TrainConfig.TrainDatasetUrl,
 			&history.TrainConfig.ValidDatasetUrl,
+			&history.TrainConfig.TestDatasetUrl,
+			&history.TrainConfig.DatasetId,
+			&history.TrainConfig.DatasetVersionId,
+			&history.TrainConfig.DatasetConfigId,
 			&history.TrainConfig.DatasetShuffle,
 			&history.TrainConfig.DatasetLabel,
 			&history.TrainConfig.DatasetNormalizationUsage,
 			&history.TrainConfig.DatasetNormalizationMethod,
+			&history.TrainConfig.DatasetPipeline,
+			&history.TrainConfig.DatasetKind,
 			&history.TrainConfig.ModelContent,
 			&history.TrainConfig.ModelConfig,
 			&history.TrainConfig.CreateTime,
@@ -97,14 +108,14 @@ func TestHandler_DeleteTrainHistoryHandler(t *testing.T) {
 }
 
 func TestTrain_Update(t *testing.T) {
-	const expected = "UPDATE train SET status = ?, acc = ?, loss = ?, val_acc = ?, val_loss = ?, epochs = ?, name = ?, result_url = ? WHERE id = ?"
+	const expected = "UPDATE train SET status = ?, acc = ?, loss = ?, val_acc = ?, val_loss = ?, epochs = ?, name = ?, result_url = ?, result_size = ? WHERE id = ?"
 
 	var train Train
 
 	builder := query.ApplyQueryOptions()
 	builder.AddUpdate(
 		"train",
-		"status = ?, acc = ?, loss = ?, val_acc = ?, val_loss = ?, epochs = ?, name = ?, result_url = ?",
+		"status = ?, acc = ?, loss = ?, val_acc = ?, val_loss = ?, epochs = ?, name = ?, result_url = ?, result_size = ?",
 		train.Status,
 		train.Acc,
 		train.Loss,
@@ -113,6 +124,7 @@ func TestTrain_Update(t *testing.T) {
 		train.Epochs,
 		train.Name,
 		train.ResultUrl,
+		train.ResultSize,
 	).AddWhere("id = ?", train.Id)
 
 	err := builder.Build()
@@ -0,0 +1,124 @@
+package train
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"nns_back/log"
+	"time"
+)
+
+const (
+	DefaultHeartbeatTimeout = 10 * time.Minute
+
+	trainNotStartedMessage = "Train failed: the train was not started by the trainer"
+	trainTimeoutFormat     = "Train failed: no heartbeat or epoch from the trainer for %s"
+)
+
+// Watchdog fails the trains the trainer stopped reporting, such as the trainer died,
+// so that they don't hold the training slots of the user forever.
+// Trains are watched since they are dequeued, and every heartbeat or epoch gives them a full timeout again.
+type Watchdog struct {
+	trainRepository    TrainRepository
+	trainLogRepository TrainLogRepository
+	bridge             *Bridge
+
+	timeout  time.Duration
+	interval time.Duration
+}
+
+func NewWatchdog(trainRepository TrainRepository, trainLogRepository TrainLogRepository, bridge *Bridge, timeout time.Duration) *Watchdog {
+	return &Watchdog{
+		trainRepository:    trainRepository,
+		trainLogRepository: trainLogRepository,
+		bridge:             bridge,
+		timeout:            timeout,
+		interval:           timeout / 4,
+	}
+}
+
+// Reconcile fails the trains left CREATED by the previous server, which were never requested to the trainer,
+// and gives every train left TRAIN a full timeout to report again.
+// It should be called once before Run.
+func (w *Watchdog) Reconcile() error {
+	created, err := w.trainRepository.FindAll(WithTrainStatus(TrainStatusCreated))
+	if err != nil {
+		return errors.Wrap(err, "FindAll(status: CREATED)")
+	}
+	for _, train := range created {
+		w.fail(train.Id, TrainStatusCreated, trainNotStartedMessage)
+	}
+
+	reset, err := w.trainRepository.ResetHeartbeats()
+	if err != nil {
+		return errors.Wrap(err, "ResetHeartbeats()")
+	}
+
+	log.Infow("trains reconciled",
+		"failed", len(created),
+		"heartbeatReset", reset)
+
+	return nil
+}
+
+// Run fails the trains without heartbeat for the timeout at every interval. It never returns.
+func (w *Watchdog) Run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := w.check(); err != nil {
+			log.Errorw("failed to check stale trains",
+				"error", err)
+		}
+	}
+}
+
+func (w *Watchdog) check() error {
+	stale, err := w.trainRepository.FindStale(w.timeout)
+	if err != nil {
+		return errors.Wrap(err, "FindStale()")
+	}
+
+	for _, trainId := range stale {
+		w.fail(trainId, TrainStatusTrain, fmt.Sprintf(trainTimeoutFormat, w.timeout))
+	}
+
+	return nil
+}
+
+// fail marks the train as ERR with the log message, unless its status is changed meanwhile.
+func (w *Watchdog) fail(trainId int64, status string, message string) {
+	failed, err := w.trainRepository.MarkError(trainId, status)
+	if err != nil {
+		log.Errorw("failed to mark train as error",
+			"error", err,
+			"trainId", trainId)
+		return
+	}
+	if !failed {
+		return
+	}
+
+	log.Warnw("train failed by watchdog",
+		"trainId", trainId,
+		"status", status,
+		"message", message)
+
+	trainLog := TrainLog{
+		TrainId:    trainId,
+		Message:    message,
+		StatusCode: http.StatusGatewayTimeout,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}
+	if trainLog.Id, err = w.trainLogRepository.Insert(trainLog); err != nil {
+		log.Errorw("failed to insert train log",
+			"error", err,
+			"trainId", trainId)
+	}
+
+	if w.bridge != nil {
+		w.bridge.Fail(trainId, trainLog)
+	}
+}
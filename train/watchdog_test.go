@@ -0,0 +1,82 @@
+package train
+
+import (
+	"github.com/elixter/Querybuilder"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"nns_back/log"
+	"testing"
+	"time"
+)
+
+// watchdogTrainRepository is a TrainRepository of trains by id, which only supports the watchdog.
+type watchdogTrainRepository struct {
+	TrainRepository
+	statuses map[int64]string
+	stale    []int64
+}
+
+func (r *watchdogTrainRepository) FindAll(opts ...query.Option) ([]Train, error) {
+	// only called with the CREATED status
+	trains := make([]Train, 0)
+	for id, status := range r.statuses {
+		if status == TrainStatusCreated {
+			trains = append(trains, Train{Id: id, Status: status})
+		}
+	}
+	return trains, nil
+}
+
+func (r *watchdogTrainRepository) FindStale(timeout time.Duration) ([]int64, error) {
+	return r.stale, nil
+}
+
+func (r *watchdogTrainRepository) ResetHeartbeats() (int64, error) {
+	return 0, nil
+}
+
+func (r *watchdogTrainRepository) MarkError(trainId int64, status string) (bool, error) {
+	if r.statuses[trainId] != status {
+		return false, nil
+	}
+	r.statuses[trainId] = TrainStatusError
+	return true, nil
+}
+
+func TestWatchdog(t *testing.T) {
+	log.Init(zapcore.DebugLevel)
+
+	trainRepository := &watchdogTrainRepository{
+		statuses: map[int64]string{
+			1: TrainStatusCreated,
+			2: TrainStatusTrain,
+			3: TrainStatusTrain,
+			4: TrainStatusFinish,
+		},
+		// 4 is finished after found as stale
+		stale: []int64{3, 4},
+	}
+	trainLogRepository := &cancelTrainLogRepository{}
+	watchdog := NewWatchdog(trainRepository, trainLogRepository, NewBridge(nil, trainRepository, trainLogRepository), time.Minute)
+
+	assert.NoError(t, watchdog.Reconcile())
+	assert.Equal(t, TrainStatusError, trainRepository.statuses[1])
+	assert.Equal(t, TrainStatusTrain, trainRepository.statuses[2])
+
+	assert.NoError(t, watchdog.check())
+	assert.Equal(t, map[int64]string{
+		1: TrainStatusError,
+		2: TrainStatusTrain,
+		3: TrainStatusError,
+		4: TrainStatusFinish,
+	}, trainRepository.statuses)
+
+	if assert.Len(t, trainLogRepository.logs, 2) {
+		assert.Equal(t, int64(1), trainLogRepository.logs[0].TrainId)
+		assert.Equal(t, trainNotStartedMessage, trainLogRepository.logs[0].Message)
+		assert.Equal(t, int64(3), trainLogRepository.logs[1].TrainId)
+		assert.Equal(t, "Train failed: no heartbeat or epoch from the trainer for 1m0s", trainLogRepository.logs[1].Message)
+		assert.Equal(t, http.StatusGatewayTimeout, trainLogRepository.logs[1].StatusCode)
+	}
+}
@@ -12,18 +12,31 @@ const (
 	ErrInvalidFormat                ErrMsg = "Invalid Format"
 	ErrInvalidImageId               ErrMsg = "Invalid Image ID"
 	ErrInvalidDatasetId             ErrMsg = "Invalid Dataset ID"
+	ErrInvalidDatasetVersionId      ErrMsg = "Invalid Dataset Version ID"
 	ErrFileTooLarge                 ErrMsg = "File Too Large"
 	ErrUnSupportedContentType       ErrMsg = "Unsupported Content Type"
 	ErrRequiresDatasetConfigSetting ErrMsg = "Requires Dataset Config Setting"
-	ErrAlreadyTrainingToTheMax      ErrMsg = "Already Training To The Max"
+	ErrTrainQueueFull               ErrMsg = "Train Queue Full"
+	ErrInvalidDatasetConfig         ErrMsg = "Invalid Dataset Config"
+	ErrDatasetUploadNotComplete     ErrMsg = "Dataset Upload Not Complete"
 
 	// 401
 	ErrLoginRequired         ErrMsg = "Login Required"
 	ErrInvalidAuthentication ErrMsg = "Invalid Authentication"
 
+	// 403
+	ErrForbidden            ErrMsg = "Forbidden"
+	ErrStorageQuotaExceeded ErrMsg = "Storage Quota Exceeded"
+	ErrDatasetNotUsable     ErrMsg = "Dataset Not Usable"
+
 	// 404
 	ErrNotFound ErrMsg = "Not Found"
 
+	// 409
+	ErrDatasetInUse        ErrMsg = "Dataset In Use"
+	ErrTrainQueueChanged   ErrMsg = "Train Queue Changed"
+	ErrTrainNotCancellable ErrMsg = "Train Not Cancellable"
+
 	// 422
 	ErrDuplicate ErrMsg = "Duplicate Entity"
 